@@ -0,0 +1,18 @@
+// Command verify verifies GitHub artifact attestations and sigstore signatures of images. It is a
+// thin wrapper of the github-signing-demo-verify/pkg/verify package, which programs embedding the
+// verifier import instead.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github-signing-demo-verify/pkg/verify"
+)
+
+func main() {
+	if err := verify.Execute(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
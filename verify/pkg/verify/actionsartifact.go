@@ -0,0 +1,155 @@
+package verify
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// ActionsArtifact identifies an artifact uploaded by a workflow run with actions/upload-artifact,
+// written owner/repo@run-id on the command line, and optionally a file of the artifact
+type ActionsArtifact struct {
+	Repo  string
+	RunID int64
+	Name  string
+	// File is the path of a file in the artifact to verify instead of the artifact archive
+	File string
+}
+
+func parseActionsArtifact(run, artifact, file string) (ActionsArtifact, error) {
+	repo, runID, ok := strings.Cut(run, "@")
+	id, err := strconv.ParseInt(runID, 10, 64)
+	if !ok || err != nil || id <= 0 || strings.Count(repo, "/") != 1 {
+		return ActionsArtifact{}, fmt.Errorf("invalid --github-artifact %q, expected owner/repo@run-id", run)
+	}
+	if artifact == "" {
+		return ActionsArtifact{}, errors.New("--artifact is required with --github-artifact")
+	}
+	return ActionsArtifact{Repo: repo, RunID: id, Name: artifact, File: file}, nil
+}
+
+func (a ActionsArtifact) String() string {
+	s := fmt.Sprintf("%s@%d/%s", a.Repo, a.RunID, a.Name)
+	if a.File != "" {
+		s += "/" + a.File
+	}
+	return s
+}
+
+type actionsArtifactList struct {
+	Artifacts []struct {
+		Name               string `json:"name"`
+		Expired            bool   `json:"expired"`
+		ArchiveDownloadURL string `json:"archive_download_url"`
+		// Digest is the sha256 of the archive, reported for artifacts uploaded by upload-artifact v4
+		Digest string `json:"digest"`
+	} `json:"artifacts"`
+}
+
+// downloadActionsArtifact fetches the zip archive of an artifact through the Actions API, checking
+// it against the digest the API reports. The API requires a token even for public repositories.
+func downloadActionsArtifact(ctx context.Context, apiURL, token string, a ActionsArtifact) ([]byte, error) {
+	if token == "" {
+		return nil, errors.New("downloading workflow artifacts requires a GitHub token, e.g. $GITHUB_TOKEN")
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/actions/runs/%d/artifacts?name=%s", strings.TrimSuffix(apiURL, "/"), a.Repo, a.RunID, url.QueryEscape(a.Name))
+	body, err := gitHubGet(ctx, endpoint, "application/vnd.github+json", token)
+	if err != nil {
+		return nil, err
+	}
+	var list actionsArtifactList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode the artifacts of run %d: %w", a.RunID, err)
+	}
+	for _, artifact := range list.Artifacts {
+		if artifact.Name != a.Name {
+			continue
+		}
+		if artifact.Expired {
+			return nil, fmt.Errorf("artifact %s of run %d has expired", a.Name, a.RunID)
+		}
+		body, err := gitHubOpen(ctx, newDownloadClient(), artifact.ArchiveDownloadURL, "application/vnd.github+json", token)
+		if err != nil {
+			return nil, err
+		}
+		archive, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if artifact.Digest != "" {
+			digest, _, err := v1.SHA256(bytes.NewReader(archive))
+			if err != nil {
+				return nil, err
+			}
+			if digest.String() != artifact.Digest {
+				return nil, fmt.Errorf("artifact %s was downloaded as %s, but the Actions API reports %s", a.Name, digest, artifact.Digest)
+			}
+		}
+		return archive, nil
+	}
+	return nil, fmt.Errorf("run %d of %s has no artifact named %s", a.RunID, a.Repo, a.Name)
+}
+
+// artifactFile extracts a file from the zip archive of an artifact
+func artifactFile(archive []byte, path string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifact archive: %w", err)
+	}
+	f, err := reader.Open(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("artifact has no file %s: %w", path, err)
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// verifyActionsArtifact verifies the attestations the GitHub attestations API holds for the digest
+// of a workflow artifact: the digest of its zip archive, which upload-artifact outputs as
+// artifact-digest, or of one of its files with --artifact-file. The artifact is read from
+// archivePath when set instead of being downloaded.
+func verifyActionsArtifact(ctx context.Context, a ActionsArtifact, archivePath string, opts VerificationOptions, trustedMaterial *root.TrustedRoot) ([]VerificationResult, error) {
+	var archive []byte
+	var err error
+	if archivePath != "" {
+		archive, err = os.ReadFile(archivePath)
+	} else {
+		var token string
+		if token, err = opts.gitHubToken(ctx); err == nil {
+			archive, err = downloadActionsArtifact(ctx, opts.GitHubAPIURL, token, a)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := archive
+	if a.File != "" {
+		if content, err = artifactFile(archive, a.File); err != nil {
+			return nil, err
+		}
+	}
+	digest, size, err := v1.SHA256(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	desc := &v1.Descriptor{Digest: digest, Size: size}
+
+	source := &GitHubAPISource{APIURL: opts.GitHubAPIURL, Repo: a.Repo, Token: os.Getenv("GITHUB_TOKEN"), Tokens: opts.GitHubTokens}
+	bundles, err := source.Bundles(ctx, nil, desc)
+	if err != nil {
+		return nil, err
+	}
+	return verifyAttestations(ctx, a.String(), bundles, desc, trustedMaterial, opts)
+}
@@ -0,0 +1,142 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	admissionAdmit = "admit"
+	admissionDeny  = "deny"
+	admissionWarn  = "warn"
+)
+
+// AdmissionRule decides the admission of an image when its CEL expression is true. Rules are
+// evaluated in order and the first match wins; images no rule matches are admitted only if verified.
+type AdmissionRule struct {
+	Name       string `yaml:"name"`
+	Expression string `yaml:"expression"`
+	// Action is admit, deny or warn (admit with a warning)
+	Action  string `yaml:"action"`
+	program cel.Program
+}
+
+// AdmissionPolicy is the --admission-policy file of the serve command
+type AdmissionPolicy struct {
+	Rules []AdmissionRule `yaml:"rules"`
+}
+
+// admissionPolicyEnv declares the variables available to rule expressions. namespace is a reserved
+// word in CEL, so the namespace is read from request.namespace.
+func admissionPolicyEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.DynType),
+		cel.Variable("object", cel.DynType),
+		cel.Variable("image", cel.StringType),
+		cel.Variable("reference", cel.StringType),
+		cel.Variable("digest", cel.StringType),
+		cel.Variable("verified", cel.BoolType),
+		cel.Variable("error", cel.StringType),
+		cel.Variable("identities", cel.ListType(cel.MapType(cel.StringType, cel.StringType))),
+	)
+}
+
+func loadAdmissionPolicy(path string) (*AdmissionPolicy, error) {
+	if path == "" {
+		return &AdmissionPolicy{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admission policy: %w", err)
+	}
+	return parseAdmissionPolicy(path, data)
+}
+
+// parseAdmissionPolicy parses and compiles the rules of an admission policy read from location
+func parseAdmissionPolicy(location string, data []byte) (*AdmissionPolicy, error) {
+	policy := &AdmissionPolicy{}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse admission policy %s: %w", location, err)
+	}
+	env, err := admissionPolicyEnv()
+	if err != nil {
+		return nil, err
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if !slices.Contains([]string{admissionAdmit, admissionDeny, admissionWarn}, rule.Action) {
+			return nil, fmt.Errorf("admission rule %q: invalid action %q, expected admit, deny or warn", rule.Name, rule.Action)
+		}
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("admission rule %q: %w", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("admission rule %q: expression must be a boolean, not %s", rule.Name, ast.OutputType())
+		}
+		if rule.program, err = env.Program(ast); err != nil {
+			return nil, fmt.Errorf("admission rule %q: %w", rule.Name, err)
+		}
+	}
+	return policy, nil
+}
+
+// decide returns the action for an image and the rule that chose it, if any. Rules whose expression
+// fails to evaluate, e.g. on a missing field, don't match.
+func (p *AdmissionPolicy) decide(request map[string]any, outcome ImageResult) (string, string) {
+	vars := admissionVariables(request, outcome)
+	for _, rule := range p.Rules {
+		out, _, err := rule.program.Eval(vars)
+		if err != nil {
+			continue
+		}
+		if matched, ok := out.Value().(bool); ok && matched {
+			return rule.Action, rule.Name
+		}
+	}
+	if outcome.Err != nil {
+		return admissionDeny, ""
+	}
+	if outcome.Warning != nil {
+		return admissionWarn, ""
+	}
+	return admissionAdmit, ""
+}
+
+func admissionVariables(request map[string]any, outcome ImageResult) map[string]any {
+	vars := map[string]any{
+		"request":    request,
+		"object":     request["object"],
+		"image":      outcome.Image,
+		"reference":  normalizeImage(outcome.Image),
+		"digest":     "",
+		"verified":   outcome.Err == nil && outcome.Warning == nil && outcome.Skipped == nil,
+		"error":      "",
+		"identities": []map[string]string{},
+	}
+	if err := firstError(outcome.Err, outcome.Warning, outcome.Skipped); err != nil {
+		vars["error"] = err.Error()
+	}
+	identities := []map[string]string{}
+	for _, result := range outcome.Results {
+		vars["digest"] = result.Desc.Digest.String()
+		if signer, ok := signerSummary(result.Bundle); ok {
+			identities = append(identities, map[string]string{"issuer": signer.Extensions.Issuer, "subject": signer.SubjectAlternativeName})
+		}
+	}
+	vars["identities"] = identities
+	return vars
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// ociArtifactManifest is the artifact manifest of OCI 1.1 release candidates, still pushed by older ORAS clients
+	ociArtifactManifest types.MediaType = "application/vnd.oci.artifact.manifest.v1+json"
+	// helmReferencePrefix is how helm writes chart references, e.g. oci://ghcr.io/org/charts/app:1.0.0
+	helmReferencePrefix = "oci://"
+	// maxManifestSize is the manifest size registries are expected to accept
+	maxManifestSize = 4 << 20
+)
+
+// acceptedManifestTypes are the manifests an artifact can be, whatever it packages: container images,
+// Helm charts and WASM modules are all pushed as OCI manifests with their own config media type
+var acceptedManifestTypes = []types.MediaType{
+	types.OCIManifestSchema1,
+	types.OCIImageIndex,
+	types.DockerManifestSchema2,
+	types.DockerManifestList,
+	ociArtifactManifest,
+}
+
+// artifactManifest holds the fields of a manifest that identify what the artifact is
+type artifactManifest struct {
+	MediaType    types.MediaType `json:"mediaType"`
+	ArtifactType string          `json:"artifactType"`
+	Config       *v1.Descriptor  `json:"config"`
+}
+
+// fetchArtifactDescriptor resolves a reference to the descriptor of its manifest without assuming it
+// is an image. Unlike remote.Head, it accepts artifact manifests and sets the artifact type, which is
+// the config media type of artifacts like Helm charts that don't declare one. The digest is computed
+// with algorithm, whichever algorithm the registry addresses the manifest with.
+func fetchArtifactDescriptor(ctx context.Context, ref name.Reference, algorithm string) (*v1.Descriptor, error) {
+	registry := ref.Context().Registry
+	tr, err := authenticatedTransport(ctx, registry, ref.Scope(transport.PullScope))
+	if err != nil {
+		return nil, err
+	}
+	u := &url.URL{
+		Scheme: registry.Scheme(),
+		Host:   registry.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/manifests/%s", ref.Context().RepositoryStr(), ref.Identifier()),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	accept := make([]string, 0, len(acceptedManifestTypes))
+	for _, mediaType := range acceptedManifestTypes {
+		accept = append(accept, string(mediaType))
+	}
+	req.Header.Set("Accept", strings.Join(accept, ","))
+
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxManifestSize {
+		return nil, fmt.Errorf("manifest of %s exceeds %d bytes", ref, maxManifestSize)
+	}
+	return artifactDescriptor(raw, types.MediaType(resp.Header.Get("Content-Type")), resp.Header.Get("Docker-Content-Digest"), algorithm)
+}
+
+// artifactDescriptor describes a manifest by its digest with algorithm, checking the digest the
+// registry reported, with the algorithm the registry chose, against its content
+func artifactDescriptor(raw []byte, contentType types.MediaType, reportedDigest, algorithm string) (*v1.Descriptor, error) {
+	if reportedDigest != "" {
+		reported, err := parseDigest(reportedDigest)
+		if err != nil {
+			return nil, fmt.Errorf("registry reported digest %s: %w", reportedDigest, err)
+		}
+		if actual, err := computeDigest(reported.Algorithm, raw); err != nil || actual != reported {
+			return nil, fmt.Errorf("registry reported digest %s for a manifest with digest %s", reportedDigest, actual)
+		}
+	}
+	digest, err := computeDigest(algorithm, raw)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(raw))
+	var manifest artifactManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	desc := &v1.Descriptor{MediaType: manifest.MediaType, Digest: digest, Size: size, ArtifactType: manifest.ArtifactType}
+	if desc.MediaType == "" {
+		desc.MediaType = contentType
+	}
+	if desc.ArtifactType == "" && manifest.Config != nil && !isImageConfig(manifest.Config.MediaType) {
+		desc.ArtifactType = string(manifest.Config.MediaType)
+	}
+	return desc, nil
+}
+
+func isImageConfig(mediaType types.MediaType) bool {
+	return mediaType == types.OCIConfigJSON || mediaType == types.DockerConfigJSON
+}
@@ -0,0 +1,188 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Assertion is a --assert expression, <path> <op> <JSON value>, checked against the DSSE payload of
+// each verified bundle, e.g. predicate.buildDefinition.buildType == "https://actions.github.io/buildtypes/workflow/v1"
+type Assertion struct {
+	Expr string
+	// Path is a sequence of object keys (string) and array indexes (int)
+	Path  []any
+	Op    string
+	Value any
+	re    *regexp.Regexp
+}
+
+var assertionOperators = []string{"==", "!=", "=~"}
+
+// assertionFlags collects repeated --assert flags
+type assertionFlags []Assertion
+
+func (a *assertionFlags) String() string {
+	exprs := make([]string, 0, len(*a))
+	for _, assertion := range *a {
+		exprs = append(exprs, assertion.Expr)
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (a *assertionFlags) Set(value string) error {
+	assertion, err := parseAssertion(value)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, assertion)
+	return nil
+}
+
+func parseAssertion(expr string) (Assertion, error) {
+	assertion := Assertion{Expr: expr}
+	opIndex := -1
+	for _, op := range assertionOperators {
+		if i := strings.Index(expr, op); i > 0 && (opIndex < 0 || i < opIndex) {
+			opIndex, assertion.Op = i, op
+		}
+	}
+	if opIndex < 0 {
+		return Assertion{}, fmt.Errorf("invalid assertion %q, expected <path> ==, != or =~ <JSON value>", expr)
+	}
+
+	path, err := parseAssertionPath(strings.TrimSpace(expr[:opIndex]))
+	if err != nil {
+		return Assertion{}, fmt.Errorf("invalid assertion %q: %w", expr, err)
+	}
+	assertion.Path = path
+	if err := json.Unmarshal([]byte(strings.TrimSpace(expr[opIndex+len(assertion.Op):])), &assertion.Value); err != nil {
+		return Assertion{}, fmt.Errorf("invalid assertion %q, the value must be JSON, e.g. a quoted string: %w", expr, err)
+	}
+	if assertion.Op == "=~" {
+		pattern, ok := assertion.Value.(string)
+		if !ok {
+			return Assertion{}, fmt.Errorf("invalid assertion %q, =~ expects a quoted regular expression", expr)
+		}
+		if assertion.re, err = regexp.Compile(pattern); err != nil {
+			return Assertion{}, fmt.Errorf("invalid assertion %q: %w", expr, err)
+		}
+	}
+	return assertion, nil
+}
+
+// parseAssertionPath parses a path like predicate.materials[0].uri or predicate["build-type"]
+func parseAssertionPath(path string) ([]any, error) {
+	var elements []any
+	for rest := path; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, "[\""):
+			end := strings.Index(rest, "\"]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key in path %q", path)
+			}
+			elements, rest = append(elements, rest[2:end]), rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index %q in path %q", rest[1:end], path)
+			}
+			elements, rest = append(elements, index), rest[end+1:]
+		default:
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in path %q", path)
+			}
+			elements, rest = append(elements, rest[:end]), rest[end:]
+		}
+	}
+	if len(elements) == 0 {
+		return nil, errors.New("empty path")
+	}
+	return elements, nil
+}
+
+// checkAssertions fails unless the bundle's payload satisfies every assertion
+func checkAssertions(b *Bundle, assertions []Assertion) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+	if b.Payload == nil {
+		return errors.New("assertion failed: bundle has no payload")
+	}
+	var document any
+	if err := json.Unmarshal(b.Payload, &document); err != nil {
+		return fmt.Errorf("assertion failed: payload is not JSON: %w", err)
+	}
+	for _, assertion := range assertions {
+		if err := assertion.check(document); err != nil {
+			return fmt.Errorf("assertion failed: %s: %w", assertion.Expr, err)
+		}
+	}
+	return nil
+}
+
+func (a Assertion) check(document any) error {
+	value, found := lookupPath(document, a.Path)
+	switch a.Op {
+	case "==":
+		if !found || !reflect.DeepEqual(value, a.Value) {
+			return describeValue(value, found)
+		}
+	case "!=":
+		if found && reflect.DeepEqual(value, a.Value) {
+			return describeValue(value, found)
+		}
+	case "=~":
+		if s, ok := value.(string); !found || !ok || !a.re.MatchString(s) {
+			return describeValue(value, found)
+		}
+	}
+	return nil
+}
+
+func lookupPath(document any, path []any) (any, bool) {
+	value := document
+	for _, element := range path {
+		switch key := element.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[key]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := value.([]any)
+			if !ok || key >= len(array) {
+				return nil, false
+			}
+			value = array[key]
+		}
+	}
+	return value, true
+}
+
+func describeValue(value any, found bool) error {
+	if !found {
+		return errors.New("path not found")
+	}
+	actual, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("got %s", actual)
+}
@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/spf13/cobra"
+)
+
+// newAttestCommand signs a statement about an image keylessly, with the login flow of verification
+// receipts, and attaches the bundle to the image as a referrer
+func newAttestCommand() *cobra.Command {
+	fs := flag.NewFlagSet("attest", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	sopts := SigningOptions{}
+	predicatePath := fs.String("predicate", "", "JSON file holding the predicate of the statement")
+	predicateType := fs.String("predicate-type", "", "predicate type of the statement, e.g. https://slsa.dev/provenance/v1")
+	bundlePath := fs.String("bundle", "", "write the signed bundle to this path")
+	attach := fs.Bool("attach", true, "attach the signed bundle to the image as a referrer")
+	fs.StringVar(&opts.RekorURL, "rekor-url", defaultRekorURL, "Rekor instance the signature is logged in")
+	addSigningFlags(fs, &sopts)
+	addTrustFlags(fs, &opts)
+	addTransportFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "attest <image> --predicate <file> --predicate-type <type>",
+		Short: "Sign a statement about an image keylessly and attach it as a referrer",
+		Long: `Sign an in-toto statement about an image with an ephemeral key and a Fulcio certificate, log it in Rekor,
+and attach the bundle to the image as a referrer, so that verify can check it like any other attestation.
+The identity is the same as for verification receipts: --identity-token, $SIGSTORE_ID_TOKEN, the GitHub
+Actions token, or an interactive login outside CI. Local images can't have referrers: pass --attach=false
+and write the bundle with --bundle.`,
+		Args:    cobra.ExactArgs(1),
+		Example: "  attest ghcr.io/nirmata/app:v1.2.0 --predicate scan.json --predicate-type https://cosign.sigstore.dev/attestation/vuln/v1",
+	}, func(args []string) error {
+		image := args[0]
+		if *predicatePath == "" || *predicateType == "" {
+			return errors.New("attest requires --predicate and --predicate-type")
+		}
+		if !*attach && *bundlePath == "" {
+			return errors.New("attest requires --bundle when --attach=false")
+		}
+		if *attach && isLocalImage(image) {
+			return fmt.Errorf("%s is a local image, which can't have referrers: pass --attach=false and --bundle", image)
+		}
+		applyGitHubHost(&opts)
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+
+		predicateBytes, err := os.ReadFile(*predicatePath)
+		if err != nil {
+			return fmt.Errorf("failed to read predicate: %w", err)
+		}
+		var predicate map[string]any
+		if err := json.Unmarshal(predicateBytes, &predicate); err != nil {
+			return fmt.Errorf("predicate %s is not a JSON object: %w", *predicatePath, err)
+		}
+
+		ctx := context.TODO()
+		_, desc, err := resolveDescriptor(ctx, image, opts.digestAlgorithm())
+		if err != nil {
+			return err
+		}
+		trustedRoot, err := getTrustedRoot(ctx, opts)
+		if err != nil {
+			return err
+		}
+		statement := &in_toto.Statement{
+			StatementHeader: in_toto.StatementHeader{
+				Type:          "https://in-toto.io/Statement/v1",
+				PredicateType: *predicateType,
+				Subject:       []in_toto.Subject{statementSubject(image, desc)},
+			},
+			Predicate: json.RawMessage(predicateBytes),
+		}
+		attestation, err := signStatement(ctx, statement, sopts, opts.RekorURL, trustedRoot)
+		if err != nil {
+			return fmt.Errorf("failed to sign statement: %w", err)
+		}
+		bundleBytes, err := attestation.MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		if *bundlePath != "" {
+			if err := os.WriteFile(*bundlePath, bundleBytes, 0o644); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+		}
+		if *attach {
+			if err := attachToImage(ctx, image, desc, bundleBytes); err != nil {
+				return fmt.Errorf("failed to attach bundle: %w", err)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "attested %s@%s with a %s statement\n", statementSubject(image, desc).Name, desc.Digest, *predicateType)
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+package verify
+
+import (
+	"io"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/chrismellard/docker-credential-acr-env/pkg/credhelper"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+)
+
+var (
+	// the ECR and ACR credential helpers are linked in, rather than run as docker-credential-*
+	// binaries, and only return credentials for the registries of their cloud
+	ecrKeychain = authn.NewKeychainFromHelper(ecr.NewECRHelper(ecr.WithLogger(io.Discard)))
+	acrKeychain = authn.NewKeychainFromHelper(credhelper.NewACRCredentialsHelper())
+
+	// defaultKeychain resolves registry credentials from the docker config (honouring $DOCKER_CONFIG),
+	// then from the ambient credentials of the cloud the verifier runs in, so pulls from GCR/GAR,
+	// ECR and ACR work on GKE, EKS and AKS without a docker login
+	defaultKeychain = authn.NewMultiKeychain(authn.DefaultKeychain, google.Keychain, ecrKeychain, acrKeychain)
+
+	keychain authn.Keychain = profileKeychain{}
+)
+
+// profileKeychain resolves credentials with the auth method of the registry's profile in the
+// config file, or the default keychain
+type profileKeychain struct{}
+
+func (profileKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	switch registryProfile(target.RegistryStr()).Auth {
+	case "anonymous":
+		return authn.Anonymous, nil
+	case "docker":
+		return authn.DefaultKeychain.Resolve(target)
+	case "google":
+		return google.Keychain.Resolve(target)
+	case "ecr":
+		return ecrKeychain.Resolve(target)
+	case "acr":
+		return acrKeychain.Resolve(target)
+	default:
+		return defaultKeychain.Resolve(target)
+	}
+}
@@ -0,0 +1,108 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRequestBudget is the budget of requests without a timeout, the default timeoutSeconds
+	// of admission webhooks
+	defaultRequestBudget = 10 * time.Second
+
+	// responseMargin is the part of the webhook timeout kept to encode and send the response
+	responseMargin = time.Second
+)
+
+// VerificationTimeoutError is the error of the images whose verification didn't finish within the
+// budget of the admission request
+type VerificationTimeoutError struct {
+	Budget time.Duration
+}
+
+func (e VerificationTimeoutError) Error() string {
+	return fmt.Sprintf("verification timed out after %s", e.Budget)
+}
+
+func validateOnTimeout(onTimeout string) error {
+	if !slices.Contains(onErrorModes, onTimeout) {
+		return fmt.Errorf("invalid --on-timeout %q, expected one of %s", onTimeout, strings.Join(onErrorModes, ", "))
+	}
+	return nil
+}
+
+// requestBudget returns how long the images of an admission request may take to verify: the
+// --request-budget, or else the timeout the API server appends to the webhook URL, e.g.
+// ?timeout=10s, minus the time needed to respond
+func (s *admissionServer) requestBudget(r *http.Request) time.Duration {
+	if s.budget > 0 {
+		return s.budget
+	}
+	timeout, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+	if err != nil || timeout <= 0 {
+		timeout = defaultRequestBudget
+	}
+	if timeout > 2*responseMargin {
+		return timeout - responseMargin
+	}
+	return timeout / 2
+}
+
+// verifyWithinBudget verifies the images until the deadline of ctx, so that the webhook answers
+// before the API server gives up. The images still being verified when the deadline expires, or
+// failed because their requests were cancelled, get a VerificationTimeoutError as their error, warning
+// or skip reason depending on --on-timeout. Images that failed for another reason keep their error.
+func (s *admissionServer) verifyWithinBudget(ctx context.Context, targets []imageTarget, budget time.Duration) []ImageResult {
+	done := make(chan []ImageResult, 1)
+	go func() { done <- s.verifyTargets(ctx, targets) }()
+
+	var outcomes []ImageResult
+	select {
+	case outcomes = <-done:
+		if ctx.Err() == nil {
+			return outcomes
+		}
+	case <-ctx.Done():
+		outcomes = make([]ImageResult, len(targets))
+		for i, target := range targets {
+			outcomes[i] = ImageResult{Image: target.image}
+		}
+	}
+	for i, outcome := range outcomes {
+		if !timedOut(outcome) {
+			continue
+		}
+		s.metrics.timeouts.Add(1)
+		timeout := VerificationTimeoutError{Budget: budget}
+		switch s.onTimeout {
+		case onErrorWarn:
+			outcomes[i] = ImageResult{Image: outcome.Image, Warning: timeout}
+		case onErrorSkip:
+			outcomes[i] = ImageResult{Image: outcome.Image, Skipped: timeout}
+		default:
+			outcomes[i] = ImageResult{Image: outcome.Image, Err: timeout}
+		}
+	}
+	return outcomes
+}
+
+// timedOut reports whether an image was cut short by the deadline: it has no outcome yet, or its
+// error comes from the cancelled context rather than from verification
+func timedOut(outcome ImageResult) bool {
+	err := outcome.Err
+	if err == nil {
+		err = outcome.Warning
+	}
+	if err == nil {
+		err = outcome.Skipped
+	}
+	if err == nil {
+		return len(outcome.Results) == 0
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
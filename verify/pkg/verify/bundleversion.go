@@ -0,0 +1,62 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+)
+
+// supportedBundleVersions are the bundle versions sigstore-go can parse and verify
+var supportedBundleVersions = []string{"v0.1", "v0.2", "v0.3"}
+
+// bundleMediaTypeVersion returns the version declared by a sigstore bundle media type, in either
+// the application/vnd.dev.sigstore.bundle.v0.3+json or the older
+// application/vnd.dev.sigstore.bundle+json;version=0.1 form
+func bundleMediaTypeVersion(mediaType string) (string, bool) {
+	rest, ok := strings.CutPrefix(mediaType, sigstoreBundleArtifactTypePrefix)
+	if !ok {
+		return "", false
+	}
+	if version, ok := strings.CutPrefix(rest, "+json;version="); ok && version != "" {
+		return "v" + version, true
+	}
+	if version, ok := strings.CutSuffix(strings.TrimPrefix(rest, "."), "+json"); ok && strings.HasPrefix(version, "v") {
+		return version, true
+	}
+	return "", false
+}
+
+// checkBundleVersion rejects referrers whose artifact type declares a bundle version that can't be
+// parsed, before they are downloaded. Artifact types without a version are left to the parser.
+func checkBundleVersion(artifactType string) error {
+	version, ok := bundleMediaTypeVersion(artifactType)
+	if !ok || slices.Contains(supportedBundleVersions, version) {
+		return nil
+	}
+	return fmt.Errorf("unsupported bundle version %s, expected one of %s", version, strings.Join(supportedBundleVersions, ", "))
+}
+
+// unparsedBundle stands for a bundle that could not be parsed, so that it is reported as a failed
+// bundle instead of aborting the fetch of the others. id identifies it among the bundles of the
+// image, such as its content or the digest of its referrer.
+func unparsedBundle(id []byte, artifactType string, err error) *Bundle {
+	if errors.Is(err, bundle.ErrUnsupportedMediaType) {
+		err = fmt.Errorf("unsupported bundle version: %w", err)
+	} else if !strings.HasPrefix(err.Error(), "unsupported bundle version") {
+		err = fmt.Errorf("invalid bundle: %w", err)
+	}
+	sum := sha256.Sum256(id)
+	b := &Bundle{
+		ProtoBundle:  &bundle.ProtobufBundle{Bundle: &protobundle.Bundle{}},
+		ArtifactType: artifactType,
+		ParseErr:     err,
+		id:           sum[:],
+	}
+	b.Version, _ = bundleMediaTypeVersion(artifactType)
+	return b
+}
@@ -0,0 +1,76 @@
+package verify
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// certificateChain returns the chain from the bundle's leaf certificate to the trusted Fulcio root
+// that issued it, checked at the time the short-lived leaf was issued
+func certificateChain(b *Bundle, trustedRoot *root.TrustedRoot) ([]*x509.Certificate, error) {
+	content, err := b.ProtoBundle.VerificationContent()
+	if err != nil {
+		return nil, err
+	}
+	leaf := content.Certificate()
+	if leaf == nil {
+		return nil, errors.New("bundle is not signed with a certificate")
+	}
+
+	for _, authority := range trustedRoot.FulcioCertificateAuthorities() {
+		ca, ok := authority.(*root.FulcioCertificateAuthority)
+		if !ok || ca.Root == nil {
+			continue
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Root)
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range ca.Intermediates {
+			intermediates.AddCert(intermediate)
+		}
+		chains, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   leaf.NotBefore,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err == nil && len(chains) > 0 {
+			return chains[0], nil
+		}
+	}
+	return nil, errors.New("certificate chain does not terminate in a Fulcio root of the trusted root")
+}
+
+func printCertificateChain(w io.Writer, index int, chain []*x509.Certificate) {
+	fmt.Fprintf(w, "Certificate chain of verified attestation %d:\n", index)
+	for i, cert := range chain {
+		role := "intermediate"
+		switch i {
+		case 0:
+			role = "leaf"
+		case len(chain) - 1:
+			role = "root"
+		}
+		fmt.Fprintf(w, "  [%d] %s\n", i, role)
+		fmt.Fprintf(w, "      subject:    %s\n", cert.Subject)
+		fmt.Fprintf(w, "      issuer:     %s\n", cert.Issuer)
+		fmt.Fprintf(w, "      serial:     %s\n", cert.SerialNumber)
+		fmt.Fprintf(w, "      not before: %s\n", cert.NotBefore.UTC())
+		fmt.Fprintf(w, "      not after:  %s\n", cert.NotAfter.UTC())
+		var sans []string
+		for _, uri := range cert.URIs {
+			sans = append(sans, uri.String())
+		}
+		sans = append(sans, cert.EmailAddresses...)
+		if len(sans) > 0 {
+			fmt.Fprintf(w, "      san:        %s\n", strings.Join(sans, ", "))
+		}
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+}
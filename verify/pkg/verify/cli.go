@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// commandDoc is the help of a command
+type commandDoc struct {
+	Use     string
+	Short   string
+	Long    string
+	Example string
+	Args    cobra.PositionalArgs
+}
+
+// newCommand wraps the flags of a command into a cobra command, filling the flags that were not
+// passed from the environment and the config file before running it
+func newCommand(fs *flag.FlagSet, doc commandDoc, run func(args []string) error) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     doc.Use,
+		Short:   doc.Short,
+		Long:    doc.Long,
+		Example: doc.Example,
+		Args:    doc.Args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			explicit := map[string]bool{}
+			cmd.Flags().Visit(func(f *pflag.Flag) { explicit[f.Name] = true })
+			if err := applyFlagDefaults(fs, explicit); err != nil {
+				return err
+			}
+			// past this point errors are about verification, not about the command line
+			cmd.SilenceUsage = true
+			return run(args)
+		},
+	}
+	if cmd.Args == nil {
+		cmd.Args = cobra.NoArgs
+	}
+	if cmd.Long == "" {
+		cmd.Long = doc.Short
+	}
+	cmd.Flags().AddGoFlagSet(fs)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		f.Value = namedValue{f.Value}
+	})
+	return cmd
+}
+
+// namedValue names the custom flag types in the help, e.g. strings rather than stringsFlag
+type namedValue struct {
+	pflag.Value
+}
+
+func (v namedValue) Type() string {
+	name := v.Value.Type()
+	return strings.TrimSuffix(strings.TrimSuffix(name, "Flags"), "Flag")
+}
+
+// newRootCommand creates the command line, including the completion command generating shell
+// completion scripts for bash, zsh, fish and powershell
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:           filepath.Base(os.Args[0]),
+		Short:         "Verify GitHub artifact attestations and sigstore signatures of images",
+		SilenceErrors: true,
+	}
+
+	listAttestations := newVerifyCommand("list-attestations")
+	listAttestations.Short = "List the attestations of an image and their signers without enforcing the policy"
+	listAttestations.Long = listAttestations.Short
+	listAttestations.Example = "  list-attestations --image ghcr.io/nirmata/github-signing-demo:latest"
+	if err := listAttestations.Flags().Set("dry-run", "true"); err != nil {
+		panic(err)
+	}
+
+	root.AddCommand(
+		newVerifyCommand("verify"),
+		listAttestations,
+		newExportCommand(),
+		newAttestCommand(),
+		newScanManifestsCommand(),
+		newUpdateRootCommand(),
+		newReportCommand(),
+		newServeCommand(),
+		newGenerateManifestsCommand(),
+		newWatchCommand(),
+		newDiffCommand(),
+		newInspectBundleCommand(),
+		newShellCommand(),
+		newTUICommand(),
+		newCoverageCommand(),
+		newTrustedRootCommand(),
+		newVersionCommand(),
+		newPreflightCommand(),
+	)
+	return root
+}
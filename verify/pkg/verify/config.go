@@ -0,0 +1,89 @@
+package verify
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "GSD_"
+
+// configPath is the config file read by every command, overridden by $GSD_CONFIG
+func configPath() (string, error) {
+	if path := os.Getenv(envPrefix + "CONFIG"); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "github-signing-demo", "config.yaml"), nil
+}
+
+// loadConfig reads the config file, a map of flag names to values or lists of values for
+// repeatable flags. A missing file is not an error.
+func loadConfig() (map[string]any, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	config := map[string]any{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// envName is the environment variable setting a flag, e.g. GSD_PREDICATE_TYPE for --predicate-type
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyFlagDefaults fills every flag that was not passed on the command line from its GSD_*
+// environment variable, else from the config file. Keys of the config file that the command has
+// no flag for are ignored, so one file can serve all commands.
+func applyFlagDefaults(flags *flag.FlagSet, explicit map[string]bool) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if err := flags.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", envName(f.Name), err))
+			}
+			return
+		}
+		value, ok := config[f.Name]
+		if !ok {
+			return
+		}
+		values, isList := value.([]any)
+		if !isList {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if err := flags.Set(f.Name, fmt.Sprint(v)); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s in config: %w", f.Name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
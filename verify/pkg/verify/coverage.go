@@ -0,0 +1,146 @@
+package verify
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+)
+
+// signatureTagPattern matches the tags the tag schema of referrers and cosign push signatures and
+// attestations to, e.g. sha256-<hex> or sha256-<hex>.att, which aren't builds of the repository
+var signatureTagPattern = regexp.MustCompile(`^sha(256|512)-[0-9a-f]+(\.[a-z]+)?$`)
+
+// CoverageReport is the share of the digests of a repository with attestations passing the policy
+type CoverageReport struct {
+	Repository string
+	Digests    []DigestCoverage
+	Verified   int
+}
+
+// DigestCoverage is a digest of a repository, the tags pointing to it, and why it isn't attested
+type DigestCoverage struct {
+	Digest string
+	Tags   []string
+	Err    error
+}
+
+func newCoverageCommand() *cobra.Command {
+	fs := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	maxTags := fs.Int("max-tags", 0, "only check the last tags of the repository in lexical order, 0 for every tag")
+	minCoverage := fs.Float64("min-coverage", 0, "fail when less than this percentage of the digests is attested")
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "coverage <repository>",
+		Short: "Report which digests of a repository have attestations passing the policy",
+		Long: `List the tags of a repository, resolve them to digests, and verify each digest once with the policy
+flags. Prints the share of attested digests and the digests without verified attestations, with their
+tags, to track the adoption of attested builds.`,
+		Args:    cobra.ExactArgs(1),
+		Example: "  coverage ghcr.io/nirmata/github-signing-demo --subject-regexp '^https://github.com/nirmata/.*$' --min-coverage 90",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if err := validateOnError(opts.OnError); err != nil {
+			return err
+		}
+		repo, err := name.NewRepository(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid repository %s: %w", args[0], err)
+		}
+
+		ctx := context.TODO()
+		report, err := repositoryCoverage(ctx, repo, *maxTags, opts)
+		if err != nil {
+			return err
+		}
+		coverage := writeCoverageReport(os.Stdout, report)
+		if coverage < *minCoverage {
+			return fmt.Errorf("attestation coverage of %s is %.1f%%, below --min-coverage %.1f%%", report.Repository, coverage, *minCoverage)
+		}
+		return nil
+	})
+}
+
+// repositoryCoverage resolves the tags of a repository to digests and verifies each digest
+func repositoryCoverage(ctx context.Context, repo name.Repository, maxTags int, opts VerificationOptions) (CoverageReport, error) {
+	report := CoverageReport{Repository: repo.Name()}
+	tags, err := remote.List(repo, remote.WithAuthFromKeychain(contextKeychain(ctx)), remote.WithContext(ctx))
+	if err != nil {
+		return report, fmt.Errorf("failed to list the tags of %s: %w", repo, err)
+	}
+	tags = slices.DeleteFunc(tags, signatureTagPattern.MatchString)
+	sort.Strings(tags)
+	if maxTags > 0 && len(tags) > maxTags {
+		tags = tags[len(tags)-maxTags:]
+	}
+	if len(tags) == 0 {
+		return report, fmt.Errorf("%s has no tags", repo)
+	}
+
+	tagsByDigest := map[string][]string{}
+	var images []string
+	for _, tag := range tags {
+		desc, err := fetchArtifactDescriptor(ctx, repo.Tag(tag), opts.digestAlgorithm())
+		if err != nil {
+			return report, fmt.Errorf("failed to resolve %s:%s: %w", repo, tag, err)
+		}
+		digest := desc.Digest.String()
+		if _, ok := tagsByDigest[digest]; !ok {
+			images = append(images, repo.Digest(digest).String())
+		}
+		tagsByDigest[digest] = append(tagsByDigest[digest], tag)
+	}
+
+	outcomes, err := verifyAll(ctx, images, opts)
+	if err != nil {
+		return report, err
+	}
+	if err := recordOutcomes(opts, outcomes...); err != nil {
+		return report, err
+	}
+	for _, outcome := range outcomes {
+		_, digest, _ := strings.Cut(outcome.Image, "@")
+		coverage := DigestCoverage{Digest: digest, Tags: tagsByDigest[digest]}
+		if coverage.Err = firstError(outcome.Err, outcome.Warning, outcome.Skipped); coverage.Err == nil {
+			report.Verified++
+		}
+		report.Digests = append(report.Digests, coverage)
+	}
+	return report, nil
+}
+
+// writeCoverageReport prints the coverage of the repository and the unattested digests, and returns
+// the coverage percentage
+func writeCoverageReport(w io.Writer, report CoverageReport) float64 {
+	coverage := 100 * float64(report.Verified) / float64(len(report.Digests))
+	fmt.Fprintf(w, "%s: %d of %d digests attested (%.1f%%)\n", report.Repository, report.Verified, len(report.Digests), coverage)
+	if report.Verified < len(report.Digests) {
+		fmt.Fprintln(w, "unattested digests:")
+	}
+	for _, digest := range report.Digests {
+		if digest.Err == nil {
+			continue
+		}
+		fmt.Fprintf(w, "  %s (%s): %s\n", digest.Digest, strings.Join(digest.Tags, ", "), strings.SplitN(digest.Err.Error(), "\n", 2)[0])
+	}
+	return coverage
+}
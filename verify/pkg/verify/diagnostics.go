@@ -0,0 +1,136 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+)
+
+// BundleFailure records why a bundle failed verification
+type BundleFailure struct {
+	// Index is the position of the bundle among the bundles of the image, starting at 1
+	Index  int
+	Bundle *Bundle
+	Check  string
+	Err    error
+	// Signer is the identity in the bundle's certificate, if it has one
+	Signer *certificate.Summary
+}
+
+// verification checks in the order they run, matched against the error messages of sigstore-go,
+// the bundle download and parser, checkStatementSubject, checkKeySigned, checkSignatureAlgorithm and checkFreshness
+var verificationChecks = []struct {
+	prefix string
+	check  string
+}{
+	{"failed to fetch bundle", "download failed"},
+	{"unsupported bundle version", "unsupported version"},
+	{"invalid bundle", "invalid bundle"},
+	{"attestation subject does not reference this image", "subject mismatch"},
+	{"invalid in-toto statement", "invalid statement"},
+	{"missing in-toto statement", "invalid statement"},
+	{"bundle is signed with a certificate", "not signed with the key"},
+	{"signature algorithm not allowed", "signature algorithm not allowed"},
+	{"failed to verify log inclusion", "missing or invalid transparency log entry"},
+	{"failed to verify timestamps", "missing or invalid timestamp"},
+	{"threshold not met", "missing or invalid timestamp"},
+	{"no valid observer timestamps", "missing or invalid timestamp"},
+	{"failed to verify leaf certificate", "certificate not valid at the signing time or not issued by a trusted CA"},
+	{"failed to verify signed certificate timestamp", "missing or invalid signed certificate timestamp"},
+	{"failed to verify signature", "signature or artifact digest mismatch"},
+	{"failed to verify certificate identity", "identity mismatch"},
+	{"can't verify certificate identities", "identity mismatch"},
+	{"signing time unknown", "signing time unknown"},
+	{"attestation too old", "attestation too old"},
+	{"signing time out of range", "signing time out of range"},
+	{"identity allowlist", "identity not allowed"},
+	{"identity denylist", "identity denied"},
+	{"assertion failed", "assertion failed"},
+}
+
+func newBundleFailure(index int, b *Bundle, err error) BundleFailure {
+	failure := BundleFailure{Index: index, Bundle: b, Check: "verification", Err: err}
+	for _, c := range verificationChecks {
+		if strings.HasPrefix(err.Error(), c.prefix) {
+			failure.Check = c.check
+			break
+		}
+	}
+	if summary, ok := signerSummary(b); ok {
+		failure.Signer = &summary
+	}
+	return failure
+}
+
+// signerSummary returns the identity of the bundle's leaf certificate
+func signerSummary(b *Bundle) (certificate.Summary, bool) {
+	content, err := b.ProtoBundle.VerificationContent()
+	if err != nil {
+		return certificate.Summary{}, false
+	}
+	cert := content.Certificate()
+	if cert == nil {
+		return certificate.Summary{}, false
+	}
+	summary, err := certificate.SummarizeCertificate(cert)
+	if err != nil {
+		return certificate.Summary{}, false
+	}
+	return summary, true
+}
+
+// Describe explains the failure, comparing the signer with the identity the policy expected
+func (f BundleFailure) Describe(opts VerificationOptions) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "bundle #%d", f.Index)
+	if f.Bundle.DSSE_Envelope != nil {
+		fmt.Fprintf(&sb, " (%s)", f.Bundle.DSSE_Envelope.PredicateType)
+	}
+	fmt.Fprintf(&sb, ": %s: %v", f.Check, f.Err)
+	if f.Signer != nil {
+		fmt.Fprintf(&sb, "\n    certificate: issuer=%s subject=%s", f.Signer.Extensions.Issuer, f.Signer.SubjectAlternativeName)
+	}
+	fmt.Fprintf(&sb, "\n    expected:    %s", identityExpectation(opts))
+	return sb.String()
+}
+
+func describeFailures(failures []BundleFailure, opts VerificationOptions) string {
+	descriptions := make([]string, 0, len(failures))
+	for _, f := range failures {
+		descriptions = append(descriptions, "  "+f.Describe(opts))
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+// fetchFailedError is a failed verification some of whose bundles could not be downloaded. It
+// unwraps to the download errors too, so that --on-error treats the outcome, which a bundle that
+// failed to download may have changed, like an unreachable registry.
+type fetchFailedError struct {
+	err         error
+	fetchErrors []error
+}
+
+func (e *fetchFailedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchFailedError) Unwrap() []error {
+	return append([]error{e.err}, e.fetchErrors...)
+}
+
+// withFetchErrors wraps err into a fetchFailedError when some of the failures are download errors
+func withFetchErrors(err error, failures []BundleFailure) error {
+	var fetchErrors []error
+	for _, failure := range failures {
+		var fetchErr *BundleFetchError
+		if errors.As(failure.Err, &fetchErr) {
+			fetchErrors = append(fetchErrors, fetchErr)
+		}
+	}
+	if len(fetchErrors) == 0 {
+		return err
+	}
+	return &fetchFailedError{err: err, fetchErrors: fetchErrors}
+}
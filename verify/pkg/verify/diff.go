@@ -0,0 +1,152 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+// AttestationSummary is what diff compares between the verified attestations of two images
+type AttestationSummary struct {
+	Image  string
+	Digest string
+	// Signers are the issuer and subject of the signing certificates
+	Signers []string
+	// Builders and BuildTypes come from the verified SLSA provenance
+	Builders   []string
+	BuildTypes []string
+	// SourceCommits are the repository@commit the images were built from, from the signing
+	// certificates and the provenance
+	SourceCommits []string
+	// Packages are the package URLs of the verified SBOMs
+	Packages []string
+}
+
+func newDiffCommand() *cobra.Command {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	exitCode := fs.Bool("exit-code", false, "fail when the attestations of the images differ, e.g. to check that a promoted tag is the same build")
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "diff <image> <image>",
+		Short: "Verify two images and compare their signers, provenance and SBOMs",
+		Long: `Verify two images with the same policy and compare their verified attestations: the signer identities,
+the builder, build type and source commit of their provenance, and the packages of their SBOMs. Use it to
+check that a promoted tag is the same attested build as the staging tag.`,
+		Args:    cobra.ExactArgs(2),
+		Example: "  diff ghcr.io/nirmata/app:staging ghcr.io/nirmata/app:prod --subject-regexp '^https://github.com/nirmata/.*$' --exit-code",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+
+		ctx := context.TODO()
+		trustedMaterial, err := getTrustedRoot(ctx, opts)
+		if err != nil {
+			return err
+		}
+		summaries := make([]AttestationSummary, len(args))
+		for i, image := range args {
+			results, err := verifyImage(ctx, image, opts, trustedMaterial)
+			if err != nil {
+				return fmt.Errorf("%s: %w", image, err)
+			}
+			summaries[i] = summarizeAttestations(image, results)
+		}
+		if differ := writeAttestationDiff(os.Stdout, summaries[0], summaries[1]); differ && *exitCode {
+			return errors.New("the attestations of the images differ")
+		}
+		return nil
+	})
+}
+
+// summarizeAttestations collects the fields diff compares from the verified attestations of an image
+func summarizeAttestations(image string, results []VerificationResult) AttestationSummary {
+	summary := AttestationSummary{Image: image, Digest: results[0].Desc.Digest.String()}
+	for _, result := range results {
+		if signer, ok := signerSummary(result.Bundle); ok {
+			summary.Signers = append(summary.Signers, signer.Extensions.Issuer+" "+signer.SubjectAlternativeName)
+			if signer.Extensions.SourceRepositoryDigest != "" {
+				summary.SourceCommits = append(summary.SourceCommits, signer.Extensions.SourceRepositoryURI+"@"+signer.Extensions.SourceRepositoryDigest)
+			}
+		}
+		if provenance, err := result.Bundle.Provenance(); err == nil {
+			summary.Builders = append(summary.Builders, provenance.RunDetails.Builder.ID)
+			summary.BuildTypes = append(summary.BuildTypes, provenance.BuildDefinition.BuildType)
+			for _, dependency := range provenance.BuildDefinition.ResolvedDependencies {
+				if commit := dependency.Digest["gitCommit"]; commit != "" {
+					summary.SourceCommits = append(summary.SourceCommits, dependency.URI+"@"+commit)
+				}
+			}
+		}
+		if sbom, err := result.Bundle.SBOM(); err == nil {
+			if packages, err := sbomPackages(sbom); err == nil {
+				summary.Packages = append(summary.Packages, packages...)
+			}
+		}
+	}
+	for _, values := range []*[]string{&summary.Signers, &summary.Builders, &summary.BuildTypes, &summary.SourceCommits, &summary.Packages} {
+		slices.Sort(*values)
+		*values = slices.Compact(*values)
+	}
+	return summary
+}
+
+// writeAttestationDiff prints the fields of the summaries as same or with the values removed (-)
+// and added (+) from a to b, and reports whether any field differs
+func writeAttestationDiff(w io.Writer, a, b AttestationSummary) bool {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", a.Image, b.Image)
+	differ := false
+	fields := []struct {
+		name string
+		a, b []string
+	}{
+		{"digest", []string{a.Digest}, []string{b.Digest}},
+		{"signers", a.Signers, b.Signers},
+		{"builder", a.Builders, b.Builders},
+		{"build type", a.BuildTypes, b.BuildTypes},
+		{"source commit", a.SourceCommits, b.SourceCommits},
+		{"SBOM packages", a.Packages, b.Packages},
+	}
+	for _, field := range fields {
+		removed := setDifference(field.a, field.b)
+		added := setDifference(field.b, field.a)
+		if len(removed) == 0 && len(added) == 0 {
+			fmt.Fprintf(w, "%s: same\n", field.name)
+			continue
+		}
+		differ = true
+		fmt.Fprintf(w, "%s: %d removed, %d added\n", field.name, len(removed), len(added))
+		for _, value := range removed {
+			fmt.Fprintf(w, "  - %s\n", value)
+		}
+		for _, value := range added {
+			fmt.Fprintf(w, "  + %s\n", value)
+		}
+	}
+	return differ
+}
+
+// setDifference returns the values of a that are not in b
+func setDifference(a, b []string) []string {
+	var difference []string
+	for _, value := range a {
+		if !slices.Contains(b, value) {
+			difference = append(difference, value)
+		}
+	}
+	return difference
+}
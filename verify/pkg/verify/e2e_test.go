@@ -0,0 +1,350 @@
+package verify_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/testing/ca"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github-signing-demo-verify/pkg/verify"
+)
+
+const (
+	e2eIssuer        = "https://token.actions.githubusercontent.com"
+	e2eSubject       = "builder@nirmata.com"
+	e2ePredicateType = "https://slsa.dev/provenance/v1"
+	e2eBundleType    = "application/vnd.dev.sigstore.bundle.v0.3+json"
+)
+
+// e2eSigstore is a throwaway Sigstore instance, with its Fulcio, Rekor and timestamp authority,
+// and the trusted_root.json of it the verifier is pointed to
+type e2eSigstore struct {
+	*ca.VirtualSigstore
+	trustedRootPath string
+}
+
+func newE2ESigstore(t *testing.T) e2eSigstore {
+	t.Helper()
+	sigstore, err := ca.NewVirtualSigstore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the virtual logs are keyed by their hex log ID, which the trusted root stores decoded
+	logs := func(logs map[string]*root.TransparencyLog) map[string]*root.TransparencyLog {
+		for id, log := range logs {
+			if log.ID, err = hex.DecodeString(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return logs
+	}
+	trustedRoot, err := root.NewTrustedRoot(root.TrustedRootMediaType01, sigstore.FulcioCertificateAuthorities(), logs(sigstore.CTLogs()), sigstore.TimestampingAuthorities(), logs(sigstore.RekorLogs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := trustedRoot.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trusted_root.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return e2eSigstore{VirtualSigstore: sigstore, trustedRootPath: path}
+}
+
+// attest signs an in-toto statement of the predicate type about the digest as the identity, and
+// returns the bundle, with its certificate, Rekor entry and signed timestamp
+func (s e2eSigstore) attest(t *testing.T, identity, predicateType string, digest v1.Hash) []byte {
+	t.Helper()
+	statement, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       []map[string]any{{"name": "image", "digest": map[string]string{digest.Algorithm: digest.Hex}}},
+		"predicateType": predicateType,
+		"predicate":     map[string]any{"buildDefinition": map[string]any{"buildType": "https://actions.github.io/buildtypes/workflow/v1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the virtual Fulcio issues certificates valid from now, and v0.3 bundles need an inclusion proof
+	entity, err := s.AttestAtTime(identity, e2eIssuer, statement, time.Now().Add(5*time.Minute), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verificationContent, err := entity.VerificationContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureContent, err := entity.SignatureContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := signatureContent.(*bundle.Envelope).Envelope
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := entity.TlogEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamps, err := entity.Timestamps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	material := &protobundle.VerificationMaterial{
+		Content: &protobundle.VerificationMaterial_Certificate{
+			Certificate: &protocommon.X509Certificate{RawBytes: verificationContent.(*bundle.Certificate).Certificate().Raw},
+		},
+		TimestampVerificationData: &protobundle.TimestampVerificationData{},
+	}
+	for _, entry := range entries {
+		// the entries of the virtual Rekor leave out the kind and version of the body, which
+		// bundles carry
+		tle := proto.Clone(entry.TransparencyLogEntry()).(*protorekor.TransparencyLogEntry)
+		var body struct {
+			Kind       string `json:"kind"`
+			APIVersion string `json:"apiVersion"`
+		}
+		if err := json.Unmarshal(tle.CanonicalizedBody, &body); err != nil {
+			t.Fatal(err)
+		}
+		tle.KindVersion = &protorekor.KindVersion{Kind: body.Kind, Version: body.APIVersion}
+		material.TlogEntries = append(material.TlogEntries, tle)
+	}
+	for _, timestamp := range timestamps {
+		material.TimestampVerificationData.Rfc3161Timestamps = append(material.TimestampVerificationData.Rfc3161Timestamps, &protocommon.RFC3161SignedTimestamp{SignedTimestamp: timestamp})
+	}
+	data, err := protojson.Marshal(&protobundle.Bundle{
+		MediaType:            e2eBundleType,
+		VerificationMaterial: material,
+		Content: &protobundle.Bundle_DsseEnvelope{DsseEnvelope: &protodsse.Envelope{
+			Payload:     payload,
+			PayloadType: envelope.PayloadType,
+			Signatures:  []*protodsse.Signature{{Sig: signature}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newE2ERegistry serves an in-process OCI registry supporting the referrers API and returns its host
+func newE2ERegistry(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.WithReferrersSupport(true), registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// pushE2EImage pushes a random image to the repository and returns its tag reference and digest
+func pushE2EImage(t *testing.T, repository string) (name.Reference, v1.Hash) {
+	t.Helper()
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(repository + ":latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, image); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := image.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref, digest
+}
+
+// e2eManifest is a raw manifest to push
+type e2eManifest []byte
+
+func (m e2eManifest) RawManifest() ([]byte, error) { return m, nil }
+
+func (m e2eManifest) MediaType() (types.MediaType, error) { return types.OCIManifestSchema1, nil }
+
+// attachE2EBundle pushes a bundle as an OCI artifact whose subject is the image, the way
+// gh attestation and cosign attach them
+func attachE2EBundle(t *testing.T, ref name.Reference, bundle []byte) {
+	t.Helper()
+	subject, err := remote.Head(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the registry of go-containerregistry lists the config media type as the artifact type of the
+	// referrers, so the empty config has the media type of the bundle, as with older OCI 1.1 clients
+	var descriptors []v1.Descriptor
+	for _, content := range [][]byte{[]byte("{}"), bundle} {
+		layer := static.NewLayer(content, e2eBundleType)
+		if err := remote.WriteLayer(ref.Context(), layer); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := layer.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := layer.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		descriptors = append(descriptors, v1.Descriptor{MediaType: e2eBundleType, Digest: digest, Size: size})
+	}
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     types.OCIManifestSchema1,
+		"artifactType":  e2eBundleType,
+		"config":        descriptors[0],
+		"layers":        descriptors[1:],
+		"subject":       v1.Descriptor{MediaType: subject.MediaType, Digest: subject.Digest, Size: subject.Size},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, _, err := v1.SHA256(bytes.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Put(ref.Context().Digest(digest.String()), e2eManifest(manifest)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// e2eObserver records why the bundles of the image failed verification
+type e2eObserver struct {
+	verify.NopObserver
+	errs []error
+}
+
+func (o *e2eObserver) OnBundleVerified(image string, bundle *verify.Bundle, err error) {
+	if err != nil {
+		o.errs = append(o.errs, err)
+	}
+}
+
+// TestVerifyImagesEndToEnd pushes images and their attestations to a local registry, signed by a
+// throwaway Sigstore instance, and verifies them through the library API without any network access
+func TestVerifyImagesEndToEnd(t *testing.T) {
+	sigstore := newE2ESigstore(t)
+	untrusted := newE2ESigstore(t)
+	host := newE2ERegistry(t)
+	otherDigest := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}
+
+	tests := []struct {
+		name string
+		// attach returns the bundles to attach to the image of the digest
+		attach   func(t *testing.T, digest v1.Hash) [][]byte
+		options  []verify.VerificationOption
+		expected string
+	}{
+		{
+			name: "valid",
+			attach: func(t *testing.T, digest v1.Hash) [][]byte {
+				return [][]byte{sigstore.attest(t, e2eSubject, e2ePredicateType, digest)}
+			},
+			options: []verify.VerificationOption{verify.WithRequirement(e2ePredicateType, 1)},
+		},
+		{
+			name:     "no attestations",
+			attach:   func(t *testing.T, digest v1.Hash) [][]byte { return nil },
+			expected: "no verified attestations found",
+		},
+		{
+			name: "other signer",
+			attach: func(t *testing.T, digest v1.Hash) [][]byte {
+				return [][]byte{sigstore.attest(t, "intruder@example.com", e2ePredicateType, digest)}
+			},
+			expected: "identity mismatch",
+		},
+		{
+			name: "statement about another image",
+			attach: func(t *testing.T, digest v1.Hash) [][]byte {
+				return [][]byte{sigstore.attest(t, e2eSubject, e2ePredicateType, otherDigest)}
+			},
+			expected: "subject mismatch",
+		},
+		{
+			name: "untrusted sigstore instance",
+			attach: func(t *testing.T, digest v1.Hash) [][]byte {
+				return [][]byte{untrusted.attest(t, e2eSubject, e2ePredicateType, digest)}
+			},
+			expected: "transparency log entry",
+		},
+		{
+			name: "missing required predicate type",
+			attach: func(t *testing.T, digest v1.Hash) [][]byte {
+				return [][]byte{sigstore.attest(t, e2eSubject, e2ePredicateType, digest)}
+			},
+			options:  []verify.VerificationOption{verify.WithRequirement("https://spdx.dev/Document", 1)},
+			expected: "requirements not met",
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, digest := pushE2EImage(t, host+"/nirmata/app"+string(rune('a'+i)))
+			for _, attestation := range test.attach(t, digest) {
+				attachE2EBundle(t, ref, attestation)
+			}
+			observer := &e2eObserver{}
+			options := append([]verify.VerificationOption{
+				verify.WithSubject(e2eSubject),
+				verify.WithIssuer(e2eIssuer),
+				verify.WithTrustedRootPath(sigstore.trustedRootPath),
+				verify.WithObserver(observer),
+			}, test.options...)
+			opts, err := verify.NewVerificationOptions(options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := verify.VerifyImages(context.Background(), []string{ref.String()}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, ok := results[ref.String()]
+			if !ok {
+				t.Fatalf("no result for %s in %v", ref, results)
+			}
+			switch {
+			case test.expected == "" && result.Err != nil:
+				t.Fatalf("unexpected error: %v (bundles: %v)", result.Err, observer.errs)
+			case test.expected == "" && len(result.Results) == 0:
+				t.Fatal("expected a verified attestation")
+			case test.expected != "" && (result.Err == nil || !strings.Contains(result.Err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, result.Err)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// PolicyTrace is the step-by-step evaluation of the policy for an image, written by --explain
+type PolicyTrace struct {
+	Image    string         `json:"image"`
+	Digest   string         `json:"digest,omitempty"`
+	Bundles  []*BundleTrace `json:"bundles"`
+	Steps    []TraceStep    `json:"steps"`
+	Verified bool           `json:"verified"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// BundleTrace is the evaluation of one bundle, in the order the checks ran. A failed step is the
+// last one, since later checks don't run.
+type BundleTrace struct {
+	Index         int         `json:"index"`
+	PredicateType string      `json:"predicateType,omitempty"`
+	Skipped       string      `json:"skipped,omitempty"`
+	Steps         []TraceStep `json:"steps"`
+	Verified      bool        `json:"verified"`
+}
+
+// TraceStep is a single check, with what the policy expected and what the bundle had when known
+type TraceStep struct {
+	Check    string `json:"check"`
+	Passed   bool   `json:"passed"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// explainMu keeps the traces of images verified concurrently from interleaving
+var explainMu sync.Mutex
+
+func newPolicyTrace(image string, opts VerificationOptions) *PolicyTrace {
+	if !opts.Explain {
+		return nil
+	}
+	return &PolicyTrace{Image: image, Bundles: []*BundleTrace{}, Steps: []TraceStep{}}
+}
+
+// addBundle starts the trace of a bundle, returning nil when not tracing
+func (t *PolicyTrace) addBundle(index int, b *Bundle) *BundleTrace {
+	if t == nil {
+		return nil
+	}
+	trace := &BundleTrace{Index: index, Steps: []TraceStep{}}
+	if b.DSSE_Envelope != nil {
+		trace.PredicateType = b.DSSE_Envelope.PredicateType
+	}
+	t.Bundles = append(t.Bundles, trace)
+	return trace
+}
+
+// record adds the outcome of a check that the policy enables, and returns its error
+func (t *BundleTrace) record(check string, enabled bool, err error) error {
+	if t != nil && (enabled || err != nil) {
+		t.Steps = append(t.Steps, newTraceStep(check, "", "", err))
+	}
+	return err
+}
+
+func (t *BundleTrace) skip(reason string) {
+	if t != nil {
+		t.Skipped = reason
+	}
+}
+
+// recordVerification breaks the sigstore verification down into the checks it made. A failure is
+// reported as the check its error identifies.
+func (t *BundleTrace) recordVerification(b *Bundle, result *verify.VerificationResult, err error, opts VerificationOptions) error {
+	if t == nil {
+		return err
+	}
+	expectedIdentity := identityExpectation(opts)
+	if err != nil {
+		step := newTraceStep(newBundleFailure(t.Index, b, err).Check, "", "", err)
+		if signer, ok := signerSummary(b); ok && step.Check == "identity mismatch" {
+			step.Expected = expectedIdentity
+			step.Actual = fmt.Sprintf("issuer=%s subject=%s", signer.Extensions.Issuer, signer.SubjectAlternativeName)
+		}
+		t.Steps = append(t.Steps, step)
+		return err
+	}
+
+	t.Steps = append(t.Steps, newTraceStep("signature", "", "", nil))
+	if entries, tlogErr := b.ProtoBundle.TlogEntries(); tlogErr == nil && len(entries) > 0 {
+		indexes := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			indexes = append(indexes, fmt.Sprint(entry.LogIndex()))
+		}
+		t.Steps = append(t.Steps, newTraceStep("transparency log", "at least 1 entry", "log index "+strings.Join(indexes, ", "), nil))
+	}
+	timestamps := make([]string, 0, len(result.VerifiedTimestamps))
+	for _, ts := range result.VerifiedTimestamps {
+		timestamps = append(timestamps, fmt.Sprintf("%s %s", ts.Type, ts.Timestamp.UTC().Format("2006-01-02T15:04:05Z")))
+	}
+	t.Steps = append(t.Steps, newTraceStep("timestamps", "at least 1 verified timestamp", strings.Join(timestamps, ", "), nil))
+
+	if result.Signature == nil || result.Signature.Certificate == nil {
+		t.Steps = append(t.Steps, newTraceStep("key", expectedIdentity, "", nil))
+		return nil
+	}
+	cert := result.Signature.Certificate
+	t.Steps = append(t.Steps, newTraceStep("certificate identity", expectedIdentity, fmt.Sprintf("issuer=%s subject=%s", cert.Extensions.Issuer, cert.SubjectAlternativeName), nil))
+	for _, extension := range certificateExtensions(cert.Extensions) {
+		t.Steps = append(t.Steps, newTraceStep("certificate extension "+extension[0], "", extension[1], nil))
+	}
+	return nil
+}
+
+// finish records the policy checks made across bundles and writes the trace to w
+func (t *PolicyTrace) finish(w io.Writer, digest string, opts VerificationOptions, results []VerificationResult, err error) {
+	if t == nil {
+		return
+	}
+	t.Digest = digest
+	for _, bt := range t.Bundles {
+		bt.Verified = bt.Skipped == "" && len(bt.Steps) > 0 && bt.Steps[len(bt.Steps)-1].Passed
+	}
+	for _, requirement := range opts.requirements() {
+		t.Steps = append(t.Steps, newTraceStep("require "+requirement.PredicateType, fmt.Sprintf("at least %d verified", requirement.Count), "", checkRequirements(results, []Requirement{requirement})))
+	}
+	if opts.MinIdentities > 0 {
+		t.Steps = append(t.Steps, newTraceStep("min identities", fmt.Sprint(opts.MinIdentities), "", checkMinIdentities(results, opts.MinIdentities)))
+	}
+	t.Verified = err == nil
+	if err != nil {
+		t.Error = err.Error()
+	}
+
+	explainMu.Lock()
+	defer explainMu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(t); encodeErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to write policy trace: %v\n", encodeErr)
+	}
+}
+
+func newTraceStep(check, expected, actual string, err error) TraceStep {
+	step := TraceStep{Check: check, Passed: err == nil, Expected: expected, Actual: actual}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	return step
+}
+
+// identityExpectation describes the signer the policy expects
+func identityExpectation(opts VerificationOptions) string {
+	if opts.Key != "" {
+		return "key=" + opts.Key
+	}
+	subject := opts.Subject
+	if opts.SubjectRegexp != "" {
+		subject = "~" + opts.SubjectRegexp
+	}
+	return fmt.Sprintf("issuer=%s subject=%s", opts.OIDCIssuer, subject)
+}
+
+// certificateExtensions lists the Fulcio extensions set in a certificate as name and value pairs,
+// sorted by name
+func certificateExtensions(extensions certificate.Extensions) [][2]string {
+	raw, err := json.Marshal(extensions)
+	if err != nil {
+		return nil
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([][2]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, [2]string{name, values[name]})
+	}
+	return pairs
+}
@@ -0,0 +1,242 @@
+package verify
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/spf13/cobra"
+)
+
+const (
+	exportManifestFile    = "export.json"
+	exportTrustedRootFile = "trusted_root.json"
+	exportBundlesDir      = "bundles/"
+)
+
+// Export is the content of an archive created by the export command
+type Export struct {
+	Image       string
+	Descriptor  *v1.Descriptor
+	Bundles     []*Bundle
+	TrustedRoot *root.TrustedRoot
+	// TrustedRootJSON is the trusted_root.json TrustedRoot was parsed from
+	TrustedRootJSON []byte
+}
+
+type exportManifest struct {
+	Image      string         `json:"image"`
+	Descriptor *v1.Descriptor `json:"descriptor"`
+}
+
+func newExportCommand() *cobra.Command {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	image := fs.String("image", "", "image to export attestations for")
+	output := fs.String("output", "attestations.tar", "path of the archive to write")
+	opts := VerificationOptions{}
+	addSourceFlags(fs, &opts)
+	addTrustFlags(fs, &opts)
+	addTransportFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:     "export --image <image>",
+		Short:   "Export the attestations of an image and the trusted root for offline verification",
+		Example: "  export --image ghcr.io/nirmata/github-signing-demo:latest --output attestations.tar\n  verify --from-export attestations.tar --image ghcr.io/nirmata/github-signing-demo:latest --subject \"...\"",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+
+		ref, err := parseImageReference(*image)
+		if err != nil {
+			return fmt.Errorf("failed to parse image reference %s: %w", *image, err)
+		}
+		bundles, desc, err := resolveBundles(context.TODO(), *image, opts)
+		if err != nil {
+			return err
+		}
+		bundles = slices.DeleteFunc(bundles, func(b *Bundle) bool {
+			if b.ParseErr != nil {
+				fmt.Fprintf(os.Stderr, "skipping bundle that can't be exported: %v\n", b.ParseErr)
+			}
+			return b.ParseErr != nil
+		})
+		trustedRootJSON, err := getTrustedRootJSON(context.TODO(), opts)
+		if err != nil {
+			return err
+		}
+		if err := checkPinnedTrustedRoot(trustedRootJSON, opts); err != nil {
+			return err
+		}
+
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := writeExport(f, ref.String(), desc, bundles, trustedRootJSON); err != nil {
+			return fmt.Errorf("failed to write export %s: %w", *output, err)
+		}
+
+		fmt.Printf("Exported %d bundles for %s@%s to %s, with trusted root sha256:%s\n", len(bundles), ref.Context(), desc.Digest, *output, trustedRootDigest(trustedRootJSON))
+		return nil
+	})
+}
+
+// checkExportTrustedRoot fails unless the trusted root of an export is one the verifier already
+// trusts: the --pin-trusted-root, else the --trusted-root-path, else the root cached from TUF.
+// Whoever hands over the archive also chose its trusted root, which alone proves nothing.
+func checkExportTrustedRoot(export *Export, opts VerificationOptions) error {
+	if opts.PinTrustedRoot != "" {
+		return checkPinnedTrustedRoot(export.TrustedRootJSON, opts)
+	}
+	var trusted []byte
+	var err error
+	source := "the trusted root cached from " + tufMirror(opts)
+	if opts.TrustedRootPath != "" {
+		source = opts.TrustedRootPath
+		trusted, err = os.ReadFile(opts.TrustedRootPath)
+	} else {
+		trusted, err = trustedRoots.cached(opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the trusted root to check the export against: %w", err)
+	}
+	if digest := trustedRootDigest(export.TrustedRootJSON); digest != trustedRootDigest(trusted) {
+		return fmt.Errorf("trusted root sha256:%s of the export doesn't match %s; review it with `trusted-root diff` and pass --pin-trusted-root sha256:%s to trust it", digest, source, digest)
+	}
+	return nil
+}
+
+// checkExportImage fails unless the export is of the image, or, without one, unless --expected-digest
+// or --lockfile pins the digest it must have. The archive names its image itself, so an export of
+// another image signed by the same identity would otherwise verify in its place. A tag only matches
+// an export of the same tag, since it can't be resolved offline.
+func checkExportImage(export *Export, image string, opts VerificationOptions) error {
+	if image == "" {
+		if opts.ExpectedDigest == "" && opts.Pins == nil {
+			return errors.New("--from-export needs --image, --expected-digest or --lockfile to check the export is of the expected image")
+		}
+		return nil
+	}
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", image, err)
+	}
+	exported, err := parseImageReference(export.Image)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s of the export: %w", export.Image, err)
+	}
+	if ref.Context() != exported.Context() {
+		return fmt.Errorf("export is of %s, not %s", export.Image, image)
+	}
+	if digest, ok := ref.(name.Digest); ok {
+		if digest.DigestStr() != export.Descriptor.Digest.String() {
+			return fmt.Errorf("export is of %s@%s, not %s", exported.Context(), export.Descriptor.Digest, image)
+		}
+		return nil
+	}
+	if ref.Name() != exported.Name() {
+		return fmt.Errorf("export is of %s, not %s; pass --image %s@%s to verify it", export.Image, image, exported.Context(), export.Descriptor.Digest)
+	}
+	return nil
+}
+
+func writeExport(w io.Writer, image string, desc *v1.Descriptor, bundles []*Bundle, trustedRootJSON []byte) error {
+	tw := tar.NewWriter(w)
+
+	manifest, err := json.Marshal(exportManifest{Image: image, Descriptor: desc})
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, exportManifestFile, manifest); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, exportTrustedRootFile, trustedRootJSON); err != nil {
+		return err
+	}
+	for i, b := range bundles {
+		bundleBytes, err := b.ProtoBundle.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, fmt.Sprintf("%s%d.json", exportBundlesDir, i), bundleBytes); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// readExport loads an export archive without any network access
+func readExport(archive string) (*Export, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	export := &Export{}
+	var manifest *exportManifest
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read export %s: %w", archive, err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from export: %w", hdr.Name, err)
+		}
+
+		switch {
+		case hdr.Name == exportManifestFile:
+			manifest = &exportManifest{}
+			if err := json.Unmarshal(content, manifest); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", hdr.Name, err)
+			}
+		case hdr.Name == exportTrustedRootFile:
+			export.TrustedRootJSON = content
+			export.TrustedRoot, err = root.NewTrustedRootFromJSON(content)
+			if err != nil {
+				return nil, fmt.Errorf("error creating trusted root: %w", err)
+			}
+		case strings.HasPrefix(hdr.Name, exportBundlesDir) && path.Ext(hdr.Name) == ".json":
+			b, err := parseBundle(content)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			export.Bundles = append(export.Bundles, b)
+		}
+	}
+
+	if manifest == nil || manifest.Descriptor == nil {
+		return nil, fmt.Errorf("export %s is missing %s", archive, exportManifestFile)
+	}
+	if export.TrustedRoot == nil {
+		return nil, fmt.Errorf("export %s is missing %s", archive, exportTrustedRootFile)
+	}
+	export.Image, export.Descriptor = manifest.Image, manifest.Descriptor
+	return export, nil
+}
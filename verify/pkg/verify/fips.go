@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/fips140"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// fipsSignatureAlgorithms are the signature algorithms approved by FIPS 186-5
+var fipsSignatureAlgorithms = signatureAlgorithmsFlag{"ecdsa-p256", "ecdsa-p384", "ecdsa-p521", "ed25519", "rsa-2048", "rsa-3072", "rsa-4096"}
+
+// checkFIPS fails unless the process runs the Go FIPS 140-3 module, which restricts TLS and all other
+// cryptography to approved algorithms
+func checkFIPS(opts VerificationOptions) error {
+	if !opts.FIPS || fips140.Enabled() {
+		return nil
+	}
+	return errors.New("--fips requires the Go FIPS 140-3 module: build with -tags fips, or run with GODEBUG=fips140=on")
+}
+
+// allowedSignatureAlgorithms are the --allowed-signature-algorithms, restricted to the approved ones with --fips
+func (opts VerificationOptions) allowedSignatureAlgorithms() signatureAlgorithmsFlag {
+	if !opts.FIPS {
+		return opts.SignatureAlgorithms
+	}
+	if len(opts.SignatureAlgorithms) == 0 {
+		return fipsSignatureAlgorithms
+	}
+	allowed := signatureAlgorithmsFlag{}
+	for _, algorithm := range opts.SignatureAlgorithms {
+		if fipsSignatureAlgorithms.contains(algorithm) {
+			allowed = append(allowed, algorithm)
+		}
+	}
+	return allowed
+}
+
+// checkTrustedRootFIPS fails when a key of the trusted root uses an algorithm that is not approved, since
+// bundles verified against it would rely on that algorithm
+func checkTrustedRootFIPS(trustedRoot *root.TrustedRoot, opts VerificationOptions) error {
+	if !opts.FIPS {
+		return nil
+	}
+	var errs []error
+	checkKey := func(what string, publicKey crypto.PublicKey) {
+		if err := checkSignatureAlgorithm(publicKey, fipsSignatureAlgorithms); err != nil {
+			errs = append(errs, fmt.Errorf("trusted root %s: %w", what, err))
+		}
+	}
+	checkCerts := func(what string, certs ...*x509.Certificate) {
+		for _, cert := range certs {
+			if cert != nil {
+				checkKey(fmt.Sprintf("%s certificate %s", what, cert.Subject), cert.PublicKey)
+			}
+		}
+	}
+	for _, ca := range trustedRoot.FulcioCertificateAuthorities() {
+		if fulcio, ok := ca.(*root.FulcioCertificateAuthority); ok {
+			checkCerts("certificate authority "+fulcio.URI, append([]*x509.Certificate{fulcio.Root}, fulcio.Intermediates...)...)
+		}
+	}
+	for _, tsa := range trustedRoot.TimestampingAuthorities() {
+		if authority, ok := tsa.(*root.SigstoreTimestampingAuthority); ok {
+			checkCerts("timestamping authority "+authority.URI, append([]*x509.Certificate{authority.Root, authority.Leaf}, authority.Intermediates...)...)
+		}
+	}
+	for _, log := range trustedRoot.RekorLogs() {
+		checkKey("transparency log "+log.BaseURL, log.PublicKey)
+	}
+	for _, log := range trustedRoot.CTLogs() {
+		checkKey("certificate transparency log "+log.BaseURL, log.PublicKey)
+	}
+	return errors.Join(errs...)
+}
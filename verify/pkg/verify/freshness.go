@@ -0,0 +1,94 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// ageFlag is a duration flag that also accepts a number of days, e.g. 30d
+type ageFlag time.Duration
+
+func (a *ageFlag) String() string {
+	if *a == 0 {
+		return ""
+	}
+	return time.Duration(*a).String()
+}
+
+func (a *ageFlag) Set(value string) error {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid age %q, expected a number of days such as 30d or a duration such as 12h", value)
+		}
+		*a = ageFlag(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid age %q, expected a number of days such as 30d or a duration such as 12h", value)
+	}
+	*a = ageFlag(d)
+	return nil
+}
+
+// timeFlag is an RFC 3339 time or date flag. The config file parser turns unquoted dates into
+// times, which reach Set formatted by fmt.
+type timeFlag time.Time
+
+func (t *timeFlag) String() string {
+	if time.Time(*t).IsZero() {
+		return ""
+	}
+	return time.Time(*t).Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(value string) error {
+	for _, layout := range []string{time.RFC3339, time.DateOnly, "2006-01-02 15:04:05 -0700 MST"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			*t = timeFlag(parsed)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q, expected RFC 3339 such as 2025-01-02T15:04:05Z or a date such as 2025-01-02", value)
+}
+
+// signingTime is the earliest verified timestamp of the bundle: the integrated time of its log
+// entry or a signed timestamp
+func signingTime(result *verify.VerificationResult) (time.Time, bool) {
+	var earliest time.Time
+	for _, ts := range result.VerifiedTimestamps {
+		if earliest.IsZero() || ts.Timestamp.Before(earliest) {
+			earliest = ts.Timestamp
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// checkFreshness applies --max-attestation-age, --min-signing-time and --max-signing-time to the
+// signing time of a verified bundle
+func checkFreshness(result *verify.VerificationResult, opts VerificationOptions, now time.Time) error {
+	maxAge, minTime, maxTime := time.Duration(opts.MaxAttestationAge), time.Time(opts.MinSigningTime), time.Time(opts.MaxSigningTime)
+	if maxAge == 0 && minTime.IsZero() && maxTime.IsZero() {
+		return nil
+	}
+	signed, ok := signingTime(result)
+	if !ok {
+		return errors.New("signing time unknown: the bundle has no verified timestamp")
+	}
+	if maxAge != 0 && now.Sub(signed) > maxAge {
+		return fmt.Errorf("attestation too old: signed at %s, more than %s ago", signed.UTC().Format(time.RFC3339), maxAge)
+	}
+	if !minTime.IsZero() && signed.Before(minTime) {
+		return fmt.Errorf("signing time out of range: signed at %s, before %s", signed.UTC().Format(time.RFC3339), minTime.Format(time.RFC3339))
+	}
+	if !maxTime.IsZero() && signed.After(maxTime) {
+		return fmt.Errorf("signing time out of range: signed at %s, after %s", signed.UTC().Format(time.RFC3339), maxTime.Format(time.RFC3339))
+	}
+	return nil
+}
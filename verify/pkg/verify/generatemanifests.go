@@ -0,0 +1,160 @@
+package verify
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed deploy/webhook.yaml.tmpl
+var webhookManifestsTemplate string
+
+// deployConfig parameterizes the manifests of the admission webhook
+type deployConfig struct {
+	Name              string
+	Namespace         string
+	Image             string
+	Replicas          int
+	Policy            string
+	Args              []string
+	NamespaceLabels   map[string]string
+	ExcludeNamespaces []string
+	FailurePolicy     string
+	TimeoutSeconds    int
+	Reverify          bool
+	PolicyCRDs        bool
+	PullSecrets       bool
+}
+
+func newGenerateManifestsCommand() *cobra.Command {
+	fs := flag.NewFlagSet("generate-manifests", flag.ContinueOnError)
+	name := fs.String("name", "verify-webhook", "name of the deployment, service, webhook configuration and RBAC objects")
+	namespace := fs.String("namespace", "verify", "namespace to deploy the webhook to")
+	image := fs.String("verifier-image", "", "image of the verifier to deploy")
+	replicas := fs.Int("replicas", 2, "number of webhook replicas")
+	policyPath := fs.String("admission-policy", "", "YAML file of CEL admission rules, deployed as a config map")
+	namespaceLabels := annotationFlags{}
+	fs.Var(&namespaceLabels, "namespace-selector", "only verify objects of namespaces with this label, as <key>=<value> (can be repeated)")
+	var excluded stringsFlag
+	fs.Var(&excluded, "exclude-namespace", "never verify objects of this namespace, in addition to kube-system and the webhook's (can be repeated)")
+	failurePolicy := fs.String("failure-policy", "Fail", "what the API server does when the webhook is unreachable: Fail or Ignore")
+	timeout := fs.Int("timeout", 10, "seconds the API server waits for the webhook, at most 30")
+	reverifyInterval := fs.Duration("reverify-interval", 0, "how often the leader replica verifies again the images of every running pod (0 disables it)")
+	policyCRDs := fs.Bool("policy-crds", false, "install the ImageVerificationPolicy CRD and verify images against its resources")
+	pullSecrets := fs.Bool("pull-secrets", false, "let the webhook read the imagePullSecrets of pods and service accounts to verify private images")
+	output := fs.String("output", "-", "file to write the manifests to, - for stdout")
+	return newCommand(fs, commandDoc{
+		Use:   "generate-manifests --verifier-image <image> [-- <serve flags>]",
+		Short: "Generate the Kubernetes manifests deploying the verifier as an admission webhook",
+		Long: `Generate the Kubernetes manifests deploying the verifier as an admission webhook: its namespace, RBAC,
+Deployment, Service and ValidatingWebhookConfiguration, and with --policy-crds the ImageVerificationPolicy
+CRD. The webhook serves a self-signed certificate it
+generates itself, so it needs no cert-manager. Flags after -- are passed to serve, e.g. the policy.`,
+		Args:    cobra.ArbitraryArgs,
+		Example: "  generate-manifests --verifier-image ghcr.io/nirmata/verify:v1.0.0 --namespace-selector verify=enabled -- --subject-regexp '^https://github.com/nirmata/.*$' | kubectl apply -f -",
+	}, func(args []string) error {
+		if *image == "" {
+			return errors.New("--verifier-image is required")
+		}
+		if *failurePolicy != "Fail" && *failurePolicy != "Ignore" {
+			return fmt.Errorf("invalid --failure-policy %q, expected Fail or Ignore", *failurePolicy)
+		}
+		if *timeout < 1 || *timeout > 30 {
+			return fmt.Errorf("invalid --timeout %d, expected 1 to 30 seconds", *timeout)
+		}
+		if err := checkServeArgs(args); err != nil {
+			return err
+		}
+
+		config := deployConfig{
+			Name:              *name,
+			Namespace:         *namespace,
+			Image:             *image,
+			Replicas:          *replicas,
+			NamespaceLabels:   namespaceLabels,
+			ExcludeNamespaces: []string{"kube-system", *namespace},
+			FailurePolicy:     *failurePolicy,
+			TimeoutSeconds:    *timeout,
+			Reverify:          *reverifyInterval > 0,
+			PolicyCRDs:        *policyCRDs,
+			PullSecrets:       *pullSecrets,
+		}
+		for _, ns := range excluded {
+			if !slices.Contains(config.ExcludeNamespaces, ns) {
+				config.ExcludeNamespaces = append(config.ExcludeNamespaces, ns)
+			}
+		}
+		config.Args = []string{"serve", "--listen", ":8443",
+			"--self-signed-tls", "--tls-secret", *namespace + "/" + *name + "-tls",
+			"--webhook-service", *namespace + "/" + *name, "--webhook-config", *name}
+		if config.PolicyCRDs {
+			config.Args = append(config.Args, "--policy-crds")
+		}
+		if config.PullSecrets {
+			config.Args = append(config.Args, "--pull-secrets")
+		}
+		if config.Reverify {
+			config.Args = append(config.Args, "--reverify-interval", reverifyInterval.String(),
+				"--leader-election-lease", *namespace+"/"+*name+"-leader")
+		}
+		if *policyPath != "" {
+			policy, err := os.ReadFile(*policyPath)
+			if err != nil {
+				return fmt.Errorf("failed to read admission policy: %w", err)
+			}
+			if _, err := loadAdmissionPolicy(*policyPath); err != nil {
+				return err
+			}
+			config.Policy = string(policy)
+			config.Args = append(config.Args, "--admission-policy", "/etc/verify/policy.yaml")
+		}
+		config.Args = append(config.Args, args...)
+
+		var w io.Writer = os.Stdout
+		if *output != "-" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return renderManifests(w, config)
+	})
+}
+
+// renderManifests renders the webhook manifests. Every value is written as a JSON string, which
+// YAML reads as a quoted scalar, so values can't break the structure of the manifests.
+func renderManifests(w io.Writer, config deployConfig) error {
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"quote": func(value string) (string, error) {
+			quoted, err := json.Marshal(value)
+			return string(quoted), err
+		},
+	}).Parse(webhookManifestsTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, config)
+}
+
+// checkServeArgs fails on flags that serve would reject, so that typos don't surface as a crash
+// looping deployment
+func checkServeArgs(args []string) error {
+	serve := newServeCommand()
+	if err := serve.ParseFlags(args); err != nil {
+		return fmt.Errorf("invalid serve flags: %w", err)
+	}
+	if extra := serve.Flags().Args(); len(extra) > 0 {
+		return fmt.Errorf("invalid serve flags: unexpected argument %q", extra[0])
+	}
+	return nil
+}
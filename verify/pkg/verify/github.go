@@ -0,0 +1,111 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultGitHubHost   = "github.com"
+	defaultGitHubIssuer = "https://token.actions.githubusercontent.com"
+	defaultGitHubAPIURL = "https://api.github.com"
+	// githubTUFMirror serves the trusted root of GitHub's own Sigstore instance, used for attestations
+	// of private repositories
+	githubTUFMirror = "https://tuf-repo.github.com"
+)
+
+// GitHubEndpoints are the per-host services used to verify attestations created on a GitHub instance
+type GitHubEndpoints struct {
+	OIDCIssuer string
+	APIURL     string
+	TUFMirror  string
+}
+
+// gitHubEndpoints derives the endpoints of a GitHub host. github.com attestations for public
+// repositories are verified against the Sigstore public good instance, so no TUF mirror is set.
+// GHE.com tenants serve everything from subdomains of the tenant host, while GitHub Enterprise
+// Server serves the token service and API from the host itself.
+func gitHubEndpoints(host string) GitHubEndpoints {
+	host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://"), "/")
+	switch {
+	case host == "" || host == defaultGitHubHost:
+		return GitHubEndpoints{OIDCIssuer: defaultGitHubIssuer, APIURL: defaultGitHubAPIURL}
+	case strings.HasSuffix(host, ".ghe.com"):
+		return GitHubEndpoints{
+			OIDCIssuer: fmt.Sprintf("https://token.actions.%s", host),
+			APIURL:     fmt.Sprintf("https://api.%s", host),
+			TUFMirror:  fmt.Sprintf("https://tuf-repo.%s", host),
+		}
+	default:
+		return GitHubEndpoints{
+			OIDCIssuer: fmt.Sprintf("https://%s/_services/token", host),
+			APIURL:     fmt.Sprintf("https://%s/api/v3", host),
+			TUFMirror:  fmt.Sprintf("https://tuf-repo.%s", host),
+		}
+	}
+}
+
+// applyGitHubHost fills the issuer, API URL and TUF mirror options that were not set explicitly
+// with the values derived from --github-host, and sets up the GitHub API token source
+func applyGitHubHost(opts *VerificationOptions) {
+	endpoints := gitHubEndpoints(opts.GitHubHost)
+	if opts.OIDCIssuer == "" {
+		opts.OIDCIssuer = endpoints.OIDCIssuer
+	}
+	if opts.GitHubAPIURL == "" {
+		opts.GitHubAPIURL = endpoints.APIURL
+	}
+	if opts.TUFMirror == "" {
+		opts.TUFMirror = endpoints.TUFMirror
+	}
+	opts.GitHubTokens = newGitHubTokenSource(*opts)
+}
+
+// applyGitHubWorkflows expands --github-workflow and --github-reusable-workflow into the subject of
+// the certificate. For a reusable workflow the subject is the reusable workflow, and the workflow
+// that called it is checked by buildPolicy against the certificate's build config URI.
+func applyGitHubWorkflows(opts *VerificationOptions) error {
+	workflow, reusable := opts.GitHubWorkflow, opts.GitHubReusableWorkflow
+	if workflow == "" && reusable == "" {
+		return nil
+	}
+	if opts.Subject != "" || opts.SubjectRegexp != "" {
+		return errors.New("--github-workflow and --github-reusable-workflow can't be combined with --subject or --subject-regexp")
+	}
+	if reusable == "" {
+		reusable = workflow
+	}
+	subject, err := gitHubWorkflowURI(opts.GitHubHost, reusable)
+	if err != nil {
+		return err
+	}
+	opts.Subject = subject
+	return nil
+}
+
+// gitHubCallerWorkflowURI returns the workflow that must have called --github-reusable-workflow, if any
+func gitHubCallerWorkflowURI(opts VerificationOptions) (string, error) {
+	if opts.GitHubReusableWorkflow == "" || opts.GitHubWorkflow == "" {
+		return "", nil
+	}
+	return gitHubWorkflowURI(opts.GitHubHost, opts.GitHubWorkflow)
+}
+
+// gitHubWorkflowURI turns owner/repo/.github/workflows/build.yaml@refs/heads/main into the URI Fulcio
+// puts in certificates issued to that workflow
+func gitHubWorkflowURI(host, workflow string) (string, error) {
+	path, ref, ok := strings.Cut(workflow, "@")
+	if !ok || ref == "" || !strings.HasPrefix(ref, "refs/") {
+		return "", fmt.Errorf("invalid workflow %q, expected owner/repo/.github/workflows/<file>@refs/...", workflow)
+	}
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || !strings.HasPrefix(parts[2], ".github/workflows/") {
+		return "", fmt.Errorf("invalid workflow %q, expected owner/repo/.github/workflows/<file>@refs/...", workflow)
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://"), "/")
+	if host == "" {
+		host = defaultGitHubHost
+	}
+	return fmt.Sprintf("https://%s/%s@%s", host, path, ref), nil
+}
@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// writeGitHubActions emits a ::notice or ::error workflow command per image, and appends a Markdown
+// table of the results to the job summary when running in GitHub Actions
+func writeGitHubActions(w io.Writer, outcomes []ImageResult) error {
+	for _, outcome := range outcomes {
+		switch {
+		case outcome.Err != nil:
+			fmt.Fprintf(w, "::error title=Attestation verification failed::%s\n", escapeWorkflowCommand(fmt.Sprintf("%s: %v", outcome.Image, outcome.Err)))
+			continue
+		case outcome.Warning != nil:
+			fmt.Fprintf(w, "::warning title=Attestation not verified::%s\n", escapeWorkflowCommand(fmt.Sprintf("%s: %v", outcome.Image, outcome.Warning)))
+			continue
+		case outcome.Skipped != nil:
+			fmt.Fprintf(w, "::notice title=Attestation verification skipped::%s\n", escapeWorkflowCommand(fmt.Sprintf("%s: %v", outcome.Image, outcome.Skipped)))
+			continue
+		}
+		message := fmt.Sprintf("%s verified as %s with %d attestation(s)", outcome.Image, pinnedReference(outcome.Image, outcome.Results[0].Desc), len(outcome.Results))
+		fmt.Fprintf(w, "::notice title=Attestation verified::%s\n", escapeWorkflowCommand(message))
+	}
+
+	summaryPath := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryPath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(summaryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open job summary: %w", err)
+	}
+	defer f.Close()
+	_, err = io.WriteString(f, jobSummary(outcomes))
+	return err
+}
+
+// jobSummary renders the outcomes as a Markdown table, followed by the errors of failed images
+func jobSummary(outcomes []ImageResult) string {
+	var sb strings.Builder
+	sb.WriteString("## Attestation verification\n\n")
+	sb.WriteString("| | Image | Digest | Attestations | Signer |\n|---|---|---|---|---|\n")
+	var failures []ImageResult
+	for _, outcome := range outcomes {
+		switch {
+		case outcome.Err != nil:
+			failures = append(failures, outcome)
+			fmt.Fprintf(&sb, "| ❌ | `%s` | | | |\n", outcome.Image)
+			continue
+		case outcome.Warning != nil:
+			fmt.Fprintf(&sb, "| ⚠️ | `%s` | | not verified: %s | |\n", outcome.Image, outcome.Warning)
+			continue
+		case outcome.Skipped != nil:
+			fmt.Fprintf(&sb, "| ⏭️ | `%s` | | skipped | |\n", outcome.Image)
+			continue
+		}
+		var types, signers []string
+		for _, result := range outcome.Results {
+			if statement := result.Bundle.DSSE_Envelope; statement != nil && !slices.Contains(types, statement.PredicateType) {
+				types = append(types, statement.PredicateType)
+			}
+			if signer, ok := signerSummary(result.Bundle); ok && !slices.Contains(signers, signer.SubjectAlternativeName) {
+				signers = append(signers, signer.SubjectAlternativeName)
+			}
+		}
+		fmt.Fprintf(&sb, "| ✅ | `%s` | `%s` | %s | %s |\n", outcome.Image, outcome.Results[0].Desc.Digest, strings.Join(types, "<br>"), strings.Join(signers, "<br>"))
+	}
+	for _, failure := range failures {
+		fmt.Fprintf(&sb, "\n<details><summary><code>%s</code> failed verification</summary>\n\n```\n%v\n```\n\n</details>\n", failure.Image, failure.Err)
+	}
+	return sb.String()
+}
+
+// escapeWorkflowCommand escapes the characters that would end a workflow command message
+func escapeWorkflowCommand(message string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(message)
+}
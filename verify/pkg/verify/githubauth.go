@@ -0,0 +1,194 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// gitHubTokenRefreshMargin is how long before expiry a short-lived token is replaced
+	gitHubTokenRefreshMargin = 5 * time.Minute
+	// defaultExchangedTokenLifetime is assumed for exchanged tokens returned without an expiry,
+	// GitHub installation tokens being valid for an hour
+	defaultExchangedTokenLifetime = 50 * time.Minute
+)
+
+// GitHubTokenSource returns the token of GitHub API requests: an installation token of a GitHub
+// App, a token exchanged for an OIDC token of the workload, or $GITHUB_TOKEN. Short-lived tokens
+// are cached and refreshed before they expire, so long-running commands keep working.
+type GitHubTokenSource struct {
+	APIURL string
+	// AppID, InstallationID and PrivateKeyPath identify a GitHub App installation
+	AppID          string
+	InstallationID string
+	PrivateKeyPath string
+	// ExchangeURL is a token broker, such as octo-sts, exchanging an OIDC token for a GitHub token
+	ExchangeURL string
+	// OIDCTokenFile holds the OIDC token to exchange, such as a projected Kubernetes service
+	// account token; inside GitHub Actions the job's token is requested instead
+	OIDCTokenFile string
+	OIDCAudience  string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newGitHubTokenSource(opts VerificationOptions) *GitHubTokenSource {
+	return &GitHubTokenSource{
+		APIURL:         opts.GitHubAPIURL,
+		AppID:          opts.GitHubAppID,
+		InstallationID: opts.GitHubInstallationID,
+		PrivateKeyPath: opts.GitHubAppPrivateKey,
+		ExchangeURL:    opts.GitHubTokenExchangeURL,
+		OIDCTokenFile:  opts.GitHubOIDCTokenFile,
+		OIDCAudience:   opts.GitHubOIDCAudience,
+	}
+}
+
+// gitHubToken returns the token of the options' token source, or $GITHUB_TOKEN for callers that
+// don't set one
+func (opts VerificationOptions) gitHubToken(ctx context.Context) (string, error) {
+	if opts.GitHubTokens == nil {
+		return os.Getenv("GITHUB_TOKEN"), nil
+	}
+	return opts.GitHubTokens.Token(ctx)
+}
+
+func (s *GitHubTokenSource) Token(ctx context.Context) (string, error) {
+	if s.AppID == "" && s.ExchangeURL == "" {
+		return os.Getenv("GITHUB_TOKEN"), nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expiry) > gitHubTokenRefreshMargin {
+		return s.token, nil
+	}
+
+	var token string
+	var expiry time.Time
+	var err error
+	if s.AppID != "" {
+		token, expiry, err = s.installationToken(ctx)
+	} else {
+		token, expiry, err = s.exchangeToken(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expiry = token, expiry
+	return token, nil
+}
+
+// installationToken requests a token for the GitHub App installation, authenticating as the app
+// with a JWT signed by its private key
+func (s *GitHubTokenSource) installationToken(ctx context.Context) (string, time.Time, error) {
+	if s.InstallationID == "" || s.PrivateKeyPath == "" {
+		return "", time.Time{}, errors.New("--github-app-id requires --github-app-installation-id and --github-app-private-key")
+	}
+	pem, err := os.ReadFile(s.PrivateKeyPath)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	now := time.Now()
+	appJWT, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+		Issuer: s.AppID,
+		// GitHub allows for clock drift by accepting tokens issued up to a minute in the future
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	}).SignedString(key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	endpoint := fmt.Sprintf("%s/app/installations/%s/access_tokens", strings.TrimSuffix(s.APIURL, "/"), url.PathEscape(s.InstallationID))
+	token, expiry, err := requestGitHubToken(ctx, http.MethodPost, endpoint, appJWT)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create GitHub App installation token: %w", err)
+	}
+	return token, expiry, nil
+}
+
+// exchangeToken exchanges an OIDC token of the workload for a GitHub token at the token broker
+func (s *GitHubTokenSource) exchangeToken(ctx context.Context) (string, time.Time, error) {
+	audience := s.OIDCAudience
+	if audience == "" {
+		u, err := url.Parse(s.ExchangeURL)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("invalid --github-token-exchange-url: %w", err)
+		}
+		audience = u.Hostname()
+	}
+
+	var idToken string
+	requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	switch {
+	case s.OIDCTokenFile != "":
+		// projected tokens are rotated on disk, so the file is read again on every exchange
+		data, err := os.ReadFile(s.OIDCTokenFile)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to read OIDC token: %w", err)
+		}
+		idToken = strings.TrimSpace(string(data))
+	case requestURL != "" && requestToken != "":
+		var err error
+		if idToken, err = getGitHubActionsToken(ctx, requestURL, requestToken, audience); err != nil {
+			return "", time.Time{}, err
+		}
+	default:
+		return "", time.Time{}, errors.New("--github-token-exchange-url requires --github-oidc-token-file outside GitHub Actions")
+	}
+
+	token, expiry, err := requestGitHubToken(ctx, http.MethodGet, s.ExchangeURL, idToken)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to exchange OIDC token for a GitHub token: %w", err)
+	}
+	return token, expiry, nil
+}
+
+// requestGitHubToken requests a token from an endpoint answering {"token": ..., "expires_at": ...}
+func requestGitHubToken(ctx context.Context, method, endpoint, bearer string) (string, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	resp, err := newAPIClient().Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, newHTTPStatusError(resp, "%s returned", endpoint)
+	}
+
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode token: %w", err)
+	}
+	if body.Token == "" {
+		return "", time.Time{}, errors.New("no token in response")
+	}
+	if body.ExpiresAt.IsZero() {
+		body.ExpiresAt = time.Now().Add(defaultExchangedTokenLifetime)
+	}
+	return body.Token, body.ExpiresAt, nil
+}
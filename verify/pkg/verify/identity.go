@@ -0,0 +1,87 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/sigstore/sigstore/pkg/oauthflow"
+)
+
+const (
+	sigstoreAudience    = "sigstore"
+	defaultOIDCProvider = "https://oauth2.sigstore.dev/auth"
+	defaultOIDCClientID = "sigstore"
+)
+
+// getIdentityToken returns the OIDC token used for keyless signing: the explicit token if set,
+// then $SIGSTORE_ID_TOKEN, then a token requested from GitHub Actions when running in a job
+// with the id-token: write permission. Outside CI, the user logs in to the OIDC provider instead.
+func getIdentityToken(ctx context.Context, sopts SigningOptions) (string, error) {
+	if sopts.IdentityToken != "" {
+		return sopts.IdentityToken, nil
+	}
+	if token := os.Getenv("SIGSTORE_ID_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL != "" && requestToken != "" {
+		return getGitHubActionsToken(ctx, requestURL, requestToken, sigstoreAudience)
+	}
+	if os.Getenv("CI") == "true" {
+		return "", errors.New("no identity token available, pass --identity-token or run in GitHub Actions with id-token: write")
+	}
+	return loginIdentityToken(sopts)
+}
+
+// loginIdentityToken runs the OIDC login flow: in the browser, or with a device code to enter on
+// another machine when --oidc-device-flow is set
+func loginIdentityToken(sopts SigningOptions) (string, error) {
+	var getter oauthflow.TokenGetter = oauthflow.DefaultIDTokenGetter
+	if sopts.DeviceFlow {
+		getter = oauthflow.NewDeviceFlowTokenGetterForIssuer(sopts.OIDCProvider)
+	}
+	token, err := oauthflow.OIDConnect(sopts.OIDCProvider, sopts.OIDCClientID, "", "", getter)
+	if err != nil {
+		return "", fmt.Errorf("failed to log in to %s: %w", sopts.OIDCProvider, err)
+	}
+	return token.RawString, nil
+}
+
+// getGitHubActionsToken requests an identity token for the audience from GitHub Actions
+func getGitHubActionsToken(ctx context.Context, requestURL, requestToken, audience string) (string, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("audience", audience)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	resp, err := newAPIClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request GitHub Actions identity token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to request GitHub Actions identity token: %s", resp.Status)
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode GitHub Actions identity token: %w", err)
+	}
+	return body.Value, nil
+}
@@ -0,0 +1,138 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IdentityPattern is an entry of an identity allowlist or denylist. Issuer and subject are matched
+// exactly, or against a regular expression; fields left empty match any value.
+type IdentityPattern struct {
+	Issuer        string `yaml:"issuer"`
+	IssuerRegexp  string `yaml:"issuerRegexp"`
+	Subject       string `yaml:"subject"`
+	SubjectRegexp string `yaml:"subjectRegexp"`
+
+	issuerRegexp  *regexp.Regexp
+	subjectRegexp *regexp.Regexp
+}
+
+func (p IdentityPattern) String() string {
+	issuer, subject := p.Issuer, p.Subject
+	if p.IssuerRegexp != "" {
+		issuer = "/" + p.IssuerRegexp + "/"
+	}
+	if p.SubjectRegexp != "" {
+		subject = "/" + p.SubjectRegexp + "/"
+	}
+	return fmt.Sprintf("issuer=%s subject=%s", issuer, subject)
+}
+
+func (p IdentityPattern) matches(issuer, subject string) bool {
+	return matchesPattern(issuer, p.Issuer, p.issuerRegexp) && matchesPattern(subject, p.Subject, p.subjectRegexp)
+}
+
+func matchesPattern(value, exact string, re *regexp.Regexp) bool {
+	if exact != "" && value != exact {
+		return false
+	}
+	return re == nil || re.MatchString(value)
+}
+
+// IdentityList is a list of identity patterns loaded from a YAML file
+type IdentityList []IdentityPattern
+
+func loadIdentityList(path string) (IdentityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity list: %w", err)
+	}
+	var list IdentityList
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse identity list %s: %w", path, err)
+	}
+	if len(list) == 0 {
+		// an empty allowlist would otherwise replace the subject with no identity check at all
+		return nil, fmt.Errorf("identity list %s has no entries", path)
+	}
+	for i := range list {
+		p := &list[i]
+		if p.Issuer == "" && p.IssuerRegexp == "" && p.Subject == "" && p.SubjectRegexp == "" {
+			return nil, fmt.Errorf("entry %d of identity list %s matches every identity", i+1, path)
+		}
+		if p.IssuerRegexp != "" {
+			if p.issuerRegexp, err = regexp.Compile(p.IssuerRegexp); err != nil {
+				return nil, fmt.Errorf("invalid issuerRegexp in entry %d of identity list %s: %w", i+1, path, err)
+			}
+		}
+		if p.SubjectRegexp != "" {
+			if p.subjectRegexp, err = regexp.Compile(p.SubjectRegexp); err != nil {
+				return nil, fmt.Errorf("invalid subjectRegexp in entry %d of identity list %s: %w", i+1, path, err)
+			}
+		}
+	}
+	return list, nil
+}
+
+func (l IdentityList) match(issuer, subject string) (IdentityPattern, bool) {
+	for _, p := range l {
+		if p.matches(issuer, subject) {
+			return p, true
+		}
+	}
+	return IdentityPattern{}, false
+}
+
+// checkIdentityLists fails unless the signer of the bundle matches an allowlist entry and no
+// denylist entry. The allowlist is enforced whenever --identity-allowlist is set, so a list without
+// entries matches no signer.
+func checkIdentityLists(b *Bundle, opts VerificationOptions, allowlist, denylist IdentityList) error {
+	if opts.IdentityAllowlist == "" && opts.IdentityDenylist == "" {
+		return nil
+	}
+	signer, ok := signerSummary(b)
+	if !ok {
+		return errors.New("identity allowlist: bundle has no signing certificate")
+	}
+	issuer, subject := signer.Extensions.Issuer, signer.SubjectAlternativeName
+	if opts.IdentityAllowlist != "" {
+		if _, ok := allowlist.match(issuer, subject); !ok {
+			return fmt.Errorf("identity allowlist: issuer=%s subject=%s matches no entry", issuer, subject)
+		}
+	}
+	if p, ok := denylist.match(issuer, subject); ok {
+		return fmt.Errorf("identity denylist: issuer=%s subject=%s matches %s", issuer, subject, p)
+	}
+	return nil
+}
+
+// verifiedIdentities returns the distinct signing identities of the verified bundles, in the order
+// they were verified
+func verifiedIdentities(results []VerificationResult) []string {
+	var identities []string
+	for _, result := range results {
+		signer, ok := signerSummary(result.Bundle)
+		if !ok {
+			continue
+		}
+		identity := fmt.Sprintf("issuer=%s subject=%s", signer.Extensions.Issuer, signer.SubjectAlternativeName)
+		if !slices.Contains(identities, identity) {
+			identities = append(identities, identity)
+		}
+	}
+	return identities
+}
+
+// checkMinIdentities fails unless the verified bundles were signed by at least min distinct identities
+func checkMinIdentities(results []VerificationResult, min int) error {
+	if identities := verifiedIdentities(results); len(identities) < min {
+		return fmt.Errorf("attestations from %d distinct identities required, found %d: %s", min, len(identities), strings.Join(identities, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadIdentityList(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		entries  int
+		expected string
+	}{
+		{
+			name:    "exact and regexp",
+			content: "- issuer: https://token.actions.githubusercontent.com\n  subjectRegexp: ^https://github.com/nirmata/\n- subject: release@nirmata.com\n",
+			entries: 2,
+		},
+		{name: "empty", content: "", expected: "has no entries"},
+		{name: "empty list", content: "[]\n", expected: "has no entries"},
+		{name: "not a list", content: "issuer: https://token.actions.githubusercontent.com\n", expected: "failed to parse identity list"},
+		{name: "matches every identity", content: "- subject: release@nirmata.com\n- {}\n", expected: "entry 2 of identity list"},
+		{name: "invalid issuerRegexp", content: "- issuerRegexp: \"(\"\n", expected: "invalid issuerRegexp in entry 1"},
+		{name: "invalid subjectRegexp", content: "- issuer: https://accounts.google.com\n  subjectRegexp: \"[\"\n", expected: "invalid subjectRegexp in entry 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "identities.yaml")
+			if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			list, err := loadIdentityList(path)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			case len(list) != test.entries:
+				t.Fatalf("expected %d entries, got %d", test.entries, len(list))
+			}
+		})
+	}
+}
+
+func TestLoadIdentityListMissing(t *testing.T) {
+	if _, err := loadIdentityList(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read identity list") {
+		t.Fatalf("expected a read error, got %v", err)
+	}
+}
+
+func TestIdentityListMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.yaml")
+	content := "- issuer: https://token.actions.githubusercontent.com\n  subjectRegexp: ^https://github.com/nirmata/\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := loadIdentityList(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		issuer  string
+		subject string
+		matches bool
+	}{
+		{issuer: "https://token.actions.githubusercontent.com", subject: "https://github.com/nirmata/app/.github/workflows/release.yaml@refs/heads/main", matches: true},
+		{issuer: "https://token.actions.githubusercontent.com", subject: "https://github.com/other/app/.github/workflows/release.yaml@refs/heads/main"},
+		{issuer: "https://accounts.google.com", subject: "https://github.com/nirmata/app/.github/workflows/release.yaml@refs/heads/main"},
+	}
+	for _, test := range tests {
+		if _, ok := list.match(test.issuer, test.subject); ok != test.matches {
+			t.Errorf("issuer=%s subject=%s: expected matches=%v, got %v", test.issuer, test.subject, test.matches, ok)
+		}
+	}
+}
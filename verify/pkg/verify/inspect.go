@@ -0,0 +1,356 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/spf13/cobra"
+)
+
+// inspectedBundle is the JSON form of a sigstore bundle, decoded field by field rather than with the
+// protobuf parser, so that bundles the parser rejects can still be looked at
+type inspectedBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate *struct {
+			RawBytes base64Field `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes base64Field `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		PublicKey *struct {
+			Hint string `json:"hint"`
+		} `json:"publicKey"`
+		TlogEntries               []inspectedTlogEntry `json:"tlogEntries"`
+		TimestampVerificationData struct {
+			RFC3161Timestamps []struct {
+				SignedTimestamp base64Field `json:"signedTimestamp"`
+			} `json:"rfc3161Timestamps"`
+		} `json:"timestampVerificationData"`
+	} `json:"verificationMaterial"`
+	DSSEEnvelope     *inspectedDSSEEnvelope `json:"dsseEnvelope"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string      `json:"algorithm"`
+			Digest    base64Field `json:"digest"`
+		} `json:"messageDigest"`
+		Signature base64Field `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+type inspectedDSSEEnvelope struct {
+	Payload     base64Field `json:"payload"`
+	PayloadType string      `json:"payloadType"`
+	Signatures  []struct {
+		Sig   base64Field `json:"sig"`
+		KeyID string      `json:"keyid"`
+	} `json:"signatures"`
+}
+
+type inspectedTlogEntry struct {
+	LogIndex protoInt `json:"logIndex"`
+	LogID    struct {
+		KeyID base64Field `json:"keyId"`
+	} `json:"logId"`
+	KindVersion struct {
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+	} `json:"kindVersion"`
+	IntegratedTime   protoInt `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp base64Field `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex   protoInt      `json:"logIndex"`
+		RootHash   base64Field   `json:"rootHash"`
+		TreeSize   protoInt      `json:"treeSize"`
+		Hashes     []base64Field `json:"hashes"`
+		Checkpoint struct {
+			Envelope string `json:"envelope"`
+		} `json:"checkpoint"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody base64Field `json:"canonicalizedBody"`
+}
+
+// base64Field is a bytes field of the bundle, kept encoded so that an invalid value is reported
+// where it is rather than failing the whole bundle
+type base64Field string
+
+// decode accepts the standard and URL-safe alphabets, with or without padding, as protojson does
+func (f base64Field) decode() ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(string(f)); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64 %q", truncate(string(f), 40))
+}
+
+// protoInt is a 64-bit integer, which protojson writes as a string but other producers as a number
+type protoInt string
+
+func (i *protoInt) UnmarshalJSON(data []byte) error {
+	*i = protoInt(strings.Trim(string(data), `"`))
+	return nil
+}
+
+func newInspectBundleCommand() *cobra.Command {
+	fs := flag.NewFlagSet("inspect-bundle", flag.ContinueOnError)
+	bundlePath := fs.String("bundle-path", "", "bundle file, or directory of .json bundles, to inspect")
+	return newCommand(fs, commandDoc{
+		Use:   "inspect-bundle --bundle-path <path>",
+		Short: "Decode the payload, certificates and transparency log entries of bundles without verifying them",
+		Long: `Decode a sigstore bundle into readable text: its media type, the signing certificate and its Fulcio
+extensions, the transparency log entries and their bodies, the timestamps, and the DSSE payload or the
+message signature. Nothing is fetched and no policy is applied, so malformed bundles can be debugged
+offline. Problems found along the way, including why the verifier can't parse the bundle, are reported
+inline.`,
+		Example: "  inspect-bundle --bundle-path attestation.sigstore.json",
+	}, func(args []string) error {
+		if *bundlePath == "" {
+			return errors.New("--bundle-path is required")
+		}
+		files := []string{*bundlePath}
+		if info, err := os.Stat(*bundlePath); err != nil {
+			return err
+		} else if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(*bundlePath, "*.json")); err != nil {
+				return err
+			}
+		}
+		for i, file := range files {
+			if i > 0 {
+				fmt.Println()
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read bundle %s: %w", file, err)
+			}
+			if err := inspectBundle(os.Stdout, file, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inspectBundle prints the decoded bundle. It only fails when the file isn't JSON at all.
+func inspectBundle(w io.Writer, name string, data []byte) error {
+	var b inspectedBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("%s is not a JSON sigstore bundle: %w", name, err)
+	}
+	fmt.Fprintf(w, "bundle: %s\n", name)
+	version, _ := bundleMediaTypeVersion(b.MediaType)
+	fmt.Fprintf(w, "  media type: %s (version %s)\n", b.MediaType, valueOr(version, "unknown"))
+	if _, err := parseBundle(data); err != nil {
+		fmt.Fprintf(w, "  parse: %v\n", err)
+	} else {
+		fmt.Fprintln(w, "  parse: ok")
+	}
+
+	material := b.VerificationMaterial
+	switch {
+	case material.Certificate != nil:
+		inspectCertificate(w, "certificate", material.Certificate.RawBytes)
+	case material.X509CertificateChain != nil:
+		for i, cert := range material.X509CertificateChain.Certificates {
+			inspectCertificate(w, fmt.Sprintf("certificate [%d]", i), cert.RawBytes)
+		}
+	case material.PublicKey != nil:
+		fmt.Fprintf(w, "public key hint: %s\n", material.PublicKey.Hint)
+	default:
+		fmt.Fprintln(w, "verification material: none")
+	}
+
+	for i, entry := range material.TlogEntries {
+		inspectTlogEntry(w, i, entry)
+	}
+	for i, timestamp := range material.TimestampVerificationData.RFC3161Timestamps {
+		signed, err := timestamp.SignedTimestamp.decode()
+		if err != nil {
+			fmt.Fprintf(w, "rfc3161 timestamp [%d]: %v\n", i, err)
+			continue
+		}
+		fmt.Fprintf(w, "rfc3161 timestamp [%d]: %d bytes\n", i, len(signed))
+	}
+
+	switch {
+	case b.DSSEEnvelope != nil:
+		inspectDSSEEnvelope(w, b.DSSEEnvelope)
+	case b.MessageSignature != nil:
+		fmt.Fprintln(w, "message signature:")
+		digest, err := b.MessageSignature.MessageDigest.Digest.decode()
+		if err != nil {
+			fmt.Fprintf(w, "  digest: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "  digest: %s:%s\n", b.MessageSignature.MessageDigest.Algorithm, hex.EncodeToString(digest))
+		}
+		if sig, err := b.MessageSignature.Signature.decode(); err != nil {
+			fmt.Fprintf(w, "  signature: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "  signature: %d bytes\n", len(sig))
+		}
+	default:
+		fmt.Fprintln(w, "content: neither a DSSE envelope nor a message signature")
+	}
+	return nil
+}
+
+func inspectCertificate(w io.Writer, label string, raw base64Field) {
+	der, err := raw.decode()
+	if err != nil {
+		fmt.Fprintf(w, "%s: %v\n", label, err)
+		return
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		fmt.Fprintf(w, "%s: invalid certificate: %v\n", label, err)
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", label)
+	fmt.Fprintf(w, "  subject:    %s\n", cert.Subject)
+	fmt.Fprintf(w, "  issuer:     %s\n", cert.Issuer)
+	fmt.Fprintf(w, "  serial:     %s\n", cert.SerialNumber)
+	fmt.Fprintf(w, "  not before: %s\n", cert.NotBefore.UTC())
+	fmt.Fprintf(w, "  not after:  %s\n", cert.NotAfter.UTC())
+	fmt.Fprintf(w, "  key:        %s\n", cert.PublicKeyAlgorithm)
+	summary, err := certificate.SummarizeCertificate(cert)
+	if err != nil {
+		return
+	}
+	if summary.SubjectAlternativeName != "" {
+		fmt.Fprintf(w, "  san:        %s\n", summary.SubjectAlternativeName)
+	}
+	extensions, err := json.Marshal(summary.Extensions)
+	if err != nil {
+		return
+	}
+	var fields map[string]string
+	if json.Unmarshal(extensions, &fields) != nil {
+		return
+	}
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		if fields[key] != "" {
+			fmt.Fprintf(w, "  %s: %s\n", key, fields[key])
+		}
+	}
+}
+
+func inspectTlogEntry(w io.Writer, index int, entry inspectedTlogEntry) {
+	fmt.Fprintf(w, "tlog entry [%d]:\n", index)
+	fmt.Fprintf(w, "  log index:       %s\n", valueOr(string(entry.LogIndex), "-"))
+	if keyID, err := entry.LogID.KeyID.decode(); err != nil {
+		fmt.Fprintf(w, "  log id:          %v\n", err)
+	} else {
+		fmt.Fprintf(w, "  log id:          %s\n", hex.EncodeToString(keyID))
+	}
+	fmt.Fprintf(w, "  kind:            %s %s\n", entry.KindVersion.Kind, entry.KindVersion.Version)
+	if seconds, err := strconv.ParseInt(string(entry.IntegratedTime), 10, 64); err == nil && seconds > 0 {
+		fmt.Fprintf(w, "  integrated time: %s\n", time.Unix(seconds, 0).UTC().Format(time.RFC3339))
+	} else {
+		// entries of the tile-backed Rekor v2 log have no integrated time
+		fmt.Fprintln(w, "  integrated time: -")
+	}
+	fmt.Fprintf(w, "  inclusion promise: %t\n", entry.InclusionPromise != nil)
+	if proof := entry.InclusionProof; proof != nil {
+		rootHash, _ := proof.RootHash.decode()
+		fmt.Fprintf(w, "  inclusion proof: tree size %s, root hash %s, %d hashes\n", proof.TreeSize, hex.EncodeToString(rootHash), len(proof.Hashes))
+		if proof.Checkpoint.Envelope != "" {
+			fmt.Fprintf(w, "  checkpoint:\n%s\n", indentLines(strings.TrimSpace(proof.Checkpoint.Envelope), "    "))
+		}
+	} else {
+		fmt.Fprintln(w, "  inclusion proof: none")
+	}
+	body, err := entry.CanonicalizedBody.decode()
+	if err != nil {
+		fmt.Fprintf(w, "  body: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "  body:\n%s\n", indentLines(prettyJSON(body), "    "))
+}
+
+func inspectDSSEEnvelope(w io.Writer, envelope *inspectedDSSEEnvelope) {
+	fmt.Fprintln(w, "dsse envelope:")
+	payloadType := envelope.PayloadType
+	fmt.Fprintf(w, "  payload type: %s\n", payloadType)
+	for i, signature := range envelope.Signatures {
+		sig, err := signature.Sig.decode()
+		if err != nil {
+			fmt.Fprintf(w, "  signature [%d]: %v\n", i, err)
+			continue
+		}
+		fmt.Fprintf(w, "  signature [%d]: %d bytes, keyid %q\n", i, len(sig), signature.KeyID)
+	}
+	payload, err := envelope.Payload.decode()
+	if err != nil {
+		fmt.Fprintf(w, "  payload: %v\n", err)
+		return
+	}
+	if payloadType == inTotoPayloadType {
+		var statement struct {
+			Type          string `json:"_type"`
+			PredicateType string `json:"predicateType"`
+			Subject       []struct {
+				Name   string            `json:"name"`
+				Digest map[string]string `json:"digest"`
+			} `json:"subject"`
+		}
+		if err := json.Unmarshal(payload, &statement); err != nil {
+			fmt.Fprintf(w, "  statement: invalid: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "  statement type: %s\n", statement.Type)
+			fmt.Fprintf(w, "  predicate type: %s\n", statement.PredicateType)
+			for _, subject := range statement.Subject {
+				for _, algorithm := range slices.Sorted(maps.Keys(subject.Digest)) {
+					fmt.Fprintf(w, "  subject: %s %s:%s\n", valueOr(subject.Name, "-"), algorithm, subject.Digest[algorithm])
+				}
+			}
+		}
+	}
+	fmt.Fprintf(w, "  payload:\n%s\n", indentLines(prettyJSON(payload), "    "))
+}
+
+// prettyJSON indents JSON, and returns other data as is
+func prettyJSON(data []byte) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return out.String()
+}
+
+func indentLines(text, indent string) string {
+	return indent + strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	return value[:n] + "..."
+}
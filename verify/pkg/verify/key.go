@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/kms"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/aws"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/azure"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/gcp"
+	_ "github.com/sigstore/sigstore/pkg/signature/kms/hashivault"
+)
+
+// loadKey returns the verifier of --key: a PEM public key file, such as cosign.pub, or a KMS key
+// URI (awskms://, gcpkms://, azurekms:// or hashivault://)
+func loadKey(ctx context.Context, key string) (signature.Verifier, error) {
+	for _, provider := range kms.SupportedProviders() {
+		if strings.HasPrefix(key, provider) {
+			verifier, err := kms.Get(ctx, key, crypto.SHA256)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load KMS key %s: %w", key, err)
+			}
+			return verifier, nil
+		}
+	}
+
+	pem, err := os.ReadFile(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(pem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", key, err)
+	}
+	return signature.LoadVerifier(publicKey, crypto.SHA256)
+}
+
+// keyTrustedMaterial adds the --key to the trusted root. The key is trusted for bundles with any
+// key hint, since cosign doesn't record one, and at any time.
+func keyTrustedMaterial(ctx context.Context, trustedRoot *root.TrustedRoot, opts VerificationOptions) (root.TrustedMaterial, error) {
+	if opts.Key == "" {
+		return trustedRoot, nil
+	}
+	verifier, err := loadKey(ctx, opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := verifier.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignatureAlgorithm(publicKey, opts.allowedSignatureAlgorithms()); err != nil {
+		return nil, fmt.Errorf("--key: %w", err)
+	}
+	key := root.NewExpiringKey(verifier, time.Time{}, time.Time{})
+	keyMaterial := root.NewTrustedPublicKeyMaterial(func(string) (root.TimeConstrainedVerifier, error) {
+		return key, nil
+	})
+	return root.TrustedMaterialCollection{trustedRoot, keyMaterial}, nil
+}
+
+// checkKeySigned refuses keyless bundles when verifying with --key, since the policy then has no
+// certificate identity to check them against
+func checkKeySigned(bundle *Bundle, opts VerificationOptions) error {
+	if opts.Key == "" {
+		return nil
+	}
+	content, err := bundle.ProtoBundle.VerificationContent()
+	if err != nil {
+		return err
+	}
+	if content.Certificate() != nil {
+		return fmt.Errorf("bundle is signed with a certificate, not with --key")
+	}
+	return nil
+}
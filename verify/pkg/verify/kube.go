@@ -0,0 +1,195 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient is a minimal client of the Kubernetes API for the few resources the server mode reads
+// and writes, authenticated with the pod's service account
+type kubeClient struct {
+	host      string
+	tokenPath string
+	client    *http.Client
+}
+
+// newInClusterClient connects to the API server of the cluster the process runs in
+func newInClusterClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	caPEM, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no certificate found in the cluster CA")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &kubeClient{
+		host:      "https://" + net.JoinHostPort(host, port),
+		tokenPath: filepath.Join(serviceAccountDir, "token"),
+		client:    &http.Client{Transport: transport},
+	}, nil
+}
+
+// inClusterNamespace is the namespace of the pod
+func inClusterNamespace() (string, error) {
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the pod namespace: %w", err)
+	}
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// do sends body as JSON and decodes the response into out, when not nil. Failures are
+// HTTPStatusErrors, see isKubeNotFound and isKubeConflict.
+func (c *kubeClient) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	resp, err := c.send(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends the request, returning the response of successful requests for the caller to close
+func (c *kubeClient) send(ctx context.Context, method, path, contentType string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	// bound service account tokens are rotated, so the token is read for every request
+	token, err := os.ReadFile(c.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, newHTTPStatusError(resp, "%s %s", method, path)
+	}
+	return resp, nil
+}
+
+// kubeWatchEvent is an event of a watch: ADDED, MODIFIED, DELETED, BOOKMARK or ERROR
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watch streams the changes of the collection at path since resourceVersion to handle, until the
+// API server closes the watch, ctx is done or handle fails
+func (c *kubeClient) watch(ctx context.Context, path, resourceVersion string, handle func(kubeWatchEvent) error) error {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	resp, err := c.send(ctx, http.MethodGet, path+separator+"watch=true&allowWatchBookmarks=true&resourceVersion="+url.QueryEscape(resourceVersion), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event kubeWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if event.Type == "ERROR" {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			return &HTTPStatusError{Message: "watch " + path + ": " + status.Message, Status: http.StatusText(status.Code), StatusCode: status.Code}
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *kubeClient) get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+func (c *kubeClient) create(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, http.MethodPost, path, "application/json", body, out)
+}
+
+func (c *kubeClient) update(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, http.MethodPut, path, "application/json", body, out)
+}
+
+func (c *kubeClient) patch(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", body, out)
+}
+
+func isKubeNotFound(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+func isKubeConflict(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict
+}
+
+// parseNamespacedName parses namespace/name, defaulting the namespace to the pod's
+func parseNamespacedName(value string) (string, string, error) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok {
+		name = namespace
+		var err error
+		if namespace, err = inClusterNamespace(); err != nil {
+			return "", "", err
+		}
+	}
+	if namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid %q, expected namespace/name", value)
+	}
+	return namespace, name, nil
+}
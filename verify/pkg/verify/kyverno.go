@@ -0,0 +1,92 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// KyvernoReport mirrors the results of Kyverno's verifyImages rules. VerifyImages has the shape of
+// the kyverno.io/verify-images annotation Kyverno adds to admitted resources, mapping each image
+// pinned by digest to pass or fail, or to warn or skip for images admitted unverified by --on-error.
+type KyvernoReport struct {
+	VerifyImages map[string]string    `json:"verifyImages"`
+	Results      []KyvernoImageResult `json:"results"`
+}
+
+// KyvernoImageResult is the verification result of a single image
+type KyvernoImageResult struct {
+	Image string `json:"image"`
+	// Reference is the fully qualified image reference, e.g. index.docker.io/library/nginx:1.25
+	Reference string `json:"reference,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+	// PinnedReference is the image pinned to the verified digest
+	PinnedReference string               `json:"pinnedReference,omitempty"`
+	Status          string               `json:"status"`
+	Message         string               `json:"message,omitempty"`
+	Attestations    []KyvernoAttestation `json:"attestations,omitempty"`
+}
+
+// KyvernoAttestation is a verified attestation, with the identity that matched the keyless attestor
+// and the predicate that Kyverno evaluates attestation conditions against
+type KyvernoAttestation struct {
+	Type      string `json:"type"`
+	Issuer    string `json:"issuer,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Predicate any    `json:"predicate,omitempty"`
+	// Annotations are added by the --predicate-plugin of the attestation
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func newKyvernoImageResult(outcome ImageResult) KyvernoImageResult {
+	image, results, err := outcome.Image, outcome.Results, outcome.Err
+	reference := normalizeImage(image)
+	switch {
+	case err != nil:
+		return KyvernoImageResult{Image: image, Reference: reference, Status: "fail", Message: err.Error()}
+	case outcome.Warning != nil:
+		return KyvernoImageResult{Image: image, Reference: reference, Status: "warn", Message: outcome.Warning.Error()}
+	case outcome.Skipped != nil:
+		return KyvernoImageResult{Image: image, Reference: reference, Status: "skip", Message: outcome.Skipped.Error()}
+	}
+	result := KyvernoImageResult{
+		Image:           image,
+		Reference:       reference,
+		Digest:          results[0].Desc.Digest.String(),
+		PinnedReference: pinnedReference(image, results[0].Desc),
+		Status:          "pass",
+	}
+	for _, r := range results {
+		attestation := KyvernoAttestation{Type: r.Bundle.PayloadType, Annotations: r.Annotations}
+		if statement := r.Bundle.DSSE_Envelope; statement != nil {
+			attestation.Type = statement.PredicateType
+			attestation.Predicate = statement.Predicate
+		} else if r.Bundle.Payload != nil {
+			attestation.Predicate = json.RawMessage(r.Bundle.Payload)
+		}
+		if signer, ok := signerSummary(r.Bundle); ok {
+			attestation.Issuer, attestation.Subject = signer.Extensions.Issuer, signer.SubjectAlternativeName
+		}
+		result.Attestations = append(result.Attestations, attestation)
+	}
+	return result
+}
+
+func writeKyvernoReport(w io.Writer, outcomes []ImageResult) error {
+	report := KyvernoReport{VerifyImages: map[string]string{}}
+	for _, outcome := range outcomes {
+		result := newKyvernoImageResult(outcome)
+		report.Results = append(report.Results, result)
+		key := result.Image
+		if result.PinnedReference != "" {
+			key = result.PinnedReference
+		}
+		report.VerifyImages[key] = result.Status
+	}
+	val, err := json.MarshalIndent(report, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(val))
+	return err
+}
@@ -0,0 +1,154 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// leaseDuration is how long a leader holds the lease without renewing it, and leaseRenewInterval
+	// how often the leader renews it and the other replicas try to acquire it
+	leaseDuration      = 30 * time.Second
+	leaseRenewInterval = 10 * time.Second
+
+	// microTimeFormat is the format of the metav1.MicroTime fields of a Lease
+	microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// kubeLease is the subset of a coordination.k8s.io/v1 Lease used for leader election
+type kubeLease struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   kubeObjectMeta `json:"metadata"`
+	Spec       kubeLeaseSpec  `json:"spec"`
+}
+
+type kubeLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+func leasePath(namespace, name string) string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", namespace, name)
+}
+
+// leaderElector holds a Lease while it can, so that only one replica runs the cluster-wide tasks
+type leaderElector struct {
+	client    *kubeClient
+	namespace string
+	name      string
+	identity  string
+	leader    atomic.Bool
+}
+
+// newLeaderElector elects a leader among the replicas through the namespace/name lease. The
+// identity of a replica is its pod name.
+func newLeaderElector(client *kubeClient, lease string) (*leaderElector, error) {
+	namespace, name, err := parseNamespacedName(lease)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the pod name: %w", err)
+	}
+	return &leaderElector{client: client, namespace: namespace, name: name, identity: identity}, nil
+}
+
+// IsLeader reports whether this replica held the lease when it last tried to acquire or renew it
+func (e *leaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// run acquires or renews the lease every leaseRenewInterval until ctx is done. Leadership is lost
+// when the lease can't be renewed, so that two replicas never act as the leader for long.
+func (e *leaderElector) run(ctx context.Context) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		leader, err := e.tryAcquire(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "failed to acquire lease %s/%s: %v\n", e.namespace, e.name, err)
+		}
+		if leader != e.leader.Swap(leader) {
+			if leader {
+				fmt.Fprintf(os.Stderr, "%s became the leader\n", e.identity)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s is no longer the leader\n", e.identity)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			e.leader.Store(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquire creates the lease, renews it when held by this replica, or takes it over when its
+// holder let it expire
+func (e *leaderElector) tryAcquire(ctx context.Context, now time.Time) (bool, error) {
+	var lease kubeLease
+	err := e.client.get(ctx, leasePath(e.namespace, e.name), &lease)
+	if isKubeNotFound(err) {
+		lease = kubeLease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   kubeObjectMeta{Name: e.name, Namespace: e.namespace},
+			Spec: kubeLeaseSpec{
+				HolderIdentity:       e.identity,
+				LeaseDurationSeconds: int(leaseDuration.Seconds()),
+				AcquireTime:          now.UTC().Format(microTimeFormat),
+				RenewTime:            now.UTC().Format(microTimeFormat),
+			},
+		}
+		err = e.client.create(ctx, fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", e.namespace), lease, nil)
+		if isKubeConflict(err) {
+			// another replica created it first
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if lease.Spec.HolderIdentity != e.identity {
+		if !leaseExpired(lease.Spec, now) {
+			return false, nil
+		}
+		lease.Spec.HolderIdentity = e.identity
+		lease.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = int(leaseDuration.Seconds())
+	lease.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+	// the resource version makes the update fail if another replica renewed or took the lease meanwhile
+	err = e.client.update(ctx, leasePath(e.namespace, e.name), lease, nil)
+	if isKubeConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func leaseExpired(spec kubeLeaseSpec, now time.Time) bool {
+	if spec.HolderIdentity == "" {
+		return true
+	}
+	renewed, err := time.Parse(time.RFC3339Nano, spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	duration := time.Duration(spec.LeaseDurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = leaseDuration
+	}
+	return now.After(renewed.Add(duration))
+}
@@ -0,0 +1,43 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// listAttestations prints the artifact type, predicate type, signer and transparency log index of
+// each bundle without verifying it, to help pick the --subject and --issuer values of a policy
+func listAttestations(w io.Writer, bundles []*Bundle, predicateTypes []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARTIFACT TYPE\tPREDICATE TYPE\tISSUER\tSUBJECT\tTLOG INDEX")
+	for _, b := range bundles {
+		if !matchesPredicateType(b, predicateTypes) {
+			continue
+		}
+
+		artifactType := b.ArtifactType
+		if artifactType == "" {
+			artifactType = b.ProtoBundle.Bundle.MediaType
+		}
+		predicate := "-"
+		if b.ParseErr != nil {
+			predicate = b.ParseErr.Error()
+		} else if b.DSSE_Envelope != nil {
+			predicate = b.DSSE_Envelope.PredicateType
+		} else if b.PayloadType != "" {
+			predicate = b.PayloadType
+		}
+		issuer, subject := "-", "-"
+		if signer, ok := signerSummary(b); ok {
+			issuer, subject = signer.Extensions.Issuer, signer.SubjectAlternativeName
+		}
+		tlogIndex := "-"
+		if entries := b.ProtoBundle.Bundle.GetVerificationMaterial().GetTlogEntries(); len(entries) > 0 {
+			tlogIndex = fmt.Sprint(entries[0].LogIndex)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", artifactType, predicate, issuer, subject, tlogIndex)
+	}
+	return tw.Flush()
+}
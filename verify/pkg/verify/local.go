@@ -0,0 +1,179 @@
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+const (
+	ociLayoutPrefix     = "oci-layout:"
+	dockerArchivePrefix = "docker-archive:"
+	// maxArchiveManifestSize bounds the index and manifest read from a docker archive
+	maxArchiveManifestSize = 4 << 20
+)
+
+func isLocalImage(image string) bool {
+	return strings.HasPrefix(image, ociLayoutPrefix) || strings.HasPrefix(image, dockerArchivePrefix)
+}
+
+// resolveLocalDescriptor computes the descriptor of an image stored on disk, with the digest of its
+// manifest in the algorithm. The image may select a manifest with <path>@<digest> when the index
+// holds more than one.
+func resolveLocalDescriptor(image, algorithm string) (*v1.Descriptor, error) {
+	switch {
+	case strings.HasPrefix(image, ociLayoutPrefix):
+		path, digest, _ := strings.Cut(strings.TrimPrefix(image, ociLayoutPrefix), "@")
+		return resolveOCILayout(path, digest, algorithm)
+	case strings.HasPrefix(image, dockerArchivePrefix):
+		path, digest, _ := strings.Cut(strings.TrimPrefix(image, dockerArchivePrefix), "@")
+		return resolveDockerArchive(path, digest, algorithm)
+	default:
+		return nil, fmt.Errorf("unsupported local image %s", image)
+	}
+}
+
+func resolveOCILayout(path, digest, algorithm string) (*v1.Descriptor, error) {
+	idx, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oci layout %s: %w", path, err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oci layout index %s: %w", path, err)
+	}
+	desc, err := selectManifest(manifest.Manifests, digest, "oci layout "+path)
+	if err != nil {
+		return nil, err
+	}
+	return withDigestAlgorithm(desc, algorithm, func() ([]byte, error) {
+		return layout.Path(path).Bytes(desc.Digest)
+	})
+}
+
+// resolveDockerArchive reads the manifest of a docker save archive from the OCI layout Docker 25
+// and later embed in it. Older archives only hold the image config and the layers, from which the
+// manifest the registry served, and the attestations are bound to, can't be rebuilt.
+func resolveDockerArchive(path, digest, algorithm string) (*v1.Descriptor, error) {
+	indexBytes, err := readArchiveFile(path, "index.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("docker archive %s has no index.json: only archives saved by Docker 25 or later record the manifest the attestations are bound to, save the image as an OCI layout instead", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	index, err := v1.ParseIndexManifest(bytes.NewReader(indexBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker archive index %s: %w", path, err)
+	}
+	desc, err := selectManifest(index.Manifests, digest, "docker archive "+path)
+	if err != nil {
+		return nil, err
+	}
+	return withDigestAlgorithm(desc, algorithm, func() ([]byte, error) {
+		return readArchiveFile(path, "blobs/"+desc.Digest.Algorithm+"/"+desc.Digest.Hex)
+	})
+}
+
+// selectManifest returns the manifest of the index with the digest, or its only manifest
+func selectManifest(manifests []v1.Descriptor, digest, source string) (v1.Descriptor, error) {
+	if digest != "" {
+		for _, desc := range manifests {
+			if desc.Digest.String() == digest {
+				return desc, nil
+			}
+		}
+		return v1.Descriptor{}, fmt.Errorf("digest %s not found in %s", digest, source)
+	}
+	if len(manifests) != 1 {
+		return v1.Descriptor{}, fmt.Errorf("%s contains %d manifests, select one with <path>@<digest>", source, len(manifests))
+	}
+	return manifests[0], nil
+}
+
+// withDigestAlgorithm returns the descriptor with its digest in the algorithm. Layouts address the
+// manifests by their sha256 digest, so other algorithms hash the manifest, once checked against it.
+func withDigestAlgorithm(desc v1.Descriptor, algorithm string, manifest func() ([]byte, error)) (*v1.Descriptor, error) {
+	if desc.Digest.Algorithm == algorithm {
+		return &desc, nil
+	}
+	content, err := manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", desc.Digest, err)
+	}
+	if stored, err := computeDigest(desc.Digest.Algorithm, content); err != nil {
+		return nil, err
+	} else if stored != desc.Digest {
+		return nil, fmt.Errorf("manifest %s does not match its digest", desc.Digest)
+	}
+	if desc.Digest, err = computeDigest(algorithm, content); err != nil {
+		return nil, err
+	}
+	return &desc, nil
+}
+
+// readArchiveFile reads a small file of a tar archive, skipping over the layers
+func readArchiveFile(archive, name string) ([]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s: %w", name, archive, fs.ErrNotExist)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read docker archive %s: %w", archive, err)
+		}
+		if path.Clean(hdr.Name) != name {
+			continue
+		}
+		if hdr.Size > maxArchiveManifestSize {
+			return nil, fmt.Errorf("%s of %s is larger than %d bytes", name, archive, maxArchiveManifestSize)
+		}
+		return io.ReadAll(tr)
+	}
+}
+
+// loadBundles reads a single bundle file, or every .json file in a directory
+func loadBundles(path string) ([]*Bundle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bundles := make([]*Bundle, 0, len(files))
+	for _, file := range files {
+		bundleBytes, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle %s: %w", file, err)
+		}
+		b, err := parseBundle(bundleBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles, nil
+}
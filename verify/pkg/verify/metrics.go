@@ -0,0 +1,62 @@
+package verify
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the histogram of review latencies
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// webhookMetrics counts the admission reviews of the webhook, served in the Prometheus text format
+type webhookMetrics struct {
+	reviews  atomic.Int64
+	denied   atomic.Int64
+	warned   atomic.Int64
+	timeouts atomic.Int64
+
+	// latency of the reviews verifying images, per bucket of latencyBuckets plus an unbounded one
+	latency         [11]atomic.Int64
+	latencyMicros   atomic.Int64
+	latencyObserved atomic.Int64
+}
+
+// observeLatency records the time a review took to verify its images
+func (m *webhookMetrics) observeLatency(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	m.latency[i].Add(1)
+	m.latencyMicros.Add(d.Microseconds())
+	m.latencyObserved.Add(1)
+}
+
+func (m *webhookMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, counter := range []struct {
+		name, help string
+		value      *atomic.Int64
+	}{
+		{"verify_admission_reviews_total", "Admission requests reviewed.", &m.reviews},
+		{"verify_admission_denied_total", "Admission requests denied.", &m.denied},
+		{"verify_admission_warned_total", "Admission requests admitted with warnings.", &m.warned},
+		{"verify_admission_verification_timeouts_total", "Images whose verification didn't finish within the request budget.", &m.timeouts},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", counter.name, counter.help, counter.name, counter.name, counter.value.Load())
+	}
+
+	const histogram = "verify_admission_review_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time taken to verify the images of an admission request.\n# TYPE %s histogram\n", histogram, histogram)
+	var cumulative int64
+	for i, bound := range latencyBuckets {
+		cumulative += m.latency[i].Load()
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", histogram, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	cumulative += m.latency[len(latencyBuckets)].Load()
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", histogram, cumulative)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", histogram, float64(m.latencyMicros.Load())/1e6, histogram, m.latencyObserved.Load())
+}
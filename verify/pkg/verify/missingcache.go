@@ -0,0 +1,65 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// missingAttestations remembers the digests no bundle source returned any bundle for, so that the
+// unattested third-party images of a cluster don't query the referrers API again on every pod
+// restart. Only serve sets a TTL; other commands always look the bundles up.
+var missingAttestations = &missingAttestationCache{expires: map[string]time.Time{}}
+
+type missingAttestationCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// missingAttestationsKey identifies a digest, the repository it was looked up in and the sources,
+// since the same digest pushed to another repository, or looked up by another policy in other
+// sources, may have attestations
+func missingAttestationsKey(ref name.Reference, desc *v1.Descriptor, opts VerificationOptions) string {
+	key := []string{ref.Context().Name(), desc.Digest.String(), opts.Sources.String(), opts.ArtifactTypes.String(), opts.ReferrerAnnotations.String()}
+	if opts.GitHubRepo != "" {
+		key = append(key, opts.GitHubRepo)
+	}
+	if opts.EnableRekorSearch {
+		key = append(key, opts.RekorURL)
+	}
+	return strings.Join(key, "\x00")
+}
+
+// check fails while the digest is cached as having no attestations
+func (c *missingAttestationCache) check(image string, ref name.Reference, desc *v1.Descriptor, opts VerificationOptions) error {
+	if opts.MissingAttestationsTTL <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	expires, ok := c.expires[missingAttestationsKey(ref, desc, opts)]
+	c.mu.Unlock()
+	if !ok || time.Now().After(expires) {
+		return nil
+	}
+	return fmt.Errorf("no attestations found for %s (cached until %s)", image, expires.UTC().Format(time.RFC3339))
+}
+
+// add caches the digest as having no attestations for --missing-attestations-ttl
+func (c *missingAttestationCache) add(ref name.Reference, desc *v1.Descriptor, opts VerificationOptions) {
+	if opts.MissingAttestationsTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, expires := range c.expires {
+		if now.After(expires) {
+			delete(c.expires, key)
+		}
+	}
+	c.expires[missingAttestationsKey(ref, desc, opts)] = now.Add(opts.MissingAttestationsTTL)
+}
@@ -0,0 +1,74 @@
+package verify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// VerifyImages verifies images concurrently for callers embedding the verifier. The trusted root is
+// fetched once and, like the TUF client, shared by every image. Requests go through
+// http.DefaultTransport and remote.DefaultTransport, which the caller configures. The error is only
+// set when FIPS mode is unavailable, or the trusted root or the lockfile can't be read; verification
+// failures are reported per image.
+func VerifyImages(ctx context.Context, images []string, opts VerificationOptions) (map[string]ImageResult, error) {
+	if err := checkFIPS(opts); err != nil {
+		return nil, err
+	}
+	if err := loadPins(&opts); err != nil {
+		return nil, err
+	}
+	outcomes, err := verifyAll(ctx, images, opts)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]ImageResult, len(images))
+	for _, result := range outcomes {
+		results[result.Image] = result
+	}
+	return results, nil
+}
+
+// verifyAll fetches the trusted root, then verifies the images. When the trusted root can't be
+// fetched and --on-error tolerates it, every image is admitted unverified.
+func verifyAll(ctx context.Context, images []string, opts VerificationOptions) ([]ImageResult, error) {
+	trustedMaterial, err := getTrustedRoot(ctx, opts)
+	if err != nil {
+		outcomes := make([]ImageResult, 0, len(images))
+		for _, image := range images {
+			outcome := tolerateInfrastructureError(ImageResult{Image: image, Err: err}, opts)
+			if outcome.Err != nil {
+				return nil, err
+			}
+			outcomes = append(outcomes, outcome)
+		}
+		return outcomes, nil
+	}
+	return verifyImagesConcurrently(ctx, images, opts, trustedMaterial), nil
+}
+
+// verifyImagesConcurrently verifies images with at most --concurrency in flight, returning the
+// results in the order of images
+func verifyImagesConcurrently(ctx context.Context, images []string, opts VerificationOptions, trustedMaterial *root.TrustedRoot) []ImageResult {
+	concurrency := 1
+	if opts.Concurrency > 1 {
+		concurrency = opts.Concurrency
+	}
+
+	results := make([]ImageResult, len(images))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			verified, err := verifyImage(ctx, image, opts, trustedMaterial)
+			results[i] = tolerateInfrastructureError(ImageResult{Image: image, Results: verified, Err: err}, opts)
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,496 @@
+package verify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	notationSignatureArtifactType = "application/vnd.cncf.notary.signature"
+	notationJWSMediaType          = "application/jose+json"
+	notationCOSEMediaType         = "application/cose"
+	notationPayloadContentType    = "application/vnd.cncf.notary.payload.v1+json"
+	notationSigningScheme         = "io.cncf.notary.signingScheme"
+	notationExpiry                = "io.cncf.notary.expiry"
+
+	// maxNotationSignatureSize bounds the signature envelopes downloaded from the registry
+	maxNotationSignatureSize = 1 << 20
+)
+
+var notationLevels = []string{"strict", "permissive", "audit", "skip"}
+
+// NotationTrustPolicyDocument is a Notation trust policy, the trustpolicy.json of the notation CLI
+type NotationTrustPolicyDocument struct {
+	Version       string                `json:"version"`
+	TrustPolicies []NotationTrustPolicy `json:"trustPolicies"`
+}
+
+// NotationTrustPolicy says which trust stores and identities the signatures of the repositories of
+// its registry scopes must come from
+type NotationTrustPolicy struct {
+	Name string `json:"name"`
+	// RegistryScopes are repositories, e.g. registry.example.com/app, or * for every repository
+	RegistryScopes        []string `json:"registryScopes"`
+	SignatureVerification struct {
+		// Level is strict, permissive, audit (failures are only logged) or skip
+		Level string `json:"level"`
+	} `json:"signatureVerification"`
+	// TrustStores are the CA trust stores of the signing certificates, as ca:<name>
+	TrustStores []string `json:"trustStores"`
+	// TrustedIdentities are the subjects of the signing certificates, as x509.subject: <DN>, or *
+	TrustedIdentities []string `json:"trustedIdentities"`
+}
+
+// loadNotationTrustPolicy reads and validates the --notation-trust-policy
+func loadNotationTrustPolicy(path string) (*NotationTrustPolicyDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Notation trust policy: %w", err)
+	}
+	var doc NotationTrustPolicyDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse Notation trust policy %s: %w", path, err)
+	}
+	if doc.Version != "1.0" {
+		return nil, fmt.Errorf("unsupported Notation trust policy version %q, expected 1.0", doc.Version)
+	}
+	scopes := map[string]string{}
+	for _, policy := range doc.TrustPolicies {
+		if !slices.Contains(notationLevels, policy.SignatureVerification.Level) {
+			return nil, fmt.Errorf("trust policy %s: invalid signature verification level %q, expected one of %s", policy.Name, policy.SignatureVerification.Level, strings.Join(notationLevels, ", "))
+		}
+		for _, scope := range policy.RegistryScopes {
+			if other, ok := scopes[scope]; ok {
+				return nil, fmt.Errorf("trust policies %s and %s both have the registry scope %s", other, policy.Name, scope)
+			}
+			scopes[scope] = policy.Name
+		}
+		if policy.SignatureVerification.Level == "skip" {
+			continue
+		}
+		for _, store := range policy.TrustStores {
+			// signingAuthority stores need the notary.x509.signingAuthority scheme, whose authentic
+			// signing time isn't verified, so they are rejected rather than treated as ca stores
+			if kind, _, _ := strings.Cut(store, ":"); kind != "ca" {
+				return nil, fmt.Errorf("trust policy %s: unsupported trust store %q, expected ca:<name>", policy.Name, store)
+			}
+		}
+		if len(policy.TrustedIdentities) == 0 {
+			return nil, fmt.Errorf("trust policy %s has no trusted identities", policy.Name)
+		}
+	}
+	return &doc, nil
+}
+
+// policyFor returns the trust policy whose registry scopes include the repository, or the * policy
+func (d *NotationTrustPolicyDocument) policyFor(repository string) *NotationTrustPolicy {
+	var wildcard *NotationTrustPolicy
+	for i, policy := range d.TrustPolicies {
+		if slices.Contains(policy.RegistryScopes, repository) {
+			return &d.TrustPolicies[i]
+		}
+		if slices.Contains(policy.RegistryScopes, "*") {
+			wildcard = &d.TrustPolicies[i]
+		}
+	}
+	return wildcard
+}
+
+// notationTrustStoreDir is the default --notation-trust-store, the trust store of the notation CLI
+func notationTrustStoreDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "notation", "truststore")
+}
+
+// loadNotationRoots reads the certificates of the trust stores of a policy, PEM or DER files in
+// <dir>/x509/<type>/<name>/
+func loadNotationRoots(dir string, stores []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	count := 0
+	for _, store := range stores {
+		kind, storeName, _ := strings.Cut(store, ":")
+		storeDir := filepath.Join(dir, "x509", kind, storeName)
+		entries, err := os.ReadDir(storeDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Notation trust store %s: %w", store, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(storeDir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			certs, err := parseCertificates(data)
+			if err != nil {
+				return nil, fmt.Errorf("trust store %s: %s: %w", store, entry.Name(), err)
+			}
+			for _, cert := range certs {
+				pool.AddCert(cert)
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no certificates in the Notation trust stores %s", strings.Join(stores, ", "))
+	}
+	return pool, nil
+}
+
+// parseCertificates parses PEM certificates, or a single DER certificate
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// verifyImageNotationSignatures runs verifyNotationSignatures for attestations verified without
+// resolving the image in the registry, as watch, shell and verify --from-export do. Release assets,
+// workflow artifacts and local images have no registry reference, so they fail with a trust policy.
+func verifyImageNotationSignatures(ctx context.Context, image string, desc *v1.Descriptor, opts VerificationOptions) error {
+	if opts.NotationTrustPolicy == "" {
+		return nil
+	}
+	var ref name.Reference
+	if !isLocalImage(image) {
+		if parsed, err := parseImageReference(image); err == nil {
+			if ref, err = pullReference(parsed); err != nil {
+				return err
+			}
+		}
+	}
+	return verifyNotationSignatures(ctx, ref, desc, opts)
+}
+
+// verifyNotationSignatures checks, when --notation-trust-policy is set, that the image has a
+// Notation signature verified by the trust policy of its repository. Audit policies only log
+// failures and skip policies don't check anything.
+func verifyNotationSignatures(ctx context.Context, ref name.Reference, desc *v1.Descriptor, opts VerificationOptions) error {
+	if opts.NotationTrustPolicy == "" {
+		return nil
+	}
+	doc, err := loadNotationTrustPolicy(opts.NotationTrustPolicy)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return errors.New("only registry images have Notation signatures, use --notation-trust-policy with registry references")
+	}
+	repository := ref.Context().Name()
+	policy := doc.policyFor(repository)
+	if policy == nil {
+		return fmt.Errorf("no Notation trust policy applies to %s", repository)
+	}
+	if policy.SignatureVerification.Level == "skip" {
+		return nil
+	}
+	storeDir := notationTrustStoreDir()
+	if opts.NotationTrustStore != "" {
+		storeDir = opts.NotationTrustStore
+	}
+	roots, err := loadNotationRoots(storeDir, policy.TrustStores)
+	if err != nil {
+		return err
+	}
+
+	remoteOpts := []remote.Option{remote.WithAuthFromKeychain(contextKeychain(ctx)), remote.WithContext(ctx)}
+	var failures []string
+	verified := false
+	err = listReferrers(ctx, ref.Context().Digest(desc.Digest.String()), notationSignatureArtifactType, remoteOpts, func(manifestDesc v1.Descriptor) (bool, error) {
+		digest := ref.Context().Digest(manifestDesc.Digest.String())
+		if err := verifyNotationSignature(digest, desc, policy, roots, remoteOpts); err != nil {
+			failures = append(failures, fmt.Sprintf("signature %s: %v", manifestDesc.Digest, err))
+			return true, nil
+		}
+		verified = true
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list Notation signatures: %w", err)
+	}
+	if verified {
+		return nil
+	}
+	failure := fmt.Sprintf("no Notation signature of %s verified by trust policy %s", repository, policy.Name)
+	if len(failures) > 0 {
+		failure += ":\n  " + strings.Join(failures, "\n  ")
+	}
+	if policy.SignatureVerification.Level == "audit" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", failure)
+		return nil
+	}
+	return errors.New(failure)
+}
+
+// verifyNotationSignature downloads the envelope of a Notation signature and verifies it
+func verifyNotationSignature(digest name.Digest, desc *v1.Descriptor, policy *NotationTrustPolicy, roots *x509.CertPool, remoteOpts []remote.Option) error {
+	img, err := remote.Image(digest, remoteOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature manifest: %w", err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature manifest: %w", err)
+	}
+	if len(manifest.Layers) != 1 {
+		return fmt.Errorf("expected one signature envelope layer, found %d", len(manifest.Layers))
+	}
+	layerDesc := manifest.Layers[0]
+	switch layerDesc.MediaType {
+	case notationJWSMediaType:
+	case notationCOSEMediaType:
+		return errors.New("COSE signature envelopes are not supported, sign with --signature-format jws")
+	default:
+		return fmt.Errorf("unexpected envelope media type %s", layerDesc.MediaType)
+	}
+	if layerDesc.Size > maxNotationSignatureSize {
+		return fmt.Errorf("envelope is %d bytes, exceeding %d bytes", layerDesc.Size, maxNotationSignatureSize)
+	}
+	layer, err := img.LayerByDigest(layerDesc.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature envelope: %w", err)
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature envelope: %w", err)
+	}
+	defer rc.Close()
+	envelope, err := io.ReadAll(io.LimitReader(rc, maxNotationSignatureSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature envelope: %w", err)
+	}
+	if len(envelope) > maxNotationSignatureSize {
+		return fmt.Errorf("envelope exceeds %d bytes", maxNotationSignatureSize)
+	}
+	return verifyNotationJWS(envelope, desc, policy, roots, time.Now())
+}
+
+// notationJWSEnvelope is a Notation signature envelope in the flattened JWS JSON serialization
+type notationJWSEnvelope struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Header    struct {
+		X5C [][]byte `json:"x5c"`
+	} `json:"header"`
+	Signature string `json:"signature"`
+}
+
+type notationProtectedHeader struct {
+	Algorithm     string    `json:"alg"`
+	ContentType   string    `json:"cty"`
+	Critical      []string  `json:"crit"`
+	SigningScheme string    `json:"io.cncf.notary.signingScheme"`
+	SigningTime   time.Time `json:"io.cncf.notary.signingTime"`
+	Expiry        time.Time `json:"io.cncf.notary.expiry"`
+}
+
+// notationCriticalHeaders are the critical protected headers verifyNotationJWS processes; an
+// envelope marking any other header critical is rejected, as the Notary signature specification
+// requires of headers the verifier doesn't understand
+var notationCriticalHeaders = []string{notationSigningScheme, notationExpiry}
+
+// verifyNotationJWS verifies the signature of a JWS envelope with the certificate chain it carries,
+// then that the chain terminates in the trust store, that the leaf is a trusted identity, and that
+// the signed payload is the descriptor of the image. The chain is verified at now: the signing time
+// is asserted by the signer, and only an authenticated RFC 3161 timestamp, which isn't supported,
+// could show that the certificates were valid when signing.
+func verifyNotationJWS(data []byte, desc *v1.Descriptor, policy *NotationTrustPolicy, roots *x509.CertPool, now time.Time) error {
+	var envelope notationJWSEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid JWS envelope: %w", err)
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		return fmt.Errorf("invalid protected header: %w", err)
+	}
+	var header notationProtectedHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return fmt.Errorf("invalid protected header: %w", err)
+	}
+	if header.ContentType != notationPayloadContentType {
+		return fmt.Errorf("unexpected payload content type %q", header.ContentType)
+	}
+	if header.SigningScheme != "notary.x509" {
+		return fmt.Errorf("unsupported signing scheme %q, expected notary.x509", header.SigningScheme)
+	}
+	if err := checkNotationCriticalHeaders(header); err != nil {
+		return err
+	}
+	if len(envelope.Header.X5C) == 0 {
+		return errors.New("no certificate chain in the envelope")
+	}
+	chain := make([]*x509.Certificate, len(envelope.Header.X5C))
+	for i, der := range envelope.Header.X5C {
+		if chain[i], err = x509.ParseCertificate(der); err != nil {
+			return fmt.Errorf("invalid certificate in the envelope: %w", err)
+		}
+	}
+	leaf := chain[0]
+
+	signature, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if err := verifyJWSSignature(header.Algorithm, leaf.PublicKey, []byte(envelope.Protected+"."+envelope.Payload), signature); err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return fmt.Errorf("certificate chain not trusted: %w", err)
+	}
+	if !slices.ContainsFunc(policy.TrustedIdentities, func(identity string) bool { return matchesNotationIdentity(leaf, identity) }) {
+		return fmt.Errorf("signer %s is not a trusted identity", leaf.Subject)
+	}
+	if !header.Expiry.IsZero() && now.After(header.Expiry) {
+		if policy.SignatureVerification.Level != "permissive" {
+			return fmt.Errorf("signature expired at %s", header.Expiry.Format(time.RFC3339))
+		}
+		fmt.Fprintf(os.Stderr, "warning: Notation signature expired at %s\n", header.Expiry.Format(time.RFC3339))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	var signed struct {
+		TargetArtifact v1.Descriptor `json:"targetArtifact"`
+	}
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if signed.TargetArtifact.Digest != desc.Digest {
+		return fmt.Errorf("signature is for %s, not %s", signed.TargetArtifact.Digest, desc.Digest)
+	}
+	return nil
+}
+
+// checkNotationCriticalHeaders requires the signing scheme, and the expiry when set, to be marked
+// critical, and rejects the critical headers that aren't processed
+func checkNotationCriticalHeaders(header notationProtectedHeader) error {
+	for _, critical := range header.Critical {
+		if !slices.Contains(notationCriticalHeaders, critical) {
+			return fmt.Errorf("unsupported critical header %q", critical)
+		}
+	}
+	if !slices.Contains(header.Critical, notationSigningScheme) {
+		return fmt.Errorf("%s is not marked critical", notationSigningScheme)
+	}
+	if !header.Expiry.IsZero() && !slices.Contains(header.Critical, notationExpiry) {
+		return fmt.Errorf("%s is not marked critical", notationExpiry)
+	}
+	return nil
+}
+
+// verifyJWSSignature verifies a JWS signature with the algorithms Notation signs with
+func verifyJWSSignature(algorithm string, publicKey crypto.PublicKey, signingInput, signature []byte) error {
+	hashes := map[string]crypto.Hash{
+		"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	}
+	hash, ok := hashes[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported JWS algorithm %q", algorithm)
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "PS") {
+			return fmt.Errorf("JWS algorithm %s doesn't match the RSA signing key", algorithm)
+		}
+		if err := rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(algorithm, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("JWS algorithm %s doesn't match the ECDSA signing key", algorithm)
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported signing key %T", publicKey)
+	}
+	return nil
+}
+
+// matchesNotationIdentity reports whether the certificate is a trusted identity of a trust policy:
+// * or x509.subject: <DN>, whose attributes must all be in the subject of the certificate
+func matchesNotationIdentity(cert *x509.Certificate, identity string) bool {
+	if identity == "*" {
+		return true
+	}
+	dn, ok := strings.CutPrefix(identity, "x509.subject:")
+	if !ok {
+		return false
+	}
+	subject := cert.Subject
+	attributes := map[string][]string{
+		"C":  subject.Country,
+		"ST": subject.Province,
+		"L":  subject.Locality,
+		"O":  subject.Organization,
+		"OU": subject.OrganizationalUnit,
+		"CN": {subject.CommonName},
+	}
+	for _, attribute := range strings.Split(dn, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(attribute), "=")
+		if !ok || !slices.Contains(attributes[strings.TrimSpace(key)], strings.TrimSpace(value)) {
+			return false
+		}
+	}
+	return true
+}
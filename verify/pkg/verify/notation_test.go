@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// notationSigner is a CA and a code signing leaf issued by it
+type notationSigner struct {
+	roots *x509.CertPool
+	key   *ecdsa.PrivateKey
+	chain [][]byte
+}
+
+func newNotationSigner(t *testing.T, notBefore, notAfter time.Time) notationSigner {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "notation test ca"},
+		NotBefore:             notBefore.Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "signer", Organization: []string{"nirmata"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return notationSigner{roots: roots, key: key, chain: [][]byte{leafDER}}
+}
+
+// sign builds a JWS envelope of the descriptor with the protected header
+func (s notationSigner) sign(t *testing.T, header map[string]any, desc v1.Descriptor) []byte {
+	t.Helper()
+	protected, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(map[string]any{"targetArtifact": desc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(protected) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+	envelope := map[string]any{
+		"payload":   base64.RawURLEncoding.EncodeToString(payload),
+		"protected": base64.RawURLEncoding.EncodeToString(protected),
+		"header":    map[string]any{"x5c": s.chain},
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func notationHeader(signingTime time.Time, critical ...string) map[string]any {
+	return map[string]any{
+		"alg":                        "ES256",
+		"cty":                        notationPayloadContentType,
+		"crit":                       critical,
+		notationSigningScheme:        "notary.x509",
+		"io.cncf.notary.signingTime": signingTime.Format(time.RFC3339),
+	}
+}
+
+func TestVerifyNotationJWS(t *testing.T) {
+	now := time.Now()
+	desc := v1.Descriptor{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}}
+	policy := &NotationTrustPolicy{Name: "test", TrustedIdentities: []string{"x509.subject: CN=signer, O=nirmata"}}
+	policy.SignatureVerification.Level = "strict"
+	valid := newNotationSigner(t, now.Add(-time.Hour), now.Add(time.Hour))
+	expired := newNotationSigner(t, now.Add(-3*time.Hour), now.Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		signer   notationSigner
+		header   map[string]any
+		expected string
+	}{
+		{name: "valid", signer: valid, header: notationHeader(now, notationSigningScheme)},
+		{name: "signing scheme not critical", signer: valid, header: notationHeader(now), expected: "is not marked critical"},
+		{name: "unknown critical header", signer: valid, header: notationHeader(now, notationSigningScheme, "io.cncf.notary.authenticSigningTime"), expected: "unsupported critical header"},
+		{
+			// the signing time is asserted by the signer, so it can't vouch for an expired certificate
+			name:     "certificate expired since signing",
+			signer:   expired,
+			header:   notationHeader(now.Add(-2*time.Hour), notationSigningScheme),
+			expected: "certificate chain not trusted",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envelope := test.signer.sign(t, test.header, desc)
+			err := verifyNotationJWS(envelope, &desc, policy, test.signer.roots, now)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadNotationTrustPolicyRejectsSigningAuthority(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trustpolicy.json")
+	policy := `{"version": "1.0", "trustPolicies": [{"name": "test", "registryScopes": ["*"], "signatureVerification": {"level": "strict"}, "trustStores": ["signingAuthority:test"], "trustedIdentities": ["*"]}]}`
+	if err := os.WriteFile(path, []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadNotationTrustPolicy(path); err == nil || !strings.Contains(err.Error(), "unsupported trust store") {
+		t.Fatalf("expected signingAuthority to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package verify
+
+// Observer is notified as images are verified, so that applications embedding the verifier can
+// stream progress, collect metrics or capture payloads. Images verified concurrently call it
+// concurrently.
+type Observer interface {
+	// OnBundleFetched is called for every bundle found for the image, before the predicate and
+	// payload type filters
+	OnBundleFetched(image string, bundle *Bundle)
+	// OnBundleVerified is called for every bundle passing the filters, with the reason it failed
+	// verification, if it did
+	OnBundleVerified(image string, bundle *Bundle, err error)
+	// OnPolicyEvaluated is called once the verified bundles are checked against the --require and
+	// --min-identities rules, with the outcome for the image
+	OnPolicyEvaluated(image string, results []VerificationResult, err error)
+}
+
+// NopObserver can be embedded by observers interested in only some of the events
+type NopObserver struct{}
+
+func (NopObserver) OnBundleFetched(string, *Bundle) {}
+
+func (NopObserver) OnBundleVerified(string, *Bundle, error) {}
+
+func (NopObserver) OnPolicyEvaluated(string, []VerificationResult, error) {}
+
+// observer returns the Observer of the options, which is unset for the command line
+func (opts VerificationOptions) observer() Observer {
+	if opts.Observer == nil {
+		return NopObserver{}
+	}
+	return opts.Observer
+}
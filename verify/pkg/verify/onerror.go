@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	tufmetadata "github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+const (
+	onErrorFail = "fail"
+	onErrorWarn = "warn"
+	onErrorSkip = "skip"
+)
+
+var onErrorModes = []string{onErrorFail, onErrorWarn, onErrorSkip}
+
+// HTTPStatusError is an unexpected status returned by an HTTP API the verifier depends on
+type HTTPStatusError struct {
+	Message    string
+	Status     string
+	StatusCode int
+}
+
+func newHTTPStatusError(resp *http.Response, format string, args ...any) *HTTPStatusError {
+	return &HTTPStatusError{Message: fmt.Sprintf(format, args...), Status: resp.Status, StatusCode: resp.StatusCode}
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.Status)
+}
+
+func validateOnError(onError string) error {
+	if !slices.Contains(onErrorModes, onError) {
+		return fmt.Errorf("invalid --on-error %q, expected one of %s", onError, strings.Join(onErrorModes, ", "))
+	}
+	return nil
+}
+
+// isInfrastructureError reports whether err means the registry, the TUF repository or an API was
+// unreachable or failing, as opposed to attestations that don't verify
+func isInfrastructureError(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	var transportErr *transport.Error
+	var statusErr *HTTPStatusError
+	switch {
+	case errors.As(err, &urlErr), errors.As(err, &netErr), errors.Is(err, &tufmetadata.ErrDownload{}), errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &transportErr):
+		return isUnavailableStatus(transportErr.StatusCode)
+	case errors.As(err, &statusErr):
+		return isUnavailableStatus(statusErr.StatusCode)
+	}
+	return false
+}
+
+func isUnavailableStatus(code int) bool {
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
+
+// tolerateInfrastructureError admits the image unverified when its verification failed on an
+// infrastructure error and --on-error is warn or skip
+func tolerateInfrastructureError(outcome ImageResult, opts VerificationOptions) ImageResult {
+	if outcome.Err == nil || opts.OnError == onErrorFail || !isInfrastructureError(outcome.Err) {
+		return outcome
+	}
+	if opts.OnError == onErrorWarn {
+		outcome.Warning = outcome.Err
+	} else {
+		outcome.Skipped = outcome.Err
+	}
+	outcome.Err = nil
+	return outcome
+}
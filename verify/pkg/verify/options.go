@@ -0,0 +1,215 @@
+package verify
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// VerificationOption sets an option of the VerificationOptions built by NewVerificationOptions
+type VerificationOption func(*VerificationOptions) error
+
+// NewVerificationOptions builds the options of a verification for callers embedding the verifier.
+// Every option starts at the default of its flag, and the result is validated like the flags of the
+// commands. A policy is required: a subject, a subject regexp, a GitHub workflow, an identity
+// allowlist or a key.
+func NewVerificationOptions(options ...VerificationOption) (VerificationOptions, error) {
+	opts := VerificationOptions{}
+	addVerificationFlags(flag.NewFlagSet("options", flag.ContinueOnError), &opts)
+	for _, option := range options {
+		if err := option(&opts); err != nil {
+			return VerificationOptions{}, err
+		}
+	}
+
+	if opts.Subject == "" && opts.SubjectRegexp == "" && opts.GitHubWorkflow == "" && opts.GitHubReusableWorkflow == "" && opts.IdentityAllowlist == "" && opts.Key == "" {
+		return VerificationOptions{}, errors.New("no policy: set WithSubject, WithSubjectRegexp, WithGitHubWorkflow, WithIdentityAllowlist or WithKey")
+	}
+	applyGitHubHost(&opts)
+	if err := applyGitHubWorkflows(&opts); err != nil {
+		return VerificationOptions{}, err
+	}
+	if err := loadPins(&opts); err != nil {
+		return VerificationOptions{}, err
+	}
+	if err := validateOutput(opts.Output); err != nil {
+		return VerificationOptions{}, err
+	}
+	if err := validateOnError(opts.OnError); err != nil {
+		return VerificationOptions{}, err
+	}
+	return opts, nil
+}
+
+// WithIssuer sets the OIDC issuer of the signing certificates (default derived from the GitHub host)
+func WithIssuer(issuer string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.OIDCIssuer = issuer
+		return nil
+	}
+}
+
+// WithSubject sets the identity of the signing certificates
+func WithSubject(subject string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.Subject = subject
+		return nil
+	}
+}
+
+// WithSubjectRegexp sets a regular expression the identity of the signing certificates must match
+func WithSubjectRegexp(subjectRegexp string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		if _, err := regexp.Compile(subjectRegexp); err != nil {
+			return fmt.Errorf("invalid subject regexp: %w", err)
+		}
+		opts.SubjectRegexp = subjectRegexp
+		return nil
+	}
+}
+
+// WithGitHubWorkflow sets the workflow that signed the attestations, as
+// owner/repo/.github/workflows/<file>@<ref>, instead of a subject
+func WithGitHubWorkflow(workflow string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.GitHubWorkflow = workflow
+		return nil
+	}
+}
+
+// WithIdentityAllowlist requires the signer to match one of the issuer/subject patterns of a YAML
+// file, instead of or on top of a subject
+func WithIdentityAllowlist(path string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		if _, err := loadIdentityList(path); err != nil {
+			return err
+		}
+		opts.IdentityAllowlist = path
+		return nil
+	}
+}
+
+// WithIdentityDenylist fails the bundles whose signer matches one of the issuer/subject patterns
+// of a YAML file
+func WithIdentityDenylist(path string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		if _, err := loadIdentityList(path); err != nil {
+			return err
+		}
+		opts.IdentityDenylist = path
+		return nil
+	}
+}
+
+// WithPredicateTypes only verifies the bundles of these predicate types, each of which then needs a
+// verified attestation
+func WithPredicateTypes(predicateTypes ...string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		for _, predicateType := range predicateTypes {
+			if err := opts.PredicateTypes.Set(predicateType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithRequirement requires at least count verified attestations of a predicate type
+func WithRequirement(predicateType string, count int) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		if predicateType == "" || count < 1 {
+			return fmt.Errorf("invalid requirement %s:%d, expected a predicate type and a positive count", predicateType, count)
+		}
+		opts.Requirements = append(opts.Requirements, Requirement{PredicateType: predicateType, Count: count})
+		return nil
+	}
+}
+
+// WithGitHubHost sets the GitHub host the attestations were created on, from which the issuer, API
+// and TUF mirror are derived
+func WithGitHubHost(host string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.GitHubHost = host
+		return nil
+	}
+}
+
+// WithTUFMirror fetches the trusted root from a TUF repository, bootstrapped from the root.json at
+// rootPath, which may be empty for mirrors whose root is embedded or was saved by update-root
+func WithTUFMirror(mirror, rootPath string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		if !strings.HasPrefix(mirror, "https://") && !strings.HasPrefix(mirror, "http://") {
+			return fmt.Errorf("invalid tuf mirror %q, expected an http(s) URL", mirror)
+		}
+		opts.TUFMirror = mirror
+		opts.TUFRoot = rootPath
+		return nil
+	}
+}
+
+// WithTrustedRootPath reads the trusted root from a trusted_root.json instead of fetching it
+func WithTrustedRootPath(path string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.TrustedRootPath = path
+		return nil
+	}
+}
+
+// WithKey verifies bundles signed with a public key, a PEM file or a KMS URI, instead of keyless
+// bundles
+func WithKey(key string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.Key = key
+		return nil
+	}
+}
+
+// WithSources sets the sources the bundles are discovered in, e.g. oci, github or rekor
+func WithSources(sources ...string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		for _, source := range sources {
+			if err := opts.Sources.Set(source); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithConcurrency sets the number of images VerifyImages verifies in parallel
+func WithConcurrency(concurrency int) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		if concurrency < 1 {
+			return fmt.Errorf("invalid concurrency %d, expected at least 1", concurrency)
+		}
+		opts.Concurrency = concurrency
+		return nil
+	}
+}
+
+// WithLockfile sets a YAML or JSON map of image references to the digests they must resolve to;
+// images missing from it fail
+func WithLockfile(path string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.Lockfile = path
+		return nil
+	}
+}
+
+// WithOnError sets what to do with images when a registry or API is unreachable: fail, warn or skip
+func WithOnError(onError string) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.OnError = onError
+		return nil
+	}
+}
+
+// WithObserver receives the bundles and outcomes of the verification as they happen
+func WithObserver(observer Observer) VerificationOption {
+	return func(opts *VerificationOptions) error {
+		opts.Observer = observer
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	outputText          = "text"
+	outputKyverno       = "kyverno"
+	outputGitHubActions = "github-actions"
+)
+
+var outputFormats = []string{outputText, outputKyverno, outputGitHubActions}
+
+// ImageResult is the result of verifying one image, rendered by the --output format
+type ImageResult struct {
+	Image   string
+	Results []VerificationResult
+	Err     error
+	// Warning and Skipped hold the infrastructure error tolerated by --on-error warn or skip, in which
+	// case the image is admitted without being verified
+	Warning error
+	Skipped error
+}
+
+func validateOutput(output string) error {
+	for _, format := range outputFormats {
+		if output == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --output %q, expected one of %s", output, strings.Join(outputFormats, ", "))
+}
+
+// writeOutcomes renders the outcomes in the structured --output formats. Text output is printed as
+// images are verified instead.
+func writeOutcomes(w io.Writer, output string, outcomes []ImageResult) error {
+	switch output {
+	case outputKyverno:
+		return writeKyvernoReport(w, outcomes)
+	case outputGitHubActions:
+		return writeGitHubActions(w, outcomes)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+)
+
+const (
+	inTotoPayloadType        = "application/vnd.in-toto+json"
+	simpleSigningPayloadType = "application/vnd.dev.cosign.simplesigning.v1+json"
+)
+
+// newBundle wraps a parsed protobuf bundle, decoding the payload of its DSSE envelope if it has one
+func newBundle(b *bundle.ProtobufBundle) *Bundle {
+	wrapped := &Bundle{ProtoBundle: b}
+	wrapped.Version, _ = b.Version()
+	if envelope := b.Bundle.GetDsseEnvelope(); envelope != nil {
+		wrapped.PayloadType = envelope.PayloadType
+		wrapped.Payload = envelope.Payload
+		wrapped.DSSE_Envelope, wrapped.StatementErr = decodeStatement(b)
+	}
+	return wrapped
+}
+
+// matchesPayloadType reports whether the bundle's DSSE payload type is the selected one. Bundles
+// holding a message signature instead of an envelope always match.
+func matchesPayloadType(b *Bundle, payloadType string) bool {
+	return b.PayloadType == "" || b.PayloadType == payloadType
+}
+
+// checkPayloadDigest binds a non in-toto payload to the image, since sigstore-go can only match the
+// subjects of in-toto statements. cosign simple signing payloads must name the image digest, and
+// other JSON payloads must contain it in one of their string values.
+func checkPayloadDigest(b *Bundle, desc *v1.Descriptor) error {
+	if b.PayloadType == simpleSigningPayloadType {
+		var simpleSigning struct {
+			Critical struct {
+				Image struct {
+					DockerManifestDigest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+			} `json:"critical"`
+		}
+		if err := json.Unmarshal(b.Payload, &simpleSigning); err != nil {
+			return fmt.Errorf("invalid simple signing payload: %w", err)
+		}
+		if digest := simpleSigning.Critical.Image.DockerManifestDigest; digest != desc.Digest.String() {
+			return fmt.Errorf("simple signing payload is for %s, not %s", digest, desc.Digest)
+		}
+		return nil
+	}
+
+	var payload any
+	if err := json.Unmarshal(b.Payload, &payload); err != nil {
+		return fmt.Errorf("payload of type %s is not JSON: %w", b.PayloadType, err)
+	}
+	if !containsDigest(payload, desc.Digest) {
+		return errors.New("provided artifact digest is not referenced by the payload")
+	}
+	return nil
+}
+
+func containsDigest(value any, digest v1.Hash) bool {
+	switch v := value.(type) {
+	case string:
+		return v == digest.String() || strings.EqualFold(v, digest.Hex)
+	case []any:
+		for _, item := range v {
+			if containsDigest(item, digest) {
+				return true
+			}
+		}
+	case map[string]any:
+		for key, item := range v {
+			// {"sha256": "<hex>"} digest sets
+			if key == digest.Algorithm && item == digest.Hex {
+				return true
+			}
+			if containsDigest(item, digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printPayload prints the in-toto statement of the bundle, or its raw JSON payload for other payload types
+func printPayload(w io.Writer, b *Bundle) error {
+	if b.DSSE_Envelope == nil && b.Payload != nil {
+		var out bytes.Buffer
+		if err := json.Indent(&out, b.Payload, "", " "); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w, out.String())
+		return err
+	}
+	val, err := json.MarshalIndent(b.DSSE_Envelope, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(val))
+	return err
+}
+
+// printStatementsByPredicateType prints the verified in-toto statements as a JSON object keyed by predicate type
+func printStatementsByPredicateType(w io.Writer, results []VerificationResult) error {
+	grouped := map[string][]*in_toto.Statement{}
+	for _, result := range results {
+		if statement := result.Bundle.DSSE_Envelope; statement != nil {
+			grouped[statement.PredicateType] = append(grouped[statement.PredicateType], statement)
+		}
+	}
+	val, err := json.MarshalIndent(grouped, "", " ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(val))
+	return err
+}
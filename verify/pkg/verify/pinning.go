@@ -0,0 +1,114 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// loadLockfile reads a digests lockfile, a YAML or JSON map of image references to the digests
+// they must resolve to
+func loadLockfile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	pins := map[string]string{}
+	if err := yaml.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	for image, digest := range pins {
+		if _, err := v1.NewHash(digest); err != nil {
+			return nil, fmt.Errorf("invalid digest for %s in lockfile %s: %w", image, path, err)
+		}
+	}
+	return pins, nil
+}
+
+// loadPins loads the --lockfile into the pins checkPinnedDigest enforces, unless they are already
+// loaded. Every command accepting --lockfile calls it, since a lockfile that isn't loaded pins nothing.
+func loadPins(opts *VerificationOptions) error {
+	if opts.Lockfile == "" || opts.Pins != nil {
+		return nil
+	}
+	pins, err := loadLockfile(opts.Lockfile)
+	if err != nil {
+		return err
+	}
+	opts.Pins = pins
+	return nil
+}
+
+// pinnedImages returns the images of the lockfile in a stable order
+func pinnedImages(pins map[string]string) []string {
+	images := make([]string, 0, len(pins))
+	for image := range pins {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// checkPinnedDigest fails when the image resolved to a different digest than --expected-digest, or
+// than its entry in --lockfile. With a lockfile, images missing from it fail too.
+func checkPinnedDigest(image string, desc *v1.Descriptor, opts VerificationOptions) error {
+	expected := opts.ExpectedDigest
+	if expected == "" && opts.Pins != nil {
+		var ok bool
+		if expected, ok = lookupPin(opts.Pins, image); !ok {
+			return fmt.Errorf("%s is not pinned in the lockfile", image)
+		}
+	}
+	if expected != "" && expected != desc.Digest.String() {
+		return fmt.Errorf("digest mismatch for %s: resolved %s, expected %s", image, desc.Digest, expected)
+	}
+	return nil
+}
+
+// lookupPin returns the digest the lockfile pins an image to, matching shorthand references like
+// nginx:1.25 and fully qualified ones like index.docker.io/library/nginx:1.25 to each other
+func lookupPin(pins map[string]string, image string) (string, bool) {
+	if digest, ok := pins[image]; ok {
+		return digest, true
+	}
+	normalized := normalizeImage(image)
+	for pinned, digest := range pins {
+		if normalizeImage(pinned) == normalized {
+			return digest, true
+		}
+	}
+	return "", false
+}
+
+// checkDigestReference refuses images referenced by tag when --require-digest-reference is set, since
+// a tag can be moved to another image after it was verified
+func checkDigestReference(image string, opts VerificationOptions) error {
+	if !opts.RequireDigestReference || isLocalImage(image) {
+		return nil
+	}
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return fmt.Errorf("failed to parse image reference %s: %w", image, err)
+	}
+	if _, ok := ref.(name.Digest); !ok {
+		return fmt.Errorf("%s is referenced by tag, pin it by digest as %s@sha256:...", image, ref.Context().Name())
+	}
+	return nil
+}
+
+// pinnedReference returns the image reference pinned to the verified digest, e.g. for substitution
+// into manifests. Local images are returned unchanged.
+func pinnedReference(image string, desc *v1.Descriptor) string {
+	if isLocalImage(image) {
+		return image
+	}
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return image
+	}
+	return ref.Context().Digest(desc.Digest.String()).String()
+}
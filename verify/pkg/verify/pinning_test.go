@@ -0,0 +1,46 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestCheckPinnedDigest(t *testing.T) {
+	resolved := "sha256:" + strings.Repeat("ab", 32)
+	other := "sha256:" + strings.Repeat("cd", 32)
+	tests := []struct {
+		name     string
+		image    string
+		opts     VerificationOptions
+		expected string
+	}{
+		{name: "not pinned", image: "ghcr.io/nirmata/app:v1"},
+		{name: "expected digest", image: "ghcr.io/nirmata/app:v1", opts: VerificationOptions{ExpectedDigest: resolved}},
+		{name: "expected digest mismatch", image: "ghcr.io/nirmata/app:v1", opts: VerificationOptions{ExpectedDigest: other}, expected: "digest mismatch"},
+		{name: "lockfile", image: "ghcr.io/nirmata/app:v1", opts: VerificationOptions{Pins: map[string]string{"ghcr.io/nirmata/app:v1": resolved}}},
+		{name: "lockfile mismatch", image: "ghcr.io/nirmata/app:v1", opts: VerificationOptions{Pins: map[string]string{"ghcr.io/nirmata/app:v1": other}}, expected: "digest mismatch"},
+		{name: "lockfile shorthand", image: "index.docker.io/library/nginx:1.25", opts: VerificationOptions{Pins: map[string]string{"nginx:1.25": resolved}}},
+		{name: "lockfile qualified", image: "nginx:1.25", opts: VerificationOptions{Pins: map[string]string{"docker.io/library/nginx:1.25": resolved}}},
+		{name: "missing from lockfile", image: "ghcr.io/nirmata/other:v1", opts: VerificationOptions{Pins: map[string]string{"ghcr.io/nirmata/app:v1": resolved}}, expected: "is not pinned in the lockfile"},
+		{name: "empty lockfile", image: "ghcr.io/nirmata/app:v1", opts: VerificationOptions{Pins: map[string]string{}}, expected: "is not pinned in the lockfile"},
+		{
+			name:  "expected digest overrides lockfile",
+			image: "ghcr.io/nirmata/other:v1",
+			opts:  VerificationOptions{ExpectedDigest: resolved, Pins: map[string]string{"ghcr.io/nirmata/app:v1": other}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desc := &v1.Descriptor{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.TrimPrefix(resolved, "sha256:")}}
+			err := checkPinnedDigest(test.image, desc, test.opts)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// predicatePlugin is a command receiving the verified predicates of a predicate type
+type predicatePlugin struct {
+	PredicateType string
+	Command       []string
+}
+
+// predicatePluginFlags collects repeated --predicate-plugin flags of the form <predicate-type>=<command>
+type predicatePluginFlags []predicatePlugin
+
+func (p *predicatePluginFlags) String() string {
+	plugins := make([]string, 0, len(*p))
+	for _, plugin := range *p {
+		plugins = append(plugins, plugin.PredicateType+"="+strings.Join(plugin.Command, " "))
+	}
+	return strings.Join(plugins, ",")
+}
+
+func (p *predicatePluginFlags) Set(value string) error {
+	predicateType, command, ok := strings.Cut(value, "=")
+	if !ok || predicateType == "" || strings.TrimSpace(command) == "" {
+		return fmt.Errorf("invalid predicate plugin %q, expected <predicate-type>=<command>", value)
+	}
+	*p = append(*p, predicatePlugin{PredicateType: predicateType, Command: strings.Fields(command)})
+	return nil
+}
+
+// PluginRequest is the JSON a predicate plugin reads on stdin, for one verified attestation
+type PluginRequest struct {
+	Image         string          `json:"image"`
+	Digest        string          `json:"digest"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+	Issuer        string          `json:"issuer,omitempty"`
+	Subject       string          `json:"subject,omitempty"`
+}
+
+// PluginResponse is the JSON a predicate plugin writes on stdout. A plugin vetoes the attestation,
+// failing the image, or adds annotations describing it to the output.
+type PluginResponse struct {
+	Veto        bool              `json:"veto"`
+	Reason      string            `json:"reason,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// runPredicatePlugins passes each verified attestation to the plugins of its predicate type, and
+// fails when a plugin vetoes one or doesn't run. The annotations of the plugins are added to the
+// results.
+func runPredicatePlugins(ctx context.Context, image string, results []VerificationResult, opts VerificationOptions) error {
+	for i, result := range results {
+		statement := result.Bundle.DSSE_Envelope
+		if statement == nil {
+			continue
+		}
+		for _, plugin := range opts.PredicatePlugins {
+			if plugin.PredicateType != statement.PredicateType {
+				continue
+			}
+			predicate, err := result.Bundle.RawPredicate()
+			if err != nil {
+				return err
+			}
+			request := PluginRequest{Image: image, Digest: result.Desc.Digest.String(), PredicateType: statement.PredicateType, Predicate: predicate}
+			if signer, ok := signerSummary(result.Bundle); ok {
+				request.Issuer, request.Subject = signer.Extensions.Issuer, signer.SubjectAlternativeName
+			}
+			response, err := plugin.run(ctx, request)
+			if err != nil {
+				return fmt.Errorf("predicate plugin %s: %w", plugin.Command[0], err)
+			}
+			if response.Veto {
+				reason := response.Reason
+				if reason == "" {
+					reason = "no reason given"
+				}
+				return fmt.Errorf("predicate plugin %s vetoed the %s attestation: %s", plugin.Command[0], statement.PredicateType, reason)
+			}
+			for key, value := range response.Annotations {
+				if results[i].Annotations == nil {
+					results[i].Annotations = map[string]string{}
+				}
+				results[i].Annotations[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// run executes the plugin with the request on stdin and decodes its response from stdout
+func (p predicatePlugin) run(ctx context.Context, request PluginRequest) (PluginResponse, error) {
+	var response PluginResponse
+	err := runJSONCommand(ctx, p.Command, request, &response)
+	return response, err
+}
+
+// runJSONCommand runs a command with input encoded as JSON on stdin, and decodes its stdout into
+// output. The stderr of a failed command is part of the error.
+func runJSONCommand(ctx context.Context, command []string, input, output any) error {
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	if err := json.Unmarshal(stdout.Bytes(), output); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// printAnnotations prints the annotations the predicate plugins added to the verified attestations
+func printAnnotations(w io.Writer, results []VerificationResult) {
+	for _, result := range results {
+		if len(result.Annotations) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "annotations of the %s attestation:\n", result.Bundle.DSSE_Envelope.PredicateType)
+		for _, key := range slices.Sorted(maps.Keys(result.Annotations)) {
+			fmt.Fprintf(w, "  %s=%s\n", key, result.Annotations[key])
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+const (
+	// maxPolicySize bounds the policies fetched from a registry or URL
+	maxPolicySize = 1 << 20
+	// policyBundleSuffix is appended to the location of a policy file or URL to find its bundle
+	policyBundleSuffix = ".sigstore.json"
+)
+
+// PolicySigner is the identity a policy must be signed by before it is applied
+type PolicySigner struct {
+	Subject        string
+	SubjectRegexp  string
+	GitHubWorkflow string
+	Issuer         string
+}
+
+func (s PolicySigner) isSet() bool {
+	return s.Subject != "" || s.SubjectRegexp != "" || s.GitHubWorkflow != ""
+}
+
+// isRemotePolicy reports whether a policy location is an OCI reference or a URL rather than a file
+func isRemotePolicy(location string) bool {
+	return strings.HasPrefix(location, helmReferencePrefix) || strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// signerOptions are the verification options of the policy attestations: only the signer is
+// checked, not the constraints of the images
+func (s PolicySigner) signerOptions(opts VerificationOptions) (VerificationOptions, error) {
+	options := []VerificationOption{WithGitHubHost(opts.GitHubHost), WithIssuer(opts.OIDCIssuer)}
+	if s.Issuer != "" {
+		options = append(options, WithIssuer(s.Issuer))
+	}
+	switch {
+	case s.GitHubWorkflow != "":
+		options = append(options, WithGitHubWorkflow(s.GitHubWorkflow))
+	case s.SubjectRegexp != "":
+		options = append(options, WithSubjectRegexp(s.SubjectRegexp))
+	default:
+		options = append(options, WithSubject(s.Subject))
+	}
+	return NewVerificationOptions(options...)
+}
+
+// fetchSignedPolicy returns the content of a policy once an attestation of it verifies against the
+// signer. A policy at an oci:// reference is the first layer of the artifact, attested through its
+// referrers. A policy file or URL is attested by the bundle next to it, at <location>.sigstore.json,
+// whose statement has the digest of the policy as subject.
+func fetchSignedPolicy(ctx context.Context, location string, signer PolicySigner, trustedRoot *root.TrustedRoot, opts VerificationOptions) ([]byte, error) {
+	signerOpts, err := signer.signerOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy signer: %w", err)
+	}
+	if strings.HasPrefix(location, helmReferencePrefix) {
+		return fetchOCIPolicy(ctx, location, trustedRoot, signerOpts)
+	}
+
+	content, err := readPolicyLocation(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	bundleBytes, err := readPolicyLocation(ctx, location+policyBundleSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bundle of policy %s: %w", location, err)
+	}
+	b, err := parseBundle(bundleBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location+policyBundleSuffix, err)
+	}
+	digest, size, err := v1.SHA256(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifyAttestations(ctx, location, []*Bundle{b}, &v1.Descriptor{Digest: digest, Size: size}, trustedRoot, signerOpts); err != nil {
+		return nil, fmt.Errorf("policy %s is not signed by the policy signer: %w", location, err)
+	}
+	return content, nil
+}
+
+// fetchOCIPolicy verifies the attestations of the policy artifact, then pulls its first layer by the
+// verified manifest digest
+func fetchOCIPolicy(ctx context.Context, location string, trustedRoot *root.TrustedRoot, opts VerificationOptions) ([]byte, error) {
+	bundles, desc, err := resolveBundles(ctx, location, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifyAttestations(ctx, location, bundles, desc, trustedRoot, opts); err != nil {
+		return nil, fmt.Errorf("policy %s is not signed by the policy signer: %w", location, err)
+	}
+
+	ref, err := parseImageReference(location)
+	if err != nil {
+		return nil, err
+	}
+	if ref, err = pullReference(ref); err != nil {
+		return nil, err
+	}
+	artifact, err := remote.Image(ref.Context().Digest(desc.Digest.String()), remote.WithAuthFromKeychain(contextKeychain(ctx)), remote.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy %s: %w", location, err)
+	}
+	layers, err := artifact.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy %s: %w", location, err)
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("policy %s has no layers", location)
+	}
+	layer, err := layers[0].Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy %s: %w", location, err)
+	}
+	defer layer.Close()
+	return readPolicy(location, layer)
+}
+
+// readPolicyLocation reads a policy or its bundle from a file or an http(s) URL
+func readPolicyLocation(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return os.ReadFile(location)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := newAPIClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(resp, "failed to fetch %s", location)
+	}
+	return readPolicy(location, resp.Body)
+}
+
+func readPolicy(location string, r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxPolicySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", location, err)
+	}
+	if len(content) > maxPolicySize {
+		return nil, fmt.Errorf("policy %s exceeds %d bytes", location, maxPolicySize)
+	}
+	return content, nil
+}
+
+// readAdmissionPolicy reads an --admission-policy, requiring remote policies to be signed since
+// whoever controls their location would otherwise decide what the webhook admits
+func readAdmissionPolicy(ctx context.Context, location string, signer PolicySigner, trustedRoot *root.TrustedRoot, opts VerificationOptions) ([]byte, error) {
+	if signer.isSet() {
+		return fetchSignedPolicy(ctx, location, signer, trustedRoot, opts)
+	}
+	if isRemotePolicy(location) {
+		return nil, errors.New("--admission-policy fetched from a registry or URL requires --policy-signer-subject, --policy-signer-subject-regexp or --policy-signer-workflow")
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admission policy: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,296 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	policyCollection = "/apis/verify.nirmata.io/v1alpha1/imageverificationpolicies"
+
+	// policyWatchRetry is how long to wait before listing the policies again after a failed watch
+	policyWatchRetry = 5 * time.Second
+)
+
+// ImageVerificationPolicy is the cluster-scoped custom resource configuring the policy of the
+// images of some namespaces, so that policies are managed like other Kubernetes objects rather than
+// with the flags of the webhook
+type ImageVerificationPolicy struct {
+	APIVersion string                      `json:"apiVersion"`
+	Kind       string                      `json:"kind"`
+	Metadata   kubeObjectMeta              `json:"metadata"`
+	Spec       ImageVerificationPolicySpec `json:"spec"`
+}
+
+type ImageVerificationPolicySpec struct {
+	// Namespaces the policy applies to, every namespace when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Images are the glob patterns of the image references the policy applies to, e.g.
+	// ghcr.io/nirmata/*, every image when empty
+	Images []string `json:"images,omitempty"`
+	// Issuer is the OIDC issuer of the signer, by default the issuer of the webhook's --github-host
+	Issuer string `json:"issuer,omitempty"`
+	// Subject, SubjectRegexp or GitHubWorkflow is the identity of the signer
+	Subject        string `json:"subject,omitempty"`
+	SubjectRegexp  string `json:"subjectRegexp,omitempty"`
+	GitHubWorkflow string `json:"githubWorkflow,omitempty"`
+	// PredicateTypes each need a verified attestation, like --predicate-type
+	PredicateTypes []string `json:"predicateTypes,omitempty"`
+	// Requirements are minimum numbers of verified attestations of a predicate type, like --require
+	Requirements []Requirement `json:"requirements,omitempty"`
+}
+
+// appliesTo reports whether the policy selects an image of an object of the namespace
+func (p ImageVerificationPolicy) appliesTo(namespace, image string) bool {
+	if len(p.Spec.Namespaces) > 0 && !slices.Contains(p.Spec.Namespaces, namespace) {
+		return false
+	}
+	if len(p.Spec.Images) == 0 {
+		return true
+	}
+	names := imageNames(image)
+	return slices.ContainsFunc(p.Spec.Images, func(pattern string) bool {
+		return slices.ContainsFunc(names, func(name string) bool {
+			matched, err := path.Match(pattern, name)
+			return err == nil && matched
+		})
+	})
+}
+
+// options returns the options of the webhook with the identity and predicate requirements of the
+// policy. The policy identity replaces the one of the flags.
+func (p ImageVerificationPolicy) options(base VerificationOptions) (VerificationOptions, error) {
+	spec := p.Spec
+	if spec.Subject == "" && spec.SubjectRegexp == "" && spec.GitHubWorkflow == "" {
+		return base, errors.New("no subject, subjectRegexp or githubWorkflow")
+	}
+	for _, req := range spec.Requirements {
+		if req.PredicateType == "" || req.Count < 1 {
+			return base, fmt.Errorf("invalid requirement %s:%d, expected a predicate type and a positive count", req.PredicateType, req.Count)
+		}
+	}
+	opts := base
+	if spec.Issuer != "" {
+		opts.OIDCIssuer = spec.Issuer
+	}
+	opts.Subject = spec.Subject
+	opts.SubjectRegexp = spec.SubjectRegexp
+	opts.GitHubWorkflow = spec.GitHubWorkflow
+	opts.GitHubReusableWorkflow = ""
+	opts.PredicateTypes = spec.PredicateTypes
+	opts.Requirements = spec.Requirements
+	if err := applyGitHubWorkflows(&opts); err != nil {
+		return base, err
+	}
+	return opts, nil
+}
+
+// policyStore keeps the ImageVerificationPolicies of the cluster up to date by watching them
+type policyStore struct {
+	client *kubeClient
+
+	mu       sync.RWMutex
+	policies map[string]ImageVerificationPolicy
+}
+
+func newPolicyStore() (*policyStore, error) {
+	client, err := newInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	return &policyStore{client: client, policies: map[string]ImageVerificationPolicy{}}, nil
+}
+
+// sync lists the policies once, so that the webhook doesn't serve before knowing them, then keeps
+// watching them in the background until ctx is done
+func (s *policyStore) sync(ctx context.Context) error {
+	resourceVersion, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	go s.watch(ctx, resourceVersion)
+	return nil
+}
+
+// list replaces the policies with the current ones and returns the resource version to watch from
+func (s *policyStore) list(ctx context.Context) (string, error) {
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []ImageVerificationPolicy `json:"items"`
+	}
+	if err := s.client.get(ctx, policyCollection, &list); err != nil {
+		return "", fmt.Errorf("failed to list ImageVerificationPolicies: %w", err)
+	}
+	policies := make(map[string]ImageVerificationPolicy, len(list.Items))
+	for _, policy := range list.Items {
+		policies[policy.Metadata.Name] = policy
+	}
+	s.mu.Lock()
+	s.policies = policies
+	s.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "loaded %d ImageVerificationPolicies\n", len(policies))
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes to the policies as they are made. When the watch fails, e.g. because
+// its resource version is too old, the policies are listed again.
+func (s *policyStore) watch(ctx context.Context, resourceVersion string) {
+	for {
+		err := s.client.watch(ctx, policyCollection, resourceVersion, func(event kubeWatchEvent) error {
+			var policy ImageVerificationPolicy
+			if err := json.Unmarshal(event.Object, &policy); err != nil {
+				return err
+			}
+			resourceVersion = policy.Metadata.ResourceVersion
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			switch event.Type {
+			case "ADDED", "MODIFIED":
+				s.policies[policy.Metadata.Name] = policy
+			case "DELETED":
+				delete(s.policies, policy.Metadata.Name)
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// the API server ended the watch, resume it where it stopped
+			continue
+		}
+		var statusErr *HTTPStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusGone {
+			fmt.Fprintf(os.Stderr, "failed to watch ImageVerificationPolicies: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(policyWatchRetry):
+		}
+		if rv, err := s.list(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		} else {
+			resourceVersion = rv
+		}
+	}
+}
+
+// matching returns the policies applying to an image of an object of the namespace, by name
+func (s *policyStore) matching(namespace, image string) []ImageVerificationPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matched []ImageVerificationPolicy
+	for _, policy := range s.policies {
+		if policy.appliesTo(namespace, image) {
+			matched = append(matched, policy)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Metadata.Name < matched[j].Metadata.Name })
+	return matched
+}
+
+// imageTarget is an image of an object of a namespace
+type imageTarget struct {
+	namespace string
+	image     string
+}
+
+// verifyTargets verifies each image against the ImageVerificationPolicies applying to it, all of
+// which must pass, and the images no policy applies to against the policy of the flags. An image is
+// verified once per policy however many namespaces it is used in.
+func (s *admissionServer) verifyTargets(ctx context.Context, targets []imageTarget) []ImageResult {
+	trustedRoot := s.trust.TrustedRoot()
+	if s.policies == nil {
+		images := make([]string, len(targets))
+		for i, target := range targets {
+			images[i] = target.image
+		}
+		return verifyImagesConcurrently(ctx, images, s.opts, trustedRoot)
+	}
+
+	// the policies of each target, and the images of each policy, "" standing for the flags
+	targetPolicies := make([][]string, len(targets))
+	policyImages := map[string][]string{}
+	policyOpts := map[string]VerificationOptions{"": s.opts}
+	policyErrs := map[string]error{}
+	for i, target := range targets {
+		matched := s.policies.matching(target.namespace, target.image)
+		if len(matched) == 0 {
+			targetPolicies[i] = []string{""}
+		}
+		for _, policy := range matched {
+			name := policy.Metadata.Name
+			targetPolicies[i] = append(targetPolicies[i], name)
+			if _, ok := policyOpts[name]; !ok {
+				policyOpts[name], policyErrs[name] = policy.options(s.opts)
+			}
+		}
+		for _, name := range targetPolicies[i] {
+			if !slices.Contains(policyImages[name], target.image) {
+				policyImages[name] = append(policyImages[name], target.image)
+			}
+		}
+	}
+
+	outcomes := map[string]ImageResult{}
+	for name, images := range policyImages {
+		if err := policyErrs[name]; err != nil {
+			// an invalid policy fails its images rather than leaving them unverified
+			for _, image := range images {
+				outcomes[name+"\x00"+image] = ImageResult{Image: image, Err: fmt.Errorf("invalid ImageVerificationPolicy %s: %w", name, err)}
+			}
+			continue
+		}
+		for _, outcome := range verifyImagesConcurrently(ctx, images, policyOpts[name], trustedRoot) {
+			outcomes[name+"\x00"+outcome.Image] = outcome
+		}
+	}
+
+	results := make([]ImageResult, len(targets))
+	for i, target := range targets {
+		results[i] = mergePolicyOutcomes(target.image, targetPolicies[i], outcomes)
+	}
+	return results
+}
+
+// mergePolicyOutcomes combines the outcomes of an image against several policies: the image fails
+// if any policy fails, and is admitted unverified if any policy tolerated an infrastructure error
+func mergePolicyOutcomes(image string, policies []string, outcomes map[string]ImageResult) ImageResult {
+	merged := ImageResult{Image: image}
+	var failures []string
+	for _, name := range policies {
+		outcome := outcomes[name+"\x00"+image]
+		if outcome.Err != nil {
+			if name == "" {
+				failures = append(failures, outcome.Err.Error())
+			} else {
+				failures = append(failures, fmt.Sprintf("policy %s: %v", name, outcome.Err))
+			}
+			continue
+		}
+		merged.Results = append(merged.Results, outcome.Results...)
+		if merged.Warning == nil {
+			merged.Warning = outcome.Warning
+		}
+		if merged.Skipped == nil {
+			merged.Skipped = outcome.Skipped
+		}
+	}
+	if len(failures) > 0 {
+		return ImageResult{Image: image, Err: errors.New(strings.Join(failures, "; "))}
+	}
+	return merged
+}
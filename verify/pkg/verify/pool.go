@@ -0,0 +1,173 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// maxPooledBufferSize bounds the buffers kept for reuse, so that an unusually large bundle doesn't
+// stay in memory for the life of the process
+const maxPooledBufferSize = 1 << 20
+
+// bundleBuffers holds the buffers bundle layers are read into. Parsing a bundle copies what it keeps,
+// so the buffer is reused once the bundle is parsed.
+var bundleBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// readBundleLayer reads at most maxSize+1 bytes of r into a pooled buffer sized for the declared
+// size of the layer, which the caller returns with releaseBundleBuffer
+func readBundleLayer(r io.Reader, size, maxSize int64) (*bytes.Buffer, error) {
+	buf := bundleBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	if size > 0 && size <= maxSize {
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(io.LimitReader(r, maxSize+1)); err != nil {
+		releaseBundleBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+func releaseBundleBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bundleBuffers.Put(buf)
+	}
+}
+
+// verifierCache keeps the verifiers built for the current trusted root, one per --key and
+// --require-sct, since building one parses the trusted material and may fetch the key from a KMS.
+// Verifiers are safe for concurrent use. It also keeps the identity lists, so that they are read
+// once rather than for every image. A new trusted root, e.g. after a refresh of the TrustProvider,
+// drops both, which also picks up edited identity lists.
+type verifierCache struct {
+	mu            sync.Mutex
+	trustedRoot   *root.TrustedRoot
+	verifiers     map[string]*verify.Verifier
+	identityLists map[string]IdentityList
+}
+
+var verifiers verifierCache
+
+func (c *verifierCache) get(ctx context.Context, trustedRoot *root.TrustedRoot, opts VerificationOptions) (*verify.Verifier, error) {
+	key := fmt.Sprintf("%s\x00%t", opts.Key, opts.requireSCT())
+	c.mu.Lock()
+	if c.trustedRoot != trustedRoot {
+		c.trustedRoot = trustedRoot
+		c.verifiers = map[string]*verify.Verifier{}
+		c.identityLists = map[string]IdentityList{}
+	}
+	verifier, ok := c.verifiers[key]
+	c.mu.Unlock()
+	if ok {
+		return verifier, nil
+	}
+
+	trustedMaterial, err := keyTrustedMaterial(ctx, trustedRoot, opts)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err = verify.NewVerifier(trustedMaterial, buildVerifyOptions(opts, trustedRoot)...)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.trustedRoot == trustedRoot {
+		c.verifiers[key] = verifier
+	}
+	c.mu.Unlock()
+	return verifier, nil
+}
+
+// identityList returns the identity list at path, read once for the current trusted root
+func (c *verifierCache) identityList(path string) (IdentityList, error) {
+	c.mu.Lock()
+	list, ok := c.identityLists[path]
+	c.mu.Unlock()
+	if ok {
+		return list, nil
+	}
+
+	list, err := loadIdentityList(path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.identityLists == nil {
+		c.identityLists = map[string]IdentityList{}
+	}
+	c.identityLists[path] = list
+	c.mu.Unlock()
+	return list, nil
+}
+
+// registryTransportTTL is how long an authenticated registry transport is reused. The bearer
+// transport renews its token when the registry rejects it, the TTL only bounds the cache.
+const registryTransportTTL = 10 * time.Minute
+
+type registryTransportKey struct {
+	registry string
+	scope    string
+	auth     authn.AuthConfig
+}
+
+type cachedTransport struct {
+	transport http.RoundTripper
+	created   time.Time
+}
+
+// registryTransports reuses the authenticated transports of registries across verifications, which
+// would otherwise ping the registry and fetch a token for every manifest and referrers request
+var registryTransports struct {
+	mu         sync.Mutex
+	transports map[registryTransportKey]cachedTransport
+}
+
+// authenticatedTransport returns an authenticated transport for a repository of a registry, with the
+// credentials of the keychain of ctx
+func authenticatedTransport(ctx context.Context, registry name.Registry, scope string) (http.RoundTripper, error) {
+	auth, err := contextKeychain(ctx).Resolve(registry)
+	if err != nil {
+		return nil, err
+	}
+	config, err := auth.Authorization()
+	if err != nil {
+		return nil, err
+	}
+	key := registryTransportKey{registry: registry.String(), scope: scope, auth: *config}
+
+	registryTransports.mu.Lock()
+	cached, ok := registryTransports.transports[key]
+	registryTransports.mu.Unlock()
+	if ok && time.Since(cached.created) < registryTransportTTL {
+		return cached.transport, nil
+	}
+
+	tr, err := transport.NewWithContext(ctx, registry, auth, remote.DefaultTransport, []string{scope})
+	if err != nil {
+		return nil, err
+	}
+	registryTransports.mu.Lock()
+	defer registryTransports.mu.Unlock()
+	if registryTransports.transports == nil {
+		registryTransports.transports = map[registryTransportKey]cachedTransport{}
+	}
+	for k, t := range registryTransports.transports {
+		if time.Since(t.created) >= registryTransportTTL {
+			delete(registryTransports.transports, k)
+		}
+	}
+	registryTransports.transports[key] = cachedTransport{transport: tr, created: time.Now()}
+	return tr, nil
+}
@@ -0,0 +1,264 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/spf13/cobra"
+)
+
+// preflightTimeout bounds each preflight check, so that an unreachable endpoint fails the check
+// instead of hanging the startup of serve
+const preflightTimeout = 30 * time.Second
+
+// preflightDigest stands in for the image digest when the policy is built without an image
+var preflightDigest = v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}
+
+// PreflightCheck is the outcome of one preflight check
+type PreflightCheck struct {
+	Name   string
+	Detail string
+	// Skipped is set for the checks the options don't need, e.g. the GitHub API without the github source
+	Skipped bool
+	Err     error
+}
+
+func newPreflightCommand() *cobra.Command {
+	fs := flag.NewFlagSet("preflight", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	var images stringsFlag
+	fs.Var(&images, "image", "image to look up the attestations of, checking that its registry is reachable with the configured credentials (repeatable)")
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "preflight",
+		Short: "Check the configuration, trusted root, registries and GitHub API before verifying",
+		Long: `Check that verification can work with the given flags, without verifying anything: the bundle
+sources and policy are valid, the trusted root can be refreshed through TUF, the GitHub API and Rekor
+are reachable with the configured credentials when the bundle sources need them, and the registries
+of the --image references serve their attestations. Every check is printed, and the command fails
+when one of them does. serve runs the same checks on startup.`,
+		Example: "  preflight --subject-regexp '^https://github.com/nirmata/.*$' --image ghcr.io/nirmata/github-signing-demo:latest\n  preflight --source github --github-repo nirmata/github-signing-demo --github-workflow nirmata/github-signing-demo/.github/workflows/build-attested-image.yaml@refs/heads/main",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if err := validateOnError(opts.OnError); err != nil {
+			return err
+		}
+		checks := runPreflight(context.TODO(), opts, images)
+		return writePreflight(os.Stdout, checks)
+	})
+}
+
+// runPreflight runs every preflight check, going on after a failed check so that all the problems
+// are reported at once
+func runPreflight(ctx context.Context, opts VerificationOptions, images []string) []PreflightCheck {
+	checks := []PreflightCheck{preflightSources(opts)}
+	trustedRoot, check := preflightTrustedRoot(ctx, opts)
+	checks = append(checks, check, preflightPolicy(ctx, trustedRoot, opts), preflightGitHubAPI(ctx, opts), preflightRekor(ctx, opts))
+	for _, image := range images {
+		checks = append(checks, preflightImage(ctx, image, opts))
+	}
+	return checks
+}
+
+func preflightSources(opts VerificationOptions) PreflightCheck {
+	check := PreflightCheck{Name: "bundle sources"}
+	sources, err := newBundleSources(opts)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		names = append(names, source.Name())
+	}
+	check.Detail = strings.Join(names, ", ")
+	return check
+}
+
+func preflightTrustedRoot(ctx context.Context, opts VerificationOptions) (*root.TrustedRoot, PreflightCheck) {
+	check := PreflightCheck{Name: "trusted root"}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	trustedRoot, err := getTrustedRoot(ctx, opts)
+	if err != nil {
+		check.Err = err
+		return nil, check
+	}
+	switch {
+	case opts.TrustedRootPath != "":
+		check.Detail = "read from " + opts.TrustedRootPath
+	default:
+		mirror := tufMirror(opts)
+		check.Detail = "refreshed from " + mirror
+		if expires, err := cachedRootExpiry(mirror); err == nil {
+			check.Detail += fmt.Sprintf(", tuf root expires %s", expires.Format(time.DateOnly))
+		}
+	}
+	check.Detail += fmt.Sprintf(", %d Fulcio CAs, %d Rekor logs, %d timestamp authorities", len(trustedRoot.FulcioCertificateAuthorities()), len(trustedRoot.RekorLogs()), len(trustedRoot.TimestampingAuthorities()))
+	return trustedRoot, check
+}
+
+// preflightPolicy builds the verifier of a placeholder digest, which compiles the identity
+// patterns, loads the identity lists and the key, and checks the transparency logs
+func preflightPolicy(ctx context.Context, trustedRoot *root.TrustedRoot, opts VerificationOptions) PreflightCheck {
+	check := PreflightCheck{Name: "policy"}
+	if trustedRoot == nil {
+		check.Skipped, check.Detail = true, "no trusted root"
+		return check
+	}
+	if _, err := newBundleVerifier(ctx, "preflight", &v1.Descriptor{Digest: preflightDigest}, trustedRoot, opts); err != nil {
+		check.Err = err
+		return check
+	}
+	switch {
+	case opts.Key != "":
+		check.Detail = "signed with " + opts.Key
+	case opts.Subject != "":
+		check.Detail = "subject " + opts.Subject
+	case opts.SubjectRegexp != "":
+		check.Detail = "subject matching " + opts.SubjectRegexp
+	case opts.IdentityAllowlist != "":
+		check.Detail = "identities of " + opts.IdentityAllowlist
+	default:
+		check.Detail = "any signer"
+	}
+	return check
+}
+
+// preflightGitHubAPI reads the rate limit of the token, which needs no permission, to check that
+// the API is reachable and the token valid
+func preflightGitHubAPI(ctx context.Context, opts VerificationOptions) PreflightCheck {
+	check := PreflightCheck{Name: "github api"}
+	if !slices.Contains(opts.Sources, "github") && opts.GitHubAppID == "" && opts.GitHubTokenExchangeURL == "" {
+		check.Skipped, check.Detail = true, "the github source is not used"
+		return check
+	}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	token, err := opts.gitHubToken(ctx)
+	if err != nil {
+		check.Err = fmt.Errorf("failed to get a GitHub token: %w", err)
+		return check
+	}
+	endpoint := strings.TrimSuffix(opts.GitHubAPIURL, "/") + "/rate_limit"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check.Err = newHTTPStatusError(resp, "failed to reach %s", endpoint)
+		return check
+	}
+	var rateLimit struct {
+		Rate struct {
+			Limit     int `json:"limit"`
+			Remaining int `json:"remaining"`
+		} `json:"rate"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rateLimit); err != nil {
+		check.Err = fmt.Errorf("failed to decode the rate limit: %w", err)
+		return check
+	}
+	authentication := "authenticated"
+	if token == "" {
+		authentication = "unauthenticated"
+	}
+	check.Detail = fmt.Sprintf("%s %s, %d of %d requests left", authentication, opts.GitHubAPIURL, rateLimit.Rate.Remaining, rateLimit.Rate.Limit)
+	if rateLimit.Rate.Remaining == 0 {
+		check.Err = fmt.Errorf("%s: rate limit exhausted", check.Detail)
+	}
+	return check
+}
+
+func preflightRekor(ctx context.Context, opts VerificationOptions) PreflightCheck {
+	check := PreflightCheck{Name: "rekor"}
+	if !slices.Contains(opts.Sources, "rekor") && !opts.EnableRekorSearch {
+		check.Skipped, check.Detail = true, "the rekor source is not used"
+		return check
+	}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	endpoint := strings.TrimSuffix(opts.RekorURL, "/") + "/api/v1/log"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check.Err = newHTTPStatusError(resp, "failed to reach %s", endpoint)
+		return check
+	}
+	check.Detail = opts.RekorURL
+	return check
+}
+
+// preflightImage looks up the attestations of an image, which needs the registry to be reachable
+// and the credentials to allow pulling the image and listing its referrers
+func preflightImage(ctx context.Context, image string, opts VerificationOptions) PreflightCheck {
+	check := PreflightCheck{Name: "image " + image}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	bundles, desc, err := resolveBundles(ctx, image, opts)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s, %d bundles", desc.Digest, len(bundles))
+	return check
+}
+
+// writePreflight prints the checks, and fails when one of them did
+func writePreflight(w io.Writer, checks []PreflightCheck) error {
+	failed := 0
+	for _, check := range checks {
+		switch {
+		case check.Err != nil:
+			failed++
+			fmt.Fprintf(w, "✗ %s: %v\n", check.Name, check.Err)
+		case check.Skipped:
+			fmt.Fprintf(w, "- %s: skipped, %s\n", check.Name, check.Detail)
+		default:
+			fmt.Fprintf(w, "✓ %s: %s\n", check.Name, check.Detail)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d preflight checks failed", failed, len(checks))
+	}
+	return nil
+}
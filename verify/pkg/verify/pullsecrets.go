@@ -0,0 +1,232 @@
+package verify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// pullSecretTTL is how long a pull secret or service account is cached, so that re-verifying every
+// pod of a namespace doesn't read its secrets once per pod
+const pullSecretTTL = time.Minute
+
+// pullSecretResolver reads the registry credentials of pods from their imagePullSecrets and those
+// of their service account, the credentials the kubelet pulls their images with
+type pullSecretResolver struct {
+	client *kubeClient
+
+	mu    sync.Mutex
+	cache map[string]cachedObject
+}
+
+type cachedObject struct {
+	data    []byte
+	expires time.Time
+}
+
+func newPullSecretResolver() (*pullSecretResolver, error) {
+	client, err := newInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	return &pullSecretResolver{client: client, cache: map[string]cachedObject{}}, nil
+}
+
+// keychain returns the credentials of the pull secrets of the pods of the objects, e.g. a Pod or a
+// Deployment, of a namespace, with the default keychain as a fallback. Secrets that don't exist are
+// ignored, like the kubelet does.
+func (r *pullSecretResolver) keychain(ctx context.Context, namespace string, objects ...any) (authn.Keychain, error) {
+	var secrets, serviceAccounts []string
+	for _, object := range objects {
+		for _, spec := range podSpecs(object) {
+			if refs, ok := spec["imagePullSecrets"].([]any); ok {
+				for _, ref := range refs {
+					if ref, ok := ref.(map[string]any); ok {
+						if name, _ := ref["name"].(string); name != "" {
+							secrets = append(secrets, name)
+						}
+					}
+				}
+			}
+			serviceAccount, _ := spec["serviceAccountName"].(string)
+			if serviceAccount == "" {
+				serviceAccount = "default"
+			}
+			serviceAccounts = append(serviceAccounts, serviceAccount)
+		}
+	}
+	slices.Sort(serviceAccounts)
+	for _, serviceAccount := range slices.Compact(serviceAccounts) {
+		var account struct {
+			ImagePullSecrets []struct {
+				Name string `json:"name"`
+			} `json:"imagePullSecrets"`
+		}
+		found, err := r.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/serviceaccounts/%s", namespace, serviceAccount), &account)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account %s/%s: %w", namespace, serviceAccount, err)
+		}
+		if found {
+			for _, ref := range account.ImagePullSecrets {
+				secrets = append(secrets, ref.Name)
+			}
+		}
+	}
+
+	credentials := dockerConfigKeychain{}
+	slices.Sort(secrets)
+	for _, secretName := range slices.Compact(secrets) {
+		var secret struct {
+			Type string            `json:"type"`
+			Data map[string]string `json:"data"`
+		}
+		found, err := r.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", namespace, secretName), &secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pull secret %s/%s: %w", namespace, secretName, err)
+		}
+		if !found {
+			continue
+		}
+		if err := credentials.add(secret.Type, secret.Data); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring pull secret %s/%s: %v\n", namespace, secretName, err)
+		}
+	}
+	if len(credentials) == 0 {
+		return keychain, nil
+	}
+	return authn.NewMultiKeychain(credentials, keychain), nil
+}
+
+// get reads an object through the cache, reporting whether it exists
+func (r *pullSecretResolver) get(ctx context.Context, path string, out any) (bool, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[path]
+	r.mu.Unlock()
+	if !ok || time.Now().After(cached.expires) {
+		var raw json.RawMessage
+		err := r.client.get(ctx, path, &raw)
+		if err != nil && !isKubeNotFound(err) {
+			return false, err
+		}
+		cached = cachedObject{data: raw, expires: time.Now().Add(pullSecretTTL)}
+		r.mu.Lock()
+		r.cache[path] = cached
+		r.mu.Unlock()
+	}
+	if cached.data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(cached.data, out)
+}
+
+// podSpecs returns the pod specs of an object: the spec of a Pod, or the pod template of a workload,
+// found as the maps holding the containers
+func podSpecs(node any) []map[string]any {
+	var specs []map[string]any
+	switch v := node.(type) {
+	case map[string]any:
+		if _, ok := v["containers"].([]any); ok {
+			return []map[string]any{v}
+		}
+		for _, value := range v {
+			specs = append(specs, podSpecs(value)...)
+		}
+	case []any:
+		for _, item := range v {
+			specs = append(specs, podSpecs(item)...)
+		}
+	}
+	return specs
+}
+
+// dockerConfigKeychain holds the credentials of docker config pull secrets by registry host
+type dockerConfigKeychain map[string]authn.AuthConfig
+
+// add reads the credentials of a kubernetes.io/dockerconfigjson or kubernetes.io/dockercfg secret
+func (k dockerConfigKeychain) add(secretType string, data map[string]string) error {
+	var key string
+	switch secretType {
+	case "kubernetes.io/dockerconfigjson":
+		key = ".dockerconfigjson"
+	case "kubernetes.io/dockercfg":
+		key = ".dockercfg"
+	default:
+		return fmt.Errorf("unsupported secret type %q", secretType)
+	}
+	raw, err := base64.StdEncoding.DecodeString(data[key])
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	var auths map[string]authn.AuthConfig
+	if key == ".dockerconfigjson" {
+		var config struct {
+			Auths map[string]authn.AuthConfig `json:"auths"`
+		}
+		err = json.Unmarshal(raw, &config)
+		auths = config.Auths
+	} else {
+		err = json.Unmarshal(raw, &auths)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	for server, auth := range auths {
+		if auth.Auth != "" && auth.Username == "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return fmt.Errorf("invalid auth of %s: %w", server, err)
+			}
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+			auth.Auth = ""
+		}
+		host := dockerConfigHost(server)
+		if _, ok := k[host]; !ok {
+			k[host] = auth
+		}
+	}
+	return nil
+}
+
+func (k dockerConfigKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if auth, ok := k[dockerConfigHost(target.RegistryStr())]; ok {
+		return authn.FromConfig(auth), nil
+	}
+	return authn.Anonymous, nil
+}
+
+// dockerConfigHost is the registry host of a docker config key, which can be a URL like
+// https://index.docker.io/v1/ or a host with a path
+func dockerConfigHost(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host, _, _ := strings.Cut(server, "/")
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return name.DefaultRegistry
+	}
+	return host
+}
+
+// keychainContextKey holds the keychain of the images verified with a context
+type keychainContextKey struct{}
+
+// withKeychain makes the registry requests made with ctx use the credentials of kc
+func withKeychain(ctx context.Context, kc authn.Keychain) context.Context {
+	return context.WithValue(ctx, keychainContextKey{}, kc)
+}
+
+// contextKeychain returns the keychain of ctx, by default the keychain of the profiles
+func contextKeychain(ctx context.Context) authn.Keychain {
+	if kc, ok := ctx.Value(keychainContextKey{}).(authn.Keychain); ok {
+		return kc
+	}
+	return keychain
+}
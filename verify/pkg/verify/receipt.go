@@ -0,0 +1,289 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/sign"
+)
+
+const (
+	receiptPredicateType = "https://github.com/nirmata/github-signing-demo/verification-receipt/v1"
+	defaultFulcioURL     = "https://fulcio.sigstore.dev"
+	bundleV03MediaType   = "application/vnd.dev.sigstore.bundle.v0.3+json"
+	emptyJSONMediaType   = "application/vnd.oci.empty.v1+json"
+)
+
+// ReceiptOptions configures the signed verification receipt
+type ReceiptOptions struct {
+	Path    string
+	Attach  bool
+	Signing SigningOptions
+}
+
+// SigningOptions configure keyless signing with a Fulcio certificate, by receipts and attest
+type SigningOptions struct {
+	IdentityToken string
+	FulcioURL     string
+	OIDCProvider  string
+	OIDCClientID  string
+	DeviceFlow    bool
+}
+
+// ReceiptPredicate records what was verified, against which policy, and by which verifier
+type ReceiptPredicate struct {
+	Verifier     ReceiptVerifier      `json:"verifier"`
+	VerifiedAt   time.Time            `json:"verifiedAt"`
+	Policy       ReceiptPolicy        `json:"policy"`
+	Attestations []ReceiptAttestation `json:"attestations"`
+}
+
+type ReceiptVerifier struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type ReceiptPolicy struct {
+	Issuer         string        `json:"issuer"`
+	Subject        string        `json:"subject,omitempty"`
+	SubjectRegexp  string        `json:"subjectRegexp,omitempty"`
+	Key            string        `json:"key,omitempty"`
+	PredicateTypes []string      `json:"predicateTypes,omitempty"`
+	Requirements   []Requirement `json:"requirements,omitempty"`
+	MinIdentities  int           `json:"minIdentities,omitempty"`
+	Assertions     []string      `json:"assertions,omitempty"`
+	MaxAge         string        `json:"maxAttestationAge,omitempty"`
+	MinSigningTime string        `json:"minSigningTime,omitempty"`
+	MaxSigningTime string        `json:"maxSigningTime,omitempty"`
+	Algorithms     []string      `json:"allowedSignatureAlgorithms,omitempty"`
+}
+
+type ReceiptAttestation struct {
+	PredicateType string `json:"predicateType,omitempty"`
+	Signer        string `json:"signer,omitempty"`
+	TlogIndex     *int64 `json:"tlogIndex,omitempty"`
+}
+
+func addReceiptFlags(fs *flag.FlagSet, ropts *ReceiptOptions) {
+	fs.StringVar(&ropts.Path, "receipt", "", "write a signed verification receipt bundle to this path after a successful verification")
+	fs.BoolVar(&ropts.Attach, "attach-receipt", false, "attach the signed verification receipt to the image as a referrer")
+	addSigningFlags(fs, &ropts.Signing)
+}
+
+// addSigningFlags registers the flags selecting the identity and Fulcio instance of keyless signing
+func addSigningFlags(fs *flag.FlagSet, sopts *SigningOptions) {
+	fs.StringVar(&sopts.IdentityToken, "identity-token", "", "OIDC token to sign with (default $SIGSTORE_ID_TOKEN, the GitHub Actions token, or an interactive login outside CI)")
+	fs.StringVar(&sopts.OIDCProvider, "oidc-provider", defaultOIDCProvider, "OIDC provider to log in to when no identity token is available")
+	fs.StringVar(&sopts.OIDCClientID, "oidc-client-id", defaultOIDCClientID, "OIDC client ID used to log in")
+	fs.BoolVar(&sopts.DeviceFlow, "oidc-device-flow", false, "log in with a device code instead of opening a browser, e.g. over SSH")
+	fs.StringVar(&sopts.FulcioURL, "fulcio-url", defaultFulcioURL, "Fulcio instance issuing the signing certificate")
+}
+
+func (r ReceiptOptions) enabled() bool {
+	return r.Path != "" || r.Attach
+}
+
+// receiptPolicy describes the policy the options enforce
+func receiptPolicy(opts VerificationOptions) ReceiptPolicy {
+	policy := ReceiptPolicy{
+		Issuer:         opts.OIDCIssuer,
+		Subject:        opts.Subject,
+		SubjectRegexp:  opts.SubjectRegexp,
+		Key:            opts.Key,
+		PredicateTypes: opts.PredicateTypes,
+		Requirements:   opts.requirements(),
+		MinIdentities:  opts.MinIdentities,
+		MaxAge:         opts.MaxAttestationAge.String(),
+		MinSigningTime: opts.MinSigningTime.String(),
+		MaxSigningTime: opts.MaxSigningTime.String(),
+		Algorithms:     opts.SignatureAlgorithms,
+	}
+	for _, assertion := range opts.Assertions {
+		policy.Assertions = append(policy.Assertions, assertion.Expr)
+	}
+	return policy
+}
+
+// newReceiptStatement builds the in-toto statement recording a successful verification
+func newReceiptStatement(image string, desc *v1.Descriptor, results []VerificationResult, opts VerificationOptions) *in_toto.Statement {
+	predicate := ReceiptPredicate{
+		Verifier:   ReceiptVerifier{Name: "github-signing-demo-verify", Version: version},
+		VerifiedAt: time.Now().UTC(),
+		Policy:     receiptPolicy(opts),
+	}
+	for _, result := range results {
+		attestation := ReceiptAttestation{}
+		if result.Bundle.DSSE_Envelope != nil {
+			attestation.PredicateType = result.Bundle.DSSE_Envelope.PredicateType
+		}
+		if signer, ok := signerSummary(result.Bundle); ok {
+			attestation.Signer = signer.SubjectAlternativeName
+		}
+		if entries := result.Bundle.ProtoBundle.Bundle.GetVerificationMaterial().GetTlogEntries(); len(entries) > 0 {
+			attestation.TlogIndex = &entries[0].LogIndex
+		}
+		predicate.Attestations = append(predicate.Attestations, attestation)
+	}
+
+	return &in_toto.Statement{
+		StatementHeader: in_toto.StatementHeader{
+			Type:          "https://in-toto.io/Statement/v1",
+			PredicateType: receiptPredicateType,
+			Subject:       []in_toto.Subject{statementSubject(image, desc)},
+		},
+		Predicate: predicate,
+	}
+}
+
+// statementSubject names the image of a statement by its repository, and its digest
+func statementSubject(image string, desc *v1.Descriptor) in_toto.Subject {
+	name := image
+	if ref, err := parseImageReference(image); err == nil {
+		name = ref.Context().Name()
+	}
+	return in_toto.Subject{Name: name, Digest: map[string]string{desc.Digest.Algorithm: desc.Digest.Hex}}
+}
+
+// signStatement signs the statement with an ephemeral key and a Fulcio certificate, and records the
+// signature in Rekor
+func signStatement(ctx context.Context, statement *in_toto.Statement, sopts SigningOptions, rekorURL string, trustedRoot *root.TrustedRoot) (*bundle.ProtobufBundle, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	token, err := getIdentityToken(ctx, sopts)
+	if err != nil {
+		return nil, err
+	}
+	keypair, err := sign.NewEphemeralKeypair(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pb, err := sign.Bundle(&sign.DSSEData{Data: payload, PayloadType: inTotoPayloadType}, keypair, sign.BundleOptions{
+		CertificateProvider:        sign.NewFulcio(&sign.FulcioOptions{BaseURL: sopts.FulcioURL}),
+		CertificateProviderOptions: &sign.CertificateProviderOptions{IDToken: token},
+		TransparencyLogs:           []sign.Transparency{sign.NewRekor(&sign.RekorOptions{BaseURL: rekorURL})},
+		Context:                    ctx,
+		TrustedRoot:                trustedRoot,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bundle.NewProtobufBundle(pb)
+}
+
+// emitReceipt signs a receipt for the verified image, then writes and attaches it as requested
+func emitReceipt(ctx context.Context, image string, desc *v1.Descriptor, results []VerificationResult, ropts ReceiptOptions, opts VerificationOptions, trustedRoot *root.TrustedRoot) error {
+	receipt, err := signStatement(ctx, newReceiptStatement(image, desc, results, opts), ropts.Signing, opts.RekorURL, trustedRoot)
+	if err != nil {
+		return fmt.Errorf("failed to sign verification receipt: %w", err)
+	}
+	receiptBytes, err := receipt.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	if ropts.Path != "" {
+		if err := os.WriteFile(ropts.Path, receiptBytes, 0o644); err != nil {
+			return fmt.Errorf("failed to write verification receipt: %w", err)
+		}
+	}
+	if ropts.Attach {
+		if err := attachToImage(ctx, image, desc, receiptBytes); err != nil {
+			return fmt.Errorf("failed to attach verification receipt: %w", err)
+		}
+	}
+	return nil
+}
+
+// attachToImage pushes a bundle as a referrer of a registry image
+func attachToImage(ctx context.Context, image string, desc *v1.Descriptor, bundleBytes []byte) error {
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return fmt.Errorf("bundles can only be attached to registry images: %w", err)
+	}
+	if ref, err = pushReference(ref); err != nil {
+		return err
+	}
+	if desc.MediaType == "" {
+		// descriptors resolved from a digest reference lack the media type and size of the subject
+		if desc, err = fetchArtifactDescriptor(ctx, ref, desc.Digest.Algorithm); err != nil {
+			return fmt.Errorf("failed to resolve the image to attach the bundle to: %w", err)
+		}
+	}
+	return attachBundle(ctx, ref.Context(), desc, bundleBytes)
+}
+
+// referrerManifest is an OCI artifact manifest holding a single bundle layer
+type referrerManifest struct {
+	raw []byte
+}
+
+func (m referrerManifest) RawManifest() ([]byte, error) { return m.raw, nil }
+
+func (m referrerManifest) MediaType() (types.MediaType, error) { return types.OCIManifestSchema1, nil }
+
+// attachBundle pushes a bundle as an OCI artifact whose subject is the image
+func attachBundle(ctx context.Context, repo name.Repository, subject *v1.Descriptor, bundleBytes []byte) error {
+	remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain), remote.WithContext(ctx)}
+
+	config := static.NewLayer([]byte("{}"), emptyJSONMediaType)
+	layer := static.NewLayer(bundleBytes, bundleV03MediaType)
+	for _, l := range []v1.Layer{config, layer} {
+		if err := remote.WriteLayer(repo, l, remoteOpts...); err != nil {
+			return err
+		}
+	}
+
+	configDesc, err := layerDescriptor(config, emptyJSONMediaType)
+	if err != nil {
+		return err
+	}
+	layerDesc, err := layerDescriptor(layer, bundleV03MediaType)
+	if err != nil {
+		return err
+	}
+	manifest := map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     types.OCIManifestSchema1,
+		"artifactType":  bundleV03MediaType,
+		"config":        configDesc,
+		"layers":        []v1.Descriptor{layerDesc},
+		"subject":       v1.Descriptor{MediaType: subject.MediaType, Digest: subject.Digest, Size: subject.Size},
+	}
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	digest, _, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	return remote.Put(repo.Digest(digest.String()), referrerManifest{raw: raw}, remoteOpts...)
+}
+
+func layerDescriptor(layer v1.Layer, mediaType types.MediaType) (v1.Descriptor, error) {
+	digest, err := layer.Digest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return v1.Descriptor{MediaType: mediaType, Digest: digest, Size: size}, nil
+}
@@ -0,0 +1,148 @@
+package verify
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// digestSizes is the number of hex digits of each supported image digest algorithm
+var digestSizes = map[string]int{"sha256": 64, "sha512": 128}
+
+// parseImageReference parses an image reference like name.ParseReference, but also accepts sha512
+// digests, which go-containerregistry rejects, and Helm's oci:// chart references
+func parseImageReference(image string) (name.Reference, error) {
+	image = strings.TrimPrefix(image, helmReferencePrefix)
+	base, digest, ok := cutLast(image, "@")
+	if !ok || !strings.HasPrefix(digest, "sha512:") {
+		return name.ParseReference(image)
+	}
+	if _, err := parseDigest(digest); err != nil {
+		return nil, err
+	}
+	if tag, err := name.NewTag(base); err == nil {
+		base = tag.Repository.Name()
+	}
+	repo, err := name.NewRepository(base)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Digest(digest), nil
+}
+
+// parseDigest parses an image digest of any supported algorithm
+func parseDigest(digest string) (v1.Hash, error) {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	size, supported := digestSizes[algorithm]
+	if !ok || !supported {
+		return v1.Hash{}, fmt.Errorf("unsupported digest %q, expected sha256 or sha512", digest)
+	}
+	if len(hex) != size || strings.Trim(hex, "0123456789abcdef") != "" {
+		return v1.Hash{}, fmt.Errorf("invalid %s digest %q", algorithm, digest)
+	}
+	return v1.Hash{Algorithm: algorithm, Hex: hex}, nil
+}
+
+// computeDigest hashes content with a supported digest algorithm
+func computeDigest(algorithm string, content []byte) (v1.Hash, error) {
+	var sum []byte
+	switch algorithm {
+	case "sha256":
+		s := sha256.Sum256(content)
+		sum = s[:]
+	case "sha512":
+		s := sha512.Sum512(content)
+		sum = s[:]
+	default:
+		return v1.Hash{}, fmt.Errorf("unsupported digest algorithm %q, expected sha256 or sha512", algorithm)
+	}
+	return v1.Hash{Algorithm: algorithm, Hex: hex.EncodeToString(sum)}, nil
+}
+
+// digestAlgorithm returns the --digest-algorithm, which commands without the flag leave unset
+func (opts VerificationOptions) digestAlgorithm() string {
+	if opts.DigestAlgorithm == "" {
+		return "sha256"
+	}
+	return opts.DigestAlgorithm
+}
+
+// normalizeImage returns the fully qualified form of an image reference, which is how the registry
+// names it, e.g. index.docker.io/library/nginx:1.25 for nginx:1.25. Local images and references
+// that don't parse are returned unchanged.
+func normalizeImage(image string) string {
+	if isLocalImage(image) {
+		return image
+	}
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return image
+	}
+	return ref.Name()
+}
+
+// imageNames returns the names an image is known by, so that patterns written against any of them
+// match: the reference as written, its normalized form and, for Docker Hub, the docker.io form
+// most documentation uses, e.g. docker.io/library/nginx:1.25
+func imageNames(image string) []string {
+	names := []string{image}
+	normalized := normalizeImage(image)
+	if normalized != image {
+		names = append(names, normalized)
+	}
+	if rest, ok := strings.CutPrefix(normalized, name.DefaultRegistry+"/"); ok && "docker.io/"+rest != image {
+		names = append(names, "docker.io/"+rest)
+	}
+	return names
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// stdinImage is the image argument that reads the image references from stdin instead
+const stdinImage = "-"
+
+// expandStdinImages replaces the - image argument with the whitespace-separated image references
+// read from stdin, e.g. piped from `crane ls` or `docker images --format`. Duplicates are dropped.
+func expandStdinImages(images []string, stdin io.Reader) ([]string, error) {
+	var expanded []string
+	read := false
+	for _, image := range images {
+		if image != stdinImage {
+			expanded = append(expanded, image)
+			continue
+		}
+		if read {
+			continue
+		}
+		read = true
+		scanner := bufio.NewScanner(stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		scanner.Split(bufio.ScanWords)
+		count := 0
+		for scanner.Scan() {
+			expanded = append(expanded, scanner.Text())
+			count++
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read image references from stdin: %w", err)
+		}
+		if count == 0 {
+			return nil, errors.New("no image references on stdin")
+		}
+	}
+	return uniqueImages(expanded), nil
+}
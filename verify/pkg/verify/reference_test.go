@@ -0,0 +1,38 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDigest(t *testing.T) {
+	sha256Hex := strings.Repeat("ab", 32)
+	sha512Hex := strings.Repeat("cd", 64)
+	tests := []struct {
+		name     string
+		digest   string
+		expected string
+	}{
+		{name: "sha256", digest: "sha256:" + sha256Hex},
+		{name: "sha512", digest: "sha512:" + sha512Hex},
+		{name: "unsupported algorithm", digest: "sha384:" + strings.Repeat("ab", 48), expected: "unsupported digest"},
+		{name: "no algorithm", digest: sha256Hex, expected: "unsupported digest"},
+		{name: "sha256 too short", digest: "sha256:" + sha256Hex[2:], expected: "invalid sha256 digest"},
+		{name: "sha512 of sha256 length", digest: "sha512:" + sha256Hex, expected: "invalid sha512 digest"},
+		{name: "uppercase hex", digest: "sha256:" + strings.ToUpper(sha256Hex), expected: "invalid sha256 digest"},
+		{name: "not hex", digest: "sha256:" + strings.Repeat("zz", 32), expected: "invalid sha256 digest"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := parseDigest(test.digest)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			case test.expected == "" && hash.String() != test.digest:
+				t.Fatalf("expected %s, got %s", test.digest, hash)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+)
+
+const (
+	sigstoreBundleArtifactTypePrefix = "application/vnd.dev.sigstore.bundle"
+	defaultMaxBundleSize             = 10 << 20
+)
+
+// OCIReferrersSource reads bundles attached to the image as OCI referrers. Referrers are listed
+// page by page and their bundles downloaded only when the caller asks for more.
+type OCIReferrersSource struct {
+	// Limit is the maximum number of bundle referrers downloaded for an image
+	Limit int
+	// ArtifactTypes are requested from the registry one at a time, so registries supporting the
+	// referrers filter only return matching descriptors. Any sigstore bundle is accepted when empty.
+	ArtifactTypes []string
+	// MaxBundleSize is the maximum size in bytes of a bundle layer, so that a compromised
+	// registry can't exhaust the verifier's memory
+	MaxBundleSize int64
+	// Annotations must all be set on a referrer descriptor for its bundle to be downloaded
+	Annotations map[string]string
+	// Timing accumulates the time spent listing referrers and downloading bundles
+	Timing *Timing
+}
+
+func (s *OCIReferrersSource) Name() string {
+	return "oci"
+}
+
+func (s *OCIReferrersSource) Bundles(ctx context.Context, ref name.Reference, desc *v1.Descriptor) ([]*Bundle, error) {
+	bundles := make([]*Bundle, 0)
+	err := s.StreamBundles(ctx, ref, desc, func(b *Bundle) (bool, error) {
+		bundles = append(bundles, b)
+		return true, nil
+	})
+	return bundles, err
+}
+
+func (s *OCIReferrersSource) StreamBundles(ctx context.Context, ref name.Reference, desc *v1.Descriptor, yield func(*Bundle) (bool, error)) error {
+	if ref == nil {
+		return errors.New("referrers can only be fetched for registry images, use --bundle-path for local images")
+	}
+
+	remoteOpts := []remote.Option{
+		remote.WithAuthFromKeychain(contextKeychain(ctx)),
+		remote.WithContext(ctx),
+	}
+
+	artifactTypes := s.ArtifactTypes
+	if len(artifactTypes) == 0 {
+		artifactTypes = []string{""}
+	}
+
+	fetched := 0
+	for _, artifactType := range artifactTypes {
+		more := true
+		// time between callbacks is spent listing referrers
+		lookupStart := time.Now()
+		err := listReferrers(ctx, ref.Context().Digest(desc.Digest.String()), artifactType, remoteOpts, func(manifestDesc v1.Descriptor) (bool, error) {
+			s.Timing.add(&s.Timing.Lookup, time.Since(lookupStart))
+			defer func() { lookupStart = time.Now() }()
+			if !matchesAnnotations(manifestDesc, s.Annotations) {
+				return true, nil
+			}
+			if fetched == s.Limit {
+				fmt.Fprintf(os.Stderr, "stopped fetching referrers of %s after --limit=%d bundles\n", ref, s.Limit)
+				more = false
+				return false, nil
+			}
+			fetched++
+			if err := checkBundleVersion(manifestDesc.ArtifactType); err != nil {
+				more, err = yield(unparsedBundle([]byte(manifestDesc.Digest.String()), manifestDesc.ArtifactType, err))
+				return more, err
+			}
+
+			downloadStart := time.Now()
+			b, err := fetchReferrerBundle(ref.Context().Digest(manifestDesc.Digest.String()), manifestDesc.ArtifactType, s.MaxBundleSize, remoteOpts)
+			if err != nil {
+				if ctx.Err() != nil {
+					return false, err
+				}
+				// one referrer failing to download, e.g. on a network error or a garbage collected
+				// manifest, doesn't keep the others from being verified
+				more, err = yield(unfetchedBundle(manifestDesc, err))
+				return more, err
+			}
+			b.Download = time.Since(downloadStart)
+			s.Timing.add(&s.Timing.Download, b.Download)
+			b.ArtifactType = manifestDesc.ArtifactType
+			more, err = yield(b)
+			return more, err
+		})
+		s.Timing.add(&s.Timing.Lookup, time.Since(lookupStart))
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// BundleFetchError is why the bundle of a referrer could not be downloaded
+type BundleFetchError struct {
+	Referrer v1.Hash
+	Err      error
+}
+
+func (e *BundleFetchError) Error() string {
+	return fmt.Sprintf("failed to fetch bundle %s: %v", e.Referrer, e.Err)
+}
+
+func (e *BundleFetchError) Unwrap() error {
+	return e.Err
+}
+
+// unfetchedBundle stands for a referrer whose bundle could not be downloaded, so that it is
+// reported as a failed bundle and the policy decides whether the other bundles are enough
+func unfetchedBundle(manifestDesc v1.Descriptor, err error) *Bundle {
+	sum := sha256.Sum256([]byte(manifestDesc.Digest.String()))
+	b := &Bundle{
+		ProtoBundle:  &bundle.ProtobufBundle{Bundle: &protobundle.Bundle{}},
+		ArtifactType: manifestDesc.ArtifactType,
+		ParseErr:     &BundleFetchError{Referrer: manifestDesc.Digest, Err: err},
+		id:           sum[:],
+	}
+	b.Version, _ = bundleMediaTypeVersion(manifestDesc.ArtifactType)
+	return b
+}
+
+// fetchReferrerBundle downloads the bundle layer of a referrer, rejecting layers that are not a
+// bundle or exceed maxSize
+func fetchReferrerBundle(digest name.Digest, artifactType string, maxSize int64, remoteOpts []remote.Option) (*Bundle, error) {
+	refImg, err := remote.Image(digest, remoteOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch referrer image: %w", err)
+	}
+	manifest, err := refImg.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch referrer manifest: %w", err)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("referrer %s has no layers", digest)
+	}
+	layerDesc := manifest.Layers[0]
+	if mediaType := string(layerDesc.MediaType); !strings.HasPrefix(mediaType, sigstoreBundleArtifactTypePrefix) && mediaType != artifactType {
+		return nil, fmt.Errorf("referrer %s layer has unexpected media type %s", digest, mediaType)
+	}
+	if layerDesc.Size > maxSize {
+		return nil, fmt.Errorf("referrer %s layer is %d bytes, exceeding the maximum bundle size of %d bytes", digest, layerDesc.Size, maxSize)
+	}
+
+	layer, err := refImg.LayerByDigest(layerDesc.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch referrer layer: %w", err)
+	}
+	layerBytes, err := layer.Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch referrer layer: %w", err)
+	}
+	defer layerBytes.Close()
+	// the declared size can't be trusted, read one byte past the limit to detect oversized layers
+	buf, err := readBundleLayer(layerBytes, layerDesc.Size, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch referrer layer: %w", err)
+	}
+	defer releaseBundleBuffer(buf)
+	bundleBytes := buf.Bytes()
+	if int64(len(bundleBytes)) > maxSize {
+		return nil, fmt.Errorf("referrer %s layer exceeds the maximum bundle size of %d bytes", digest, maxSize)
+	}
+	b, err := parseBundle(bundleBytes)
+	if err != nil {
+		return unparsedBundle(bundleBytes, artifactType, err), nil
+	}
+	return b, nil
+}
+
+// listReferrers yields the referrers of a digest with the given artifact type, or any sigstore
+// bundle when artifactType is empty. Pages of the referrers API are followed through their Link
+// header, the artifactType filter is applied client side when the registry does not report it in
+// OCI-Filters-Applied, and registries without the referrers API fall back to the tag schema. The
+// registry's profile can select either method.
+func listReferrers(ctx context.Context, digest name.Digest, artifactType string, remoteOpts []remote.Option, yield func(v1.Descriptor) (bool, error)) error {
+	registry := digest.Context().Registry
+	mode := registryProfile(registry.RegistryStr()).Referrers
+	if mode == referrersTags {
+		return yieldTagSchemaReferrers(digest, artifactType, remoteOpts, yield)
+	}
+	tr, err := authenticatedTransport(ctx, registry, digest.Scope(transport.PullScope))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: tr}
+
+	next := &url.URL{
+		Scheme: registry.Scheme(),
+		Host:   registry.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/referrers/%s", digest.Context().RepositoryStr(), digest.DigestStr()),
+	}
+	if artifactType != "" {
+		next.RawQuery = url.Values{"artifactType": {artifactType}}.Encode()
+	}
+
+	for next != nil {
+		index, filtered, link, err := fetchReferrersPage(ctx, client, next)
+		if err != nil {
+			return err
+		}
+		if index == nil && mode == referrersAPI {
+			return fmt.Errorf("registry %s does not support the referrers API", registry)
+		}
+		if index == nil {
+			return yieldTagSchemaReferrers(digest, artifactType, remoteOpts, yield)
+		}
+		for _, manifestDesc := range index.Manifests {
+			if !filtered && !matchesArtifactType(manifestDesc, artifactType) {
+				continue
+			}
+			if more, err := yield(manifestDesc); err != nil || !more {
+				return err
+			}
+		}
+		next, err = nextPage(next, link)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchReferrersPage returns a nil index when the registry does not implement the referrers API
+func fetchReferrersPage(ctx context.Context, client *http.Client, u *url.URL) (*v1.IndexManifest, bool, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, "", err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		index, err := v1.ParseIndexManifest(resp.Body)
+		if err != nil {
+			return nil, false, "", fmt.Errorf("failed to parse referrers response: %w", err)
+		}
+		filtered := strings.Contains(resp.Header.Get("OCI-Filters-Applied"), "artifactType")
+		return index, filtered, resp.Header.Get("Link"), nil
+	case http.StatusNotFound, http.StatusBadRequest:
+		return nil, false, "", nil
+	default:
+		return nil, false, "", transport.CheckError(resp, http.StatusOK)
+	}
+}
+
+func yieldTagSchemaReferrers(digest name.Digest, artifactType string, remoteOpts []remote.Option, yield func(v1.Descriptor) (bool, error)) error {
+	referrers, err := remote.Referrers(digest, remoteOpts...)
+	if err != nil {
+		return err
+	}
+	index, err := referrers.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, manifestDesc := range index.Manifests {
+		if !matchesArtifactType(manifestDesc, artifactType) {
+			continue
+		}
+		if more, err := yield(manifestDesc); err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchesArtifactType(desc v1.Descriptor, artifactType string) bool {
+	if artifactType == "" {
+		return strings.HasPrefix(desc.ArtifactType, sigstoreBundleArtifactTypePrefix)
+	}
+	return desc.ArtifactType == artifactType
+}
+
+func matchesAnnotations(desc v1.Descriptor, annotations map[string]string) bool {
+	for key, value := range annotations {
+		if actual, ok := desc.Annotations[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// nextPage resolves the rel="next" target of a Link header against the current page
+func nextPage(current *url.URL, link string) (*url.URL, error) {
+	if link == "" {
+		return nil, nil
+	}
+	for _, part := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+		if !ok || !strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+			continue
+		}
+		u, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid referrers Link header %q: %w", link, err)
+		}
+		return current.ResolveReference(u), nil
+	}
+	return nil, nil
+}
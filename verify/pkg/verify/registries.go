@@ -0,0 +1,190 @@
+package verify
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	referrersAuto = "auto"
+	referrersAPI  = "api"
+	referrersTags = "tags"
+)
+
+var (
+	registryAuthMethods = []string{"", "default", "anonymous", "docker", "google", "ecr", "acr"}
+	referrersModes      = []string{"", referrersAuto, referrersAPI, referrersTags}
+)
+
+// RegistryProfile configures access to a registry host, from the registries section of the config
+// file, so that organizations using several registries don't need a different set of flags for each
+type RegistryProfile struct {
+	// Auth selects the credentials: default (the docker config, then the ambient cloud credentials),
+	// anonymous, docker, google, ecr or acr
+	Auth string `yaml:"auth"`
+	// Insecure talks plain HTTP to the registry
+	Insecure bool `yaml:"insecure"`
+	// CACert is a PEM file of CAs trusted for the registry, in addition to the system roots
+	CACert        string `yaml:"ca-cert"`
+	SkipTLSVerify bool   `yaml:"skip-tls-verify"`
+	// Referrers is how referrers are listed: auto (the referrers API, else the tag schema), api or tags
+	Referrers string `yaml:"referrers"`
+	// Mirror is the registry host, optionally followed by a repository prefix, images of this
+	// registry are pulled through. {registry} in the prefix is replaced by the original registry.
+	Mirror string `yaml:"mirror"`
+}
+
+var (
+	// registryProfiles are keyed by registry host, as in name.Registry.RegistryStr
+	registryProfiles = map[string]RegistryProfile{}
+	// registryMirror is the --registry-mirror of registries whose profile has no mirror
+	registryMirror string
+)
+
+// loadRegistryProfiles reads the registries section of the config file
+func loadRegistryProfiles() (map[string]RegistryProfile, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	section, ok := config["registries"]
+	if !ok {
+		return map[string]RegistryProfile{}, nil
+	}
+	data, err := yaml.Marshal(section)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]RegistryProfile{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid registries in config: %w", err)
+	}
+
+	profiles := make(map[string]RegistryProfile, len(raw))
+	for host, profile := range raw {
+		registry, err := name.NewRegistry(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registry %q in config: %w", host, err)
+		}
+		if !slices.Contains(registryAuthMethods, profile.Auth) {
+			return nil, fmt.Errorf("registry %s: invalid auth %q, expected one of %s", host, profile.Auth, strings.Join(registryAuthMethods[1:], ", "))
+		}
+		if !slices.Contains(referrersModes, profile.Referrers) {
+			return nil, fmt.Errorf("registry %s: invalid referrers %q, expected one of %s", host, profile.Referrers, strings.Join(referrersModes[1:], ", "))
+		}
+		profiles[registry.RegistryStr()] = profile
+	}
+	return profiles, nil
+}
+
+func registryProfile(registry string) RegistryProfile {
+	return registryProfiles[registry]
+}
+
+// registryTransport routes the requests to registries with TLS settings to a transport of their own
+type registryTransport struct {
+	base  http.RoundTripper
+	hosts map[string]http.RoundTripper
+}
+
+func (t *registryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host, ok := t.hosts[req.URL.Host]; ok {
+		return host.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+func newRegistryTransport(base *http.Transport, profiles map[string]RegistryProfile) (http.RoundTripper, error) {
+	hosts := map[string]http.RoundTripper{}
+	for host, profile := range profiles {
+		if profile.CACert == "" && !profile.SkipTLSVerify {
+			continue
+		}
+		t := base.Clone()
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+		if profile.CACert != "" {
+			pem, err := os.ReadFile(profile.CACert)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s: failed to read ca-cert: %w", host, err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("registry %s: no certificates in ca-cert %s", host, profile.CACert)
+			}
+			t.TLSClientConfig.RootCAs = pool
+		}
+		if profile.SkipTLSVerify {
+			t.TLSClientConfig.InsecureSkipVerify = true
+		}
+		hosts[host] = t
+	}
+	if len(hosts) == 0 {
+		return base, nil
+	}
+	return &registryTransport{base: base, hosts: hosts}, nil
+}
+
+// pullReference returns the reference images are fetched from: the image in the mirror of its
+// registry, if any. Policies, lockfiles and receipts keep using the original reference.
+func pullReference(ref name.Reference) (name.Reference, error) {
+	registry := ref.Context().RegistryStr()
+	mirror := registryProfile(registry).Mirror
+	if mirror == "" {
+		mirror = registryMirror
+	}
+	if mirror == "" {
+		return pushReference(ref)
+	}
+	host, prefix, _ := strings.Cut(mirror, "/")
+	if host == registry {
+		// images already in the mirror are pulled as is
+		return pushReference(ref)
+	}
+	prefix = strings.ReplaceAll(prefix, "{registry}", registry)
+	repo := ref.Context().RepositoryStr()
+	if prefix != "" {
+		repo = prefix + "/" + repo
+	}
+	mirrored, err := name.NewRepository(host+"/"+repo, registryNameOptions(host)...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror %q: %w", mirror, err)
+	}
+	return withRepository(ref, mirrored), nil
+}
+
+// pushReference returns the reference with the registry settings of its profile applied
+func pushReference(ref name.Reference) (name.Reference, error) {
+	registry := ref.Context().RegistryStr()
+	if !registryProfile(registry).Insecure {
+		return ref, nil
+	}
+	repo, err := name.NewRepository(ref.Context().Name(), registryNameOptions(registry)...)
+	if err != nil {
+		return nil, err
+	}
+	return withRepository(ref, repo), nil
+}
+
+func registryNameOptions(registry string) []name.Option {
+	if r, err := name.NewRegistry(registry); err == nil && registryProfile(r.RegistryStr()).Insecure {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+func withRepository(ref name.Reference, repo name.Repository) name.Reference {
+	if digest, ok := ref.(name.Digest); ok {
+		return repo.Digest(digest.DigestStr())
+	}
+	return repo.Tag(ref.Identifier())
+}
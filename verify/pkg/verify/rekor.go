@@ -0,0 +1,196 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/rekor/pkg/tle"
+	_ "github.com/sigstore/rekor/pkg/types/intoto/v0.0.2"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+)
+
+const (
+	defaultRekorURL = "https://rekor.sigstore.dev"
+	// rekorRetrieveBatchSize is the most entries Rekor returns from one entries/retrieve request
+	rekorRetrieveBatchSize = 10
+)
+
+// RekorSearchSource reconstructs bundles from Rekor entries whose subject digest matches the
+// image. Only intoto v0.0.2 entries can be reconstructed, since they are the only kind for
+// which Rekor stores the attestation payload.
+type RekorSearchSource struct {
+	URL string
+	// Limit is the maximum number of entries retrieved for an image
+	Limit int
+	// Client sends the requests, by default a client of the configured transport
+	Client *http.Client
+}
+
+func (s *RekorSearchSource) Name() string {
+	return "rekor"
+}
+
+func (s *RekorSearchSource) Bundles(ctx context.Context, _ name.Reference, desc *v1.Descriptor) ([]*Bundle, error) {
+	var uuids []string
+	if err := s.post(ctx, "/api/v1/index/retrieve", map[string]string{"hash": desc.Digest.String()}, &uuids); err != nil {
+		return nil, fmt.Errorf("failed to search rekor: %w", err)
+	}
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	if s.Limit > 0 && len(uuids) > s.Limit {
+		fmt.Fprintf(os.Stderr, "stopped fetching rekor entries of %s after --limit=%d entries\n", desc.Digest, s.Limit)
+		uuids = uuids[:s.Limit]
+	}
+
+	var entries []models.LogEntry
+	for batch := range slices.Chunk(uuids, rekorRetrieveBatchSize) {
+		var batchEntries []models.LogEntry
+		if err := s.post(ctx, "/api/v1/log/entries/retrieve", map[string][]string{"entryUUIDs": batch}, &batchEntries); err != nil {
+			return nil, fmt.Errorf("failed to retrieve rekor entries: %w", err)
+		}
+		entries = append(entries, batchEntries...)
+	}
+
+	bundles := make([]*Bundle, 0)
+	for _, entry := range entries {
+		for uuid, anon := range entry {
+			pb, err := bundleFromLogEntry(anon)
+			if err != nil {
+				return nil, fmt.Errorf("failed to reconstruct bundle from rekor entry %s: %w", uuid, err)
+			}
+			if pb == nil {
+				continue
+			}
+			b, err := bundle.NewProtobufBundle(pb)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bundle reconstructed from rekor entry %s: %w", uuid, err)
+			}
+			bundles = append(bundles, newBundle(b))
+		}
+	}
+	return bundles, nil
+}
+
+func (s *RekorSearchSource) post(ctx context.Context, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.URL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = newAPIClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newHTTPStatusError(resp, "%s returned", path)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// bundleFromLogEntry rebuilds a v0.2 bundle from an intoto entry, returning nil for entries
+// of any other kind, without an inclusion proof or without a payload type
+func bundleFromLogEntry(anon models.LogEntryAnon) (*protobundle.Bundle, error) {
+	if anon.Attestation == nil || len(anon.Attestation.Data) == 0 || anon.Verification == nil || anon.Verification.InclusionProof == nil {
+		return nil, nil
+	}
+	body, ok := anon.Body.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected entry body type %T", anon.Body)
+	}
+	bodyBytes, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, err
+	}
+	pe, err := models.UnmarshalProposedEntry(bytes.NewReader(bodyBytes), runtime.JSONConsumer())
+	if err != nil {
+		return nil, err
+	}
+	intoto, ok := pe.(*models.Intoto)
+	if !ok {
+		return nil, nil
+	}
+	spec, err := json.Marshal(intoto.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var entry models.IntotoV002Schema
+	if err := json.Unmarshal(spec, &entry); err != nil || entry.Content == nil || entry.Content.Envelope == nil {
+		return nil, nil
+	}
+	envelope := entry.Content.Envelope
+	if envelope.PayloadType == nil {
+		return nil, nil
+	}
+	if len(envelope.Signatures) == 0 || envelope.Signatures[0].PublicKey == nil || envelope.Signatures[0].Sig == nil {
+		return nil, fmt.Errorf("entry has no signature")
+	}
+
+	certBlock, _ := pem.Decode(*envelope.Signatures[0].PublicKey)
+	if certBlock == nil {
+		return nil, fmt.Errorf("entry signer is not a PEM certificate")
+	}
+	if _, err := x509.ParseCertificate(certBlock.Bytes); err != nil {
+		return nil, fmt.Errorf("entry signer is not a certificate: %w", err)
+	}
+	// the log stores the envelope signature in its base64 encoded form
+	sig, err := base64.StdEncoding.DecodeString(string(*envelope.Signatures[0].Sig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode entry signature: %w", err)
+	}
+
+	tlogEntry, err := tle.GenerateTransparencyLogEntry(anon)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, err := bundle.MediaTypeString("0.2")
+	if err != nil {
+		return nil, err
+	}
+
+	return &protobundle.Bundle{
+		MediaType: mediaType,
+		VerificationMaterial: &protobundle.VerificationMaterial{
+			Content: &protobundle.VerificationMaterial_X509CertificateChain{
+				X509CertificateChain: &protocommon.X509CertificateChain{
+					Certificates: []*protocommon.X509Certificate{{RawBytes: certBlock.Bytes}},
+				},
+			},
+			TlogEntries: []*protorekor.TransparencyLogEntry{tlogEntry},
+		},
+		Content: &protobundle.Bundle_DsseEnvelope{
+			DsseEnvelope: &protodsse.Envelope{
+				Payload:     anon.Attestation.Data,
+				PayloadType: *envelope.PayloadType,
+				Signatures:  []*protodsse.Signature{{Sig: sig, Keyid: envelope.Signatures[0].Keyid}},
+			},
+		},
+	}, nil
+}
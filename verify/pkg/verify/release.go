@@ -0,0 +1,138 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// ReleaseAsset identifies an asset of a GitHub release, written owner/repo@tag on the command line
+type ReleaseAsset struct {
+	Repo  string
+	Tag   string
+	Asset string
+}
+
+func parseReleaseAsset(release, asset string) (ReleaseAsset, error) {
+	repo, tag, ok := strings.Cut(release, "@")
+	if !ok || tag == "" || strings.Count(repo, "/") != 1 {
+		return ReleaseAsset{}, fmt.Errorf("invalid --github-release %q, expected owner/repo@tag", release)
+	}
+	if asset == "" {
+		return ReleaseAsset{}, errors.New("--asset is required with --github-release")
+	}
+	return ReleaseAsset{Repo: repo, Tag: tag, Asset: asset}, nil
+}
+
+func (r ReleaseAsset) String() string {
+	return fmt.Sprintf("%s@%s/%s", r.Repo, r.Tag, r.Asset)
+}
+
+type gitHubRelease struct {
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"assets"`
+}
+
+// digestReleaseAsset streams the asset through the GitHub API, which also serves assets of private
+// repositories when a token is set, into its sha256 digest, without holding it in memory
+func digestReleaseAsset(ctx context.Context, apiURL, token string, r ReleaseAsset) (v1.Hash, int64, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/tags/%s", strings.TrimSuffix(apiURL, "/"), r.Repo, r.Tag)
+	body, err := gitHubGet(ctx, endpoint, "application/vnd.github+json", token)
+	if err != nil {
+		return v1.Hash{}, 0, err
+	}
+	var release gitHubRelease
+	if err := json.Unmarshal(body, &release); err != nil {
+		return v1.Hash{}, 0, fmt.Errorf("failed to decode release %s@%s: %w", r.Repo, r.Tag, err)
+	}
+	for _, asset := range release.Assets {
+		if asset.Name == r.Asset {
+			content, err := gitHubOpen(ctx, newDownloadClient(), asset.URL, "application/octet-stream", token)
+			if err != nil {
+				return v1.Hash{}, 0, err
+			}
+			defer content.Close()
+			return v1.SHA256(content)
+		}
+	}
+	return v1.Hash{}, 0, fmt.Errorf("release %s@%s has no asset named %s", r.Repo, r.Tag, r.Asset)
+}
+
+// gitHubGet reads the response of an API request, bounded by apiRequestTimeout
+func gitHubGet(ctx context.Context, endpoint, accept, token string) ([]byte, error) {
+	body, err := gitHubOpen(ctx, newAPIClient(), endpoint, accept, token)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// gitHubOpen sends a GET request with the client and returns the body of the response, which the
+// caller closes
+func gitHubOpen(ctx context.Context, client *http.Client, endpoint, accept, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newHTTPStatusError(resp, "failed to fetch %s", endpoint)
+	}
+	return resp.Body, nil
+}
+
+// verifyReleaseAsset verifies the attestations the GitHub attestations API holds for the digest of
+// a release asset, either downloaded from the release or read from assetPath
+func verifyReleaseAsset(ctx context.Context, r ReleaseAsset, assetPath string, opts VerificationOptions, trustedMaterial *root.TrustedRoot) ([]VerificationResult, error) {
+	var digest v1.Hash
+	var size int64
+	var err error
+	if assetPath != "" {
+		digest, size, err = digestFile(assetPath)
+	} else {
+		var token string
+		if token, err = opts.gitHubToken(ctx); err == nil {
+			digest, size, err = digestReleaseAsset(ctx, opts.GitHubAPIURL, token, r)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	desc := &v1.Descriptor{Digest: digest, Size: size}
+
+	source := &GitHubAPISource{APIURL: opts.GitHubAPIURL, Repo: r.Repo, Token: os.Getenv("GITHUB_TOKEN"), Tokens: opts.GitHubTokens}
+	bundles, err := source.Bundles(ctx, nil, desc)
+	if err != nil {
+		return nil, err
+	}
+	return verifyAttestations(ctx, r.String(), bundles, desc, trustedMaterial, opts)
+}
+
+// digestFile streams a file into its sha256 digest
+func digestFile(path string) (v1.Hash, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return v1.Hash{}, 0, err
+	}
+	defer f.Close()
+	return v1.SHA256(f)
+}
@@ -0,0 +1,145 @@
+package verify
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	reportCSV  = "csv"
+	reportHTML = "html"
+)
+
+func newReportCommand() *cobra.Command {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	resultsDB := fs.String("results-db", "", "database the verification outcomes were recorded in with --results-db")
+	format := fs.String("format", reportCSV, "report format: "+reportCSV+" or "+reportHTML)
+	output := fs.String("report-output", "", "file to write the report to (default stdout)")
+	var since, until timeFlag
+	fs.Var(&since, "since", "only report outcomes recorded at or after this time, e.g. 2025-01-02 or 2025-01-02T15:04:05Z")
+	fs.Var(&until, "until", "only report outcomes recorded at or before this time")
+	return newCommand(fs, commandDoc{
+		Use:     "report --results-db <path>",
+		Short:   "Render the verification outcomes recorded with --results-db as CSV or HTML",
+		Example: "  report --results-db verify.db --since 2025-01-01 --until 2025-04-01 --format html --report-output q1.html",
+	}, func(args []string) error {
+		if *resultsDB == "" {
+			return errors.New("--results-db is required")
+		}
+		if *format != reportCSV && *format != reportHTML {
+			return fmt.Errorf("invalid --format %q, expected %s or %s", *format, reportCSV, reportHTML)
+		}
+
+		records, err := readOutcomes(*resultsDB, time.Time(since), time.Time(until))
+		if err != nil {
+			return err
+		}
+		w := io.Writer(os.Stdout)
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return fmt.Errorf("failed to create report: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if *format == reportHTML {
+			return writeHTMLReport(w, records, time.Time(since), time.Time(until))
+		}
+		return writeCSVReport(w, records)
+	})
+}
+
+// policySummary describes the policy of a record in one line
+func policySummary(p ReceiptPolicy) string {
+	parts := []string{}
+	if p.Key != "" {
+		parts = append(parts, "key="+p.Key)
+	} else {
+		subject := p.Subject
+		if p.SubjectRegexp != "" {
+			subject = "~" + p.SubjectRegexp
+		}
+		parts = append(parts, "issuer="+p.Issuer, "subject="+subject)
+	}
+	if len(p.PredicateTypes) > 0 {
+		parts = append(parts, "predicateTypes="+strings.Join(p.PredicateTypes, ","))
+	}
+	if p.MinIdentities > 0 {
+		parts = append(parts, fmt.Sprintf("minIdentities=%d", p.MinIdentities))
+	}
+	if p.MaxAge != "" {
+		parts = append(parts, "maxAttestationAge="+p.MaxAge)
+	}
+	for _, assertion := range p.Assertions {
+		parts = append(parts, "assert="+assertion)
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeCSVReport(w io.Writer, records []OutcomeRecord) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "image", "digest", "result", "policy", "error"})
+	for _, r := range records {
+		cw.Write([]string{r.Time.Format(time.RFC3339), r.Image, r.Digest, r.Result, policySummary(r.Policy), r.Error})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"policy": policySummary,
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Image verification report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.verified { color: #1a7f37; } .failed { color: #cf222e; } .warning, .skipped { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Image verification report</h1>
+<p>From {{date .Since}} to {{date .Until}}, generated at {{date .Generated}}.</p>
+<p>{{len .Records}} verifications: {{.Counts.verified}} verified, {{.Counts.failed}} failed, {{.Counts.warning}} admitted with a warning, {{.Counts.skipped}} skipped.</p>
+<table>
+<tr><th>Time</th><th>Image</th><th>Digest</th><th>Result</th><th>Policy</th><th>Error</th></tr>
+{{- range .Records}}
+<tr><td>{{date .Time}}</td><td>{{.Image}}</td><td><code>{{.Digest}}</code></td><td class="{{.Result}}">{{.Result}}</td><td>{{policy .Policy}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func writeHTMLReport(w io.Writer, records []OutcomeRecord, since, until time.Time) error {
+	counts := map[string]int{outcomeVerified: 0, outcomeFailed: 0, outcomeWarning: 0, outcomeSkipped: 0}
+	for _, r := range records {
+		counts[r.Result]++
+	}
+	return htmlReport.Execute(w, map[string]any{
+		"Records":   records,
+		"Counts":    counts,
+		"Since":     since,
+		"Until":     until,
+		"Generated": time.Now(),
+	})
+}
@@ -0,0 +1,145 @@
+package verify
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	outcomeVerified = "verified"
+	outcomeFailed   = "failed"
+	outcomeWarning  = "warning"
+	outcomeSkipped  = "skipped"
+)
+
+var outcomesBucket = []byte("outcomes")
+
+// OutcomeRecord is a verification outcome stored in the --results-db database
+type OutcomeRecord struct {
+	Time  time.Time `json:"time"`
+	Image string    `json:"image"`
+	// Reference is the fully qualified image reference, so that shorthand references can be queried by it
+	Reference string        `json:"reference,omitempty"`
+	Digest    string        `json:"digest,omitempty"`
+	Policy    ReceiptPolicy `json:"policy"`
+	Result    string        `json:"result"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func newOutcomeRecord(outcome ImageResult, opts VerificationOptions, now time.Time) OutcomeRecord {
+	record := OutcomeRecord{Time: now.UTC(), Image: outcome.Image, Reference: normalizeImage(outcome.Image), Policy: receiptPolicy(opts), Result: outcomeVerified}
+	if len(outcome.Results) > 0 {
+		record.Digest = outcome.Results[0].Desc.Digest.String()
+	} else if ref, err := parseImageReference(outcome.Image); err == nil {
+		if digest, ok := ref.(name.Digest); ok {
+			record.Digest = digest.DigestStr()
+		}
+	}
+	switch {
+	case outcome.Err != nil:
+		record.Result, record.Error = outcomeFailed, outcome.Err.Error()
+	case outcome.Warning != nil:
+		record.Result, record.Error = outcomeWarning, outcome.Warning.Error()
+	case outcome.Skipped != nil:
+		record.Result, record.Error = outcomeSkipped, outcome.Skipped.Error()
+	}
+	return record
+}
+
+// openResultsDB opens the database for each batch of outcomes rather than for the lifetime of the
+// process, so that watch, serve and one-off verifications can share it
+func openResultsDB(path string, readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// recordOutcomes stores the outcomes in --results-db, if set
+func recordOutcomes(opts VerificationOptions, outcomes ...ImageResult) error {
+	if opts.ResultsDB == "" {
+		return nil
+	}
+	db, err := openResultsDB(opts.ResultsDB, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(outcomesBucket)
+		if err != nil {
+			return err
+		}
+		for _, outcome := range outcomes {
+			value, err := json.Marshal(newOutcomeRecord(outcome, opts, now))
+			if err != nil {
+				return err
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(outcomeKey(now, seq), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record verification outcomes: %w", err)
+	}
+	return nil
+}
+
+// outcomeKey orders records by time, then by insertion
+func outcomeKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// readOutcomes returns the records stored between since and until; zero times leave the range open
+func readOutcomes(path string, since, until time.Time) ([]OutcomeRecord, error) {
+	db, err := openResultsDB(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	records := []OutcomeRecord{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outcomesBucket)
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(outcomeKey(since, 0))
+		}
+		for ; k != nil; k, v = c.Next() {
+			var record OutcomeRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if !until.IsZero() && record.Time.After(until) {
+				break
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results database %s: %w", path, err)
+	}
+	return records, nil
+}
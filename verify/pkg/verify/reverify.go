@@ -0,0 +1,299 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// eventReasonOutOfPolicy is the reason of the warning Events emitted for pods whose images no
+// longer pass the policy
+const eventReasonOutOfPolicy = "ImageVerificationFailed"
+
+// kubePod is the subset of a core/v1 Pod the re-verification reads
+type kubePod struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Status   struct {
+		InitContainerStatuses []kubeContainerStatus `json:"initContainerStatuses"`
+		ContainerStatuses     []kubeContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type kubeContainerStatus struct {
+	ImageID string `json:"imageID"`
+}
+
+// kubeEvent is the subset of a core/v1 Event the re-verification writes
+type kubeEvent struct {
+	APIVersion     string              `json:"apiVersion"`
+	Kind           string              `json:"kind"`
+	Metadata       kubeObjectMeta      `json:"metadata"`
+	InvolvedObject kubeObjectReference `json:"involvedObject"`
+	Reason         string              `json:"reason"`
+	Message        string              `json:"message"`
+	Type           string              `json:"type"`
+	Source         struct {
+		Component string `json:"component"`
+	} `json:"source"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Count          int       `json:"count"`
+}
+
+type kubeObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+}
+
+// runningPod is a pod and the digests of the images its containers run
+type runningPod struct {
+	pod    kubePod
+	object map[string]any
+	images []string
+}
+
+// reverifier periodically verifies again the images running in the cluster, so that images admitted
+// before a policy change or a trusted root rotation are reported once they no longer pass. Only the
+// leader verifies when several replicas run.
+type reverifier struct {
+	client *kubeClient
+	server *admissionServer
+	// elector is nil without leader election, when a single replica runs
+	elector *leaderElector
+	// failing holds the pod UID and image of the pods already reported, so that an Event is emitted
+	// when an image falls out of policy rather than on every pass
+	failing map[string]bool
+}
+
+func newReverifier(server *admissionServer, lease string) (*reverifier, error) {
+	client, err := newInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	r := &reverifier{client: client, server: server, failing: map[string]bool{}}
+	if lease != "" {
+		if r.elector, err = newLeaderElector(client, lease); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// run verifies the running images every interval until ctx is done
+func (r *reverifier) run(ctx context.Context, interval time.Duration) {
+	if r.elector != nil {
+		go r.elector.run(ctx)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if r.elector != nil && !r.elector.IsLeader() {
+			continue
+		}
+		if err := r.reverify(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "re-verification failed: %v\n", err)
+		}
+	}
+}
+
+// reverify verifies each image running in the cluster once per policy, then applies the admission policy to
+// every pod running it as if the pod was admitted again
+func (r *reverifier) reverify(ctx context.Context) error {
+	pods, err := r.listPods(ctx)
+	if err != nil {
+		return err
+	}
+	var targets []imageTarget
+	seen := map[imageTarget]bool{}
+	images := map[string]bool{}
+	for _, pod := range pods {
+		for _, image := range pod.images {
+			target := imageTarget{namespace: pod.pod.Metadata.Namespace, image: image}
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+			images[image] = true
+		}
+	}
+
+	var outcomes []ImageResult
+	if r.server.pullSecrets == nil {
+		outcomes = r.server.verifyTargets(ctx, targets)
+	} else {
+		outcomes = r.verifyWithPullSecrets(ctx, pods, targets)
+	}
+	if err := recordOutcomes(r.server.opts, outcomes...); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	byTarget := make(map[imageTarget]ImageResult, len(outcomes))
+	for i, outcome := range outcomes {
+		byTarget[targets[i]] = outcome
+	}
+
+	failing := map[string]bool{}
+	denied := 0
+	for _, pod := range pods {
+		request := map[string]any{
+			"uid":       pod.pod.Metadata.UID,
+			"kind":      map[string]any{"group": "", "version": "v1", "kind": "Pod"},
+			"namespace": pod.pod.Metadata.Namespace,
+			"name":      pod.pod.Metadata.Name,
+			"operation": "REVERIFY",
+			"object":    pod.object,
+		}
+		for _, image := range pod.images {
+			outcome := byTarget[imageTarget{namespace: pod.pod.Metadata.Namespace, image: image}]
+			action, rule := r.server.policy.decide(request, outcome)
+			if action != admissionDeny {
+				continue
+			}
+			denied++
+			key := pod.pod.Metadata.UID + "/" + image
+			failing[key] = true
+			if r.failing[key] {
+				continue
+			}
+			reason := "not verified"
+			if err := firstError(outcome.Err, outcome.Warning, outcome.Skipped); err != nil {
+				reason = err.Error()
+			}
+			if rule != "" {
+				reason = fmt.Sprintf("rule %s: %s", rule, reason)
+			}
+			if err := r.emitWarning(ctx, pod.pod, fmt.Sprintf("image %s no longer passes verification: %s", image, reason)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to emit event for pod %s/%s: %v\n", pod.pod.Metadata.Namespace, pod.pod.Metadata.Name, err)
+				// retried on the next pass
+				delete(failing, key)
+			}
+		}
+	}
+	r.failing = failing
+	fmt.Fprintf(os.Stderr, "re-verified %d images of %d pods, %d pod images out of policy\n", len(images), len(pods), denied)
+	return nil
+}
+
+// verifyWithPullSecrets verifies the images of each namespace with the pull secrets of its pods, so
+// that the credentials of a namespace are never used for the images of another
+func (r *reverifier) verifyWithPullSecrets(ctx context.Context, pods []runningPod, targets []imageTarget) []ImageResult {
+	objects := map[string][]any{}
+	for _, pod := range pods {
+		objects[pod.pod.Metadata.Namespace] = append(objects[pod.pod.Metadata.Namespace], pod.object)
+	}
+	indexes := map[string][]int{}
+	for i, target := range targets {
+		indexes[target.namespace] = append(indexes[target.namespace], i)
+	}
+
+	outcomes := make([]ImageResult, len(targets))
+	for namespace, targetIndexes := range indexes {
+		namespaceCtx := ctx
+		if kc, err := r.server.pullSecrets.keychain(ctx, namespace, objects[namespace]...); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		} else {
+			namespaceCtx = withKeychain(ctx, kc)
+		}
+		namespaceTargets := make([]imageTarget, len(targetIndexes))
+		for j, i := range targetIndexes {
+			namespaceTargets[j] = targets[i]
+		}
+		for j, outcome := range r.server.verifyTargets(namespaceCtx, namespaceTargets) {
+			outcomes[targetIndexes[j]] = outcome
+		}
+	}
+	return outcomes
+}
+
+// listPods lists the pods of every namespace, with the digests of the images their containers run.
+// Pods whose images haven't been pulled yet are skipped.
+func (r *reverifier) listPods(ctx context.Context) ([]runningPod, error) {
+	var pods []runningPod
+	continueToken := ""
+	for {
+		path := "/api/v1/pods?limit=500"
+		if continueToken != "" {
+			path += "&continue=" + url.QueryEscape(continueToken)
+		}
+		var list struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := r.client.get(ctx, path, &list); err != nil {
+			return nil, fmt.Errorf("failed to list pods: %w", err)
+		}
+		for _, item := range list.Items {
+			var pod runningPod
+			if err := json.Unmarshal(item, &pod.pod); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(item, &pod.object); err != nil {
+				return nil, err
+			}
+			for _, status := range slices.Concat(pod.pod.Status.InitContainerStatuses, pod.pod.Status.ContainerStatuses) {
+				if image := runningImage(status); image != "" {
+					pod.images = append(pod.images, image)
+				}
+			}
+			if pod.images = uniqueImages(pod.images); len(pod.images) > 0 {
+				pods = append(pods, pod)
+			}
+		}
+		if continueToken = list.Metadata.Continue; continueToken == "" {
+			return pods, nil
+		}
+	}
+}
+
+// runningImage is the digest reference of the image a container runs, from the imageID reported by
+// the container runtime, e.g. docker-pullable://ghcr.io/org/app@sha256:...
+func runningImage(status kubeContainerStatus) string {
+	imageID := status.ImageID
+	if i := strings.Index(imageID, "://"); i >= 0 {
+		imageID = imageID[i+3:]
+	}
+	if !strings.Contains(imageID, "@") {
+		// a bare image ID, which doesn't say which repository the image was pulled from
+		return ""
+	}
+	return imageID
+}
+
+// emitWarning records a warning Event on the pod
+func (r *reverifier) emitWarning(ctx context.Context, pod kubePod, message string) error {
+	now := time.Now().UTC()
+	event := kubeEvent{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata:   kubeObjectMeta{GenerateName: pod.Metadata.Name + ".", Namespace: pod.Metadata.Namespace},
+		InvolvedObject: kubeObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  pod.Metadata.Namespace,
+			Name:       pod.Metadata.Name,
+			UID:        pod.Metadata.UID,
+		},
+		Reason:         eventReasonOutOfPolicy,
+		Message:        message,
+		Type:           "Warning",
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	event.Source.Component = "github-signing-demo-verify"
+	return r.client.create(ctx, fmt.Sprintf("/api/v1/namespaces/%s/events", pod.Metadata.Namespace), event, nil)
+}
@@ -0,0 +1,96 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// unsafeFileNameChars are replaced in the predicate types naming the saved payloads
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// PayloadMetadata describes a verified payload saved by --save-payloads, next to the payload.
+// AttestationID identifies the attestation by what was signed and by its signature, like the file
+// name. It isn't the digest of a bundle file: sources may serve the same attestation in bundles that
+// differ, e.g. in their verification material, and some sources have no file at all.
+type PayloadMetadata struct {
+	Image          string     `json:"image"`
+	Digest         string     `json:"digest"`
+	AttestationID  string     `json:"attestationId"`
+	PayloadType    string     `json:"payloadType,omitempty"`
+	PredicateType  string     `json:"predicateType,omitempty"`
+	Issuer         string     `json:"issuer,omitempty"`
+	Subject        string     `json:"subject,omitempty"`
+	TlogIndex      *int64     `json:"tlogIndex,omitempty"`
+	IntegratedTime *time.Time `json:"integratedTime,omitempty"`
+	VerifiedAt     time.Time  `json:"verifiedAt"`
+}
+
+// payloadFileName names the files of a verified payload after its predicate type, or payload type
+// for other payloads, and the ID of the attestation, e.g. slsa.dev_provenance_v1-<id>
+func payloadFileName(result VerificationResult, attestationID string) string {
+	kind := "message-signature"
+	if result.Bundle.DSSE_Envelope != nil {
+		kind = result.Bundle.DSSE_Envelope.PredicateType
+	} else if result.Bundle.PayloadType != "" {
+		kind = result.Bundle.PayloadType
+	}
+	kind = strings.TrimPrefix(strings.TrimPrefix(kind, "https://"), "http://")
+	kind = strings.Trim(unsafeFileNameChars.ReplaceAllString(kind, "_"), "_")
+	return kind + "-" + attestationID
+}
+
+// savePayloads writes the DSSE payload of each verified attestation to <name>.json in dir, and its
+// metadata to <name>.meta.json. Bundles signing a message instead of an envelope only have metadata.
+func savePayloads(dir, image string, results []VerificationResult) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	verifiedAt := time.Now().UTC()
+	for _, result := range results {
+		attestationID, err := bundleDigest(result.Bundle)
+		if err != nil {
+			return err
+		}
+		metadata := PayloadMetadata{
+			Image:         image,
+			Digest:        result.Desc.Digest.String(),
+			AttestationID: attestationID,
+			PayloadType:   result.Bundle.PayloadType,
+			VerifiedAt:    verifiedAt,
+		}
+		if result.Bundle.DSSE_Envelope != nil {
+			metadata.PredicateType = result.Bundle.DSSE_Envelope.PredicateType
+		}
+		if signer, ok := signerSummary(result.Bundle); ok {
+			metadata.Issuer, metadata.Subject = signer.Extensions.Issuer, signer.SubjectAlternativeName
+		}
+		if entries := result.Bundle.ProtoBundle.Bundle.GetVerificationMaterial().GetTlogEntries(); len(entries) > 0 {
+			metadata.TlogIndex = &entries[0].LogIndex
+			// entries of the Rekor v2 log have no integrated time
+			if entries[0].IntegratedTime != 0 {
+				integratedTime := time.Unix(entries[0].IntegratedTime, 0).UTC()
+				metadata.IntegratedTime = &integratedTime
+			}
+		}
+
+		name := filepath.Join(dir, payloadFileName(result, attestationID))
+		if result.Bundle.Payload != nil {
+			if err := os.WriteFile(name+".json", result.Bundle.Payload, 0o644); err != nil {
+				return fmt.Errorf("failed to save payload: %w", err)
+			}
+		}
+		data, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name+".meta.json", append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to save payload metadata: %w", err)
+		}
+	}
+	return nil
+}
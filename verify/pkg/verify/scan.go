@@ -0,0 +1,219 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var containerFields = []string{"containers", "initContainers", "ephemeralContainers"}
+
+func newScanManifestsCommand() *cobra.Command {
+	fs := flag.NewFlagSet("scan-manifests", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:     "scan-manifests <dir|file|chart>",
+		Short:   "Verify every image referenced by Kubernetes manifests or a Helm chart",
+		Args:    cobra.ExactArgs(1),
+		Example: "  scan-manifests ./deploy --subject-regexp '^https://github.com/nirmata/.*$'\n  scan-manifests ./charts/app --lockfile digests.yaml --subject \"...\"",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := validateOutput(opts.Output); err != nil {
+			return err
+		}
+		if err := validateOnError(opts.OnError); err != nil {
+			return err
+		}
+
+		images, err := collectImages(args[0])
+		if err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			fmt.Printf("No images found in %s\n", args[0])
+			return nil
+		}
+
+		return verifyImages(context.TODO(), images, opts)
+	})
+}
+
+// verifyImages verifies the images in parallel, printing one result line per image in the order
+// of images
+func verifyImages(ctx context.Context, images []string, opts VerificationOptions) error {
+	failed := 0
+	outcomes, err := verifyAll(ctx, images, opts)
+	if err != nil {
+		return err
+	}
+	if err := recordOutcomes(opts, outcomes...); err != nil {
+		return err
+	}
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			failed++
+		}
+		if opts.Output != outputText {
+			continue
+		}
+		switch {
+		case outcome.Err != nil:
+			fmt.Printf("✗ %s: %v\n", outcome.Image, outcome.Err)
+			continue
+		case outcome.Warning != nil:
+			fmt.Printf("⚠ %s: not verified: %v\n", outcome.Image, outcome.Warning)
+			continue
+		case outcome.Skipped != nil:
+			fmt.Printf("- %s: skipped: %v\n", outcome.Image, outcome.Skipped)
+			continue
+		}
+		if pinned := pinnedReference(outcome.Image, outcome.Results[0].Desc); pinned != outcome.Image {
+			fmt.Printf("✓ %s → %s\n", outcome.Image, pinned)
+			continue
+		}
+		fmt.Printf("✓ %s\n", outcome.Image)
+	}
+	if err := writeOutcomes(os.Stdout, opts.Output, outcomes); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed verification", failed, len(images))
+	}
+	return nil
+}
+
+// collectImages returns the unique container images referenced by Kubernetes manifests. Helm charts,
+// either a directory with a Chart.yaml or a packaged .tgz, are rendered with `helm template` first.
+func collectImages(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []io.Reader
+	switch {
+	case isHelmChart(path, info):
+		out, err := exec.Command("helm", "template", "scan", path).Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return nil, fmt.Errorf("failed to render chart %s: %s", path, exitErr.Stderr)
+			}
+			return nil, fmt.Errorf("failed to render chart %s: %w", path, err)
+		}
+		documents = append(documents, bytes.NewReader(out))
+	case info.IsDir():
+		err := filepath.WalkDir(path, func(file string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if ext := filepath.Ext(file); ext != ".yaml" && ext != ".yml" {
+				return nil
+			}
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			documents = append(documents, bytes.NewReader(content))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, bytes.NewReader(content))
+	}
+
+	seen := make(map[string]bool)
+	images := make([]string, 0)
+	for _, r := range documents {
+		dec := yaml.NewDecoder(r)
+		for {
+			var doc any
+			if err := dec.Decode(&doc); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to parse manifests in %s: %w", path, err)
+			}
+			for _, image := range extractImages(doc) {
+				if !seen[image] {
+					seen[image] = true
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+func isHelmChart(path string, info os.FileInfo) bool {
+	if !info.IsDir() {
+		return strings.HasSuffix(path, ".tgz")
+	}
+	_, err := os.Stat(filepath.Join(path, "Chart.yaml"))
+	return err == nil
+}
+
+// extractImages walks a decoded manifest and returns the image of every container list it finds,
+// which covers pods as well as workload templates, cron jobs and lists
+func extractImages(node any) []string {
+	var images []string
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isContainerField(key) {
+				if containers, ok := value.([]any); ok {
+					for _, c := range containers {
+						if container, ok := c.(map[string]any); ok {
+							if image, ok := container["image"].(string); ok && image != "" {
+								images = append(images, image)
+							}
+						}
+					}
+					continue
+				}
+			}
+			images = append(images, extractImages(value)...)
+		}
+	case []any:
+		for _, item := range v {
+			images = append(images, extractImages(item)...)
+		}
+	}
+	return images
+}
+
+func isContainerField(key string) bool {
+	for _, field := range containerFields {
+		if key == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+)
+
+// requireSCT reports whether --require-sct is set, which commands without the flag leave unset
+func (opts VerificationOptions) requireSCT() bool {
+	return opts.RequireSCT
+}
+
+// checkCTLogs fails when SCTs are required but the trusted root has no CT log to verify them with,
+// as for GitHub's Sigstore instance, whose certificates are not logged
+func checkCTLogs(trustedRoot *root.TrustedRoot, opts VerificationOptions) error {
+	if opts.requireSCT() && len(trustedRoot.CTLogs()) == 0 {
+		return errors.New("--require-sct: the trusted root has no CT logs to verify signed certificate timestamps against")
+	}
+	return nil
+}
+
+// checkSCT verifies the signed certificate timestamps embedded in the certificate of a verified
+// bundle against the CT logs of the trusted root, and reports whether the bundle has a certificate.
+// With --require-sct sigstore-go already enforces this; without it the outcome is only reported.
+func checkSCT(b *Bundle, result *verify.VerificationResult, trustedRoot *root.TrustedRoot) (bool, error) {
+	content, err := b.ProtoBundle.VerificationContent()
+	if err != nil || content.Certificate() == nil {
+		return false, nil
+	}
+	if len(result.VerifiedTimestamps) == 0 {
+		return true, errors.New("no verified timestamp to check the certificate chain at")
+	}
+	chains, err := verify.VerifyLeafCertificate(result.VerifiedTimestamps[0].Timestamp, content.Certificate(), trustedRoot)
+	if err != nil {
+		return true, err
+	}
+	if err := verify.VerifySignedCertificateTimestamp(chains, 1, trustedRoot); err != nil {
+		return true, fmt.Errorf("failed to verify signed certificate timestamp: %w", err)
+	}
+	return true, nil
+}
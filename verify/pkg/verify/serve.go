@@ -0,0 +1,325 @@
+package verify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// AdmissionReview is the subset of the admission.k8s.io/v1 AdmissionReview the webhook reads and
+// writes. The request is kept as a generic map so that policy rules can read any of its fields.
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    map[string]any     `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+type AdmissionResponse struct {
+	UID      string           `json:"uid"`
+	Allowed  bool             `json:"allowed"`
+	Status   *AdmissionStatus `json:"status,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+type AdmissionStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// admissionServer verifies the images of the objects sent by the API server
+type admissionServer struct {
+	opts   VerificationOptions
+	trust  *TrustProvider
+	policy *AdmissionPolicy
+	// policies is nil without --policy-crds
+	policies *policyStore
+	// pullSecrets is nil without --pull-secrets
+	pullSecrets *pullSecretResolver
+	// budget is the --request-budget, 0 to derive it from the timeout of each request
+	budget    time.Duration
+	onTimeout string
+	metrics   webhookMetrics
+}
+
+func newServeCommand() *cobra.Command {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	listen := fs.String("listen", ":8443", "address to serve the admission webhook on")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file; the webhook is served over plain HTTP without it, e.g. behind a TLS terminating proxy")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	tlsSecret := fs.String("tls-secret", "", "kubernetes.io/tls secret to serve the certificate of, as namespace/name (default namespace the pod's)")
+	selfSigned := fs.Bool("self-signed-tls", false, "generate a self-signed CA and certificate into --tls-secret, and renew them before they expire")
+	webhookService := fs.String("webhook-service", "", "service the self-signed certificate is issued for, as namespace/name")
+	webhookConfig := fs.String("webhook-config", "", "ValidatingWebhookConfiguration whose caBundle is set to the self-signed CA")
+	tlsReload := fs.Duration("tls-reload-interval", time.Minute, "how often to reload the TLS certificate, to pick up rotated certificates")
+	policyPath := fs.String("admission-policy", "", "YAML file, https:// URL or oci:// reference of CEL rules deciding to admit, deny or warn about an image")
+	var policySigner PolicySigner
+	fs.StringVar(&policySigner.Subject, "policy-signer-subject", "", "identity the --admission-policy must be signed by; required for policies fetched from a URL or registry")
+	fs.StringVar(&policySigner.SubjectRegexp, "policy-signer-subject-regexp", "", "regular expression the identity signing the --admission-policy must match")
+	fs.StringVar(&policySigner.GitHubWorkflow, "policy-signer-workflow", "", "workflow the --admission-policy must be signed by, as owner/repo/.github/workflows/<file>@<ref>")
+	fs.StringVar(&policySigner.Issuer, "policy-signer-issuer", "", "OIDC issuer of the identity signing the --admission-policy (default the --issuer)")
+	policyCRDs := fs.Bool("policy-crds", false, "verify images against the ImageVerificationPolicy resources applying to them, instead of the policy flags")
+	pullSecrets := fs.Bool("pull-secrets", false, "pull the images to verify with the imagePullSecrets of their pods and service accounts, like the kubelet")
+	trustRefresh := fs.Duration("trust-refresh-interval", time.Hour, "how often to refresh the trusted root from TUF")
+	reverifyInterval := fs.Duration("reverify-interval", 0, "how often to verify again the images of every running pod, emitting a warning Event on the pods whose images no longer pass (0 disables it)")
+	budget := fs.Duration("request-budget", 0, "how long the images of an admission request may take to verify (default the webhook timeout sent by the API server, minus 1s)")
+	onTimeout := fs.String("on-timeout", onErrorFail, "what to do with images whose verification exceeds the request budget: fail to deny them, warn or skip to admit them")
+	fs.DurationVar(&opts.MissingAttestationsTTL, "missing-attestations-ttl", 30*time.Second, "how long to remember the digests without any attestation instead of looking them up again, 0 to always look them up")
+	pprofListen := fs.String("pprof-listen", "", "address to serve the Go runtime profiles on /debug/pprof/, e.g. localhost:6060, to profile the memory and CPU of the verifications; kept off the webhook listener")
+	preflight := fs.Bool("preflight", true, "run the preflight checks on startup, and exit instead of serving when one fails")
+	var preflightImages stringsFlag
+	fs.Var(&preflightImages, "preflight-image", "image whose attestations the preflight checks look up, checking its registry and credentials (repeatable)")
+	leaderLease := fs.String("leader-election-lease", "", "Lease electing the replica that runs --reverify-interval, as namespace/name (default namespace the pod's); without it every replica does")
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:     "serve",
+		Short:   "Serve a Kubernetes validating admission webhook verifying the images of admitted objects",
+		Example: "  serve --listen :8443 --tls-cert tls.crt --tls-key tls.key --admission-policy policy.yaml --subject-regexp '^https://github.com/nirmata/.*$'\n  serve --self-signed-tls --tls-secret verify/webhook-tls --webhook-service verify/verify-webhook --webhook-config verify-images --subject \"...\"",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if err := validateOnError(opts.OnError); err != nil {
+			return err
+		}
+		if err := validateOnTimeout(*onTimeout); err != nil {
+			return err
+		}
+		loadCert, err := webhookCertLoader(*tlsCert, *tlsKey, *tlsSecret, *selfSigned, *webhookService, *webhookConfig)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		// the webhook only listens, and so only reports ready, once the checks pass
+		if *preflight {
+			if err := writePreflight(os.Stderr, runPreflight(ctx, opts, preflightImages)); err != nil {
+				return err
+			}
+		}
+		trust, err := NewTrustProvider(ctx, opts, *trustRefresh)
+		if err != nil {
+			return err
+		}
+		policy := &AdmissionPolicy{}
+		if *policyPath != "" {
+			data, err := readAdmissionPolicy(ctx, *policyPath, policySigner, trust.TrustedRoot(), opts)
+			if err != nil {
+				return err
+			}
+			if policy, err = parseAdmissionPolicy(*policyPath, data); err != nil {
+				return err
+			}
+		}
+
+		s := &admissionServer{opts: opts, trust: trust, policy: policy, budget: *budget, onTimeout: *onTimeout}
+		if *policyCRDs {
+			if s.policies, err = newPolicyStore(); err != nil {
+				return err
+			}
+			if err := s.policies.sync(ctx); err != nil {
+				return err
+			}
+		}
+		if *pullSecrets {
+			if s.pullSecrets, err = newPullSecretResolver(); err != nil {
+				return err
+			}
+		}
+		if *reverifyInterval > 0 {
+			reverifier, err := newReverifier(s, *leaderLease)
+			if err != nil {
+				return err
+			}
+			go reverifier.run(ctx, *reverifyInterval)
+		} else if *leaderLease != "" {
+			return errors.New("--leader-election-lease requires --reverify-interval")
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/validate", s.handleValidate)
+		mux.Handle("/metrics", &s.metrics)
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+		server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+		if *pprofListen != "" {
+			go servePprof(ctx, *pprofListen)
+		}
+
+		if loadCert != nil {
+			certs, err := newCertReloader(ctx, loadCert, *tlsReload)
+			if err != nil {
+				return err
+			}
+			server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}
+		}
+
+		fmt.Fprintf(os.Stderr, "serving admission webhook on %s\n", *listen)
+		if loadCert != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
+}
+
+// servePprof serves the runtime profiles on their own listener, so that they are never exposed to
+// whoever can reach the webhook
+func servePprof(ctx context.Context, listen string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "serving profiles on %s\n", listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "failed to serve profiles: %v\n", err)
+	}
+}
+
+// maxAdmissionReviewSize bounds the body of a review, which holds the object and, on updates, its old
+// version, each limited to 1.5 MiB by etcd
+const maxAdmissionReviewSize = 4 << 20
+
+func (s *admissionServer) handleValidate(w http.ResponseWriter, r *http.Request) {
+	var review AdmissionReview
+	body := http.MaxBytesReader(w, r.Body, maxAdmissionReviewSize)
+	if err := json.NewDecoder(body).Decode(&review); err != nil || review.Request == nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("AdmissionReview exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "expected an AdmissionReview with a request", http.StatusBadRequest)
+		return
+	}
+	budget := s.requestBudget(r)
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	defer cancel()
+	review.Response = s.review(ctx, review.Request, budget)
+	review.Request = nil
+	reviewBytes, err := json.Marshal(review)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode the admission response: %v\n", err)
+		http.Error(w, "failed to encode the admission response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(reviewBytes); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the admission response: %v\n", err)
+	}
+}
+
+// review verifies every image of the object and applies the admission policy to each of them.
+// The object is denied if any of its images is.
+func (s *admissionServer) review(ctx context.Context, request map[string]any, budget time.Duration) *AdmissionResponse {
+	uid, _ := request["uid"].(string)
+	response := &AdmissionResponse{UID: uid, Allowed: true}
+	s.metrics.reviews.Add(1)
+	images := uniqueImages(extractImages(request["object"]))
+	if len(images) == 0 {
+		return response
+	}
+
+	namespace, _ := request["namespace"].(string)
+	if s.pullSecrets != nil {
+		kc, err := s.pullSecrets.keychain(ctx, namespace, request["object"])
+		if err != nil {
+			// the images may still be public, or covered by the default keychain
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		} else {
+			ctx = withKeychain(ctx, kc)
+		}
+	}
+	targets := make([]imageTarget, len(images))
+	for i, image := range images {
+		targets[i] = imageTarget{namespace: namespace, image: image}
+	}
+	start := time.Now()
+	outcomes := s.verifyWithinBudget(ctx, targets, budget)
+	s.metrics.observeLatency(time.Since(start))
+	if err := recordOutcomes(s.opts, outcomes...); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	var denials []string
+	timedOut := 0
+	for _, outcome := range outcomes {
+		action, rule := s.policy.decide(request, outcome)
+		reason := "verified"
+		err := firstError(outcome.Err, outcome.Warning, outcome.Skipped)
+		if err != nil {
+			reason = err.Error()
+		}
+		if rule != "" {
+			reason = fmt.Sprintf("rule %s: %s", rule, reason)
+		}
+		switch action {
+		case admissionDeny:
+			denials = append(denials, fmt.Sprintf("%s: %s", outcome.Image, reason))
+			if errors.As(err, new(VerificationTimeoutError)) {
+				timedOut++
+			}
+		case admissionWarn:
+			response.Warnings = append(response.Warnings, fmt.Sprintf("%s: %s", outcome.Image, reason))
+		}
+	}
+	switch {
+	case len(denials) > 0 && timedOut == len(denials):
+		s.metrics.denied.Add(1)
+		response.Allowed = false
+		response.Status = &AdmissionStatus{Code: http.StatusGatewayTimeout, Reason: "Timeout", Message: "image verification timed out: " + strings.Join(denials, "; ")}
+	case len(denials) > 0:
+		s.metrics.denied.Add(1)
+		response.Allowed = false
+		response.Status = &AdmissionStatus{Code: http.StatusForbidden, Reason: "Forbidden", Message: "image verification failed: " + strings.Join(denials, "; ")}
+	case len(response.Warnings) > 0:
+		s.metrics.warned.Add(1)
+	}
+	return response
+}
+
+func uniqueImages(images []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(images))
+	for _, image := range images {
+		if !seen[image] {
+			seen[image] = true
+			unique = append(unique, image)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,334 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/spf13/cobra"
+)
+
+const shellHelp = `commands:
+  image <ref>            look up the attestations of an image
+  list                   list the attestations of the image again
+  show <n>               print the decoded statement of attestation n
+  inspect <n>            decode attestation n: certificate, extensions, tlog entries and timestamps
+  set <flag> <value>     set a policy flag, e.g. set subject-regexp ^https://github.com/nirmata/
+  unset <flag>           reset a policy flag to its default
+  policy                 print the policy flags that were set
+  verify                 verify the attestations of the image against the policy
+  help                   print this help
+  quit                   exit`
+
+func newShellCommand() *cobra.Command {
+	fs := flag.NewFlagSet("shell", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "shell [image]",
+		Short: "Explore the attestations of images interactively and try policies on them",
+		Long: `Start an interactive session to look up the attestations of an image, browse them, decode their
+statements and certificates, and verify them against a policy edited with set and unset as you go.
+The policy flags given on the command line are the starting policy. Commands are read line by line
+from the terminal, so a session can also be scripted by piping commands to stdin.`,
+		Args:    cobra.MaximumNArgs(1),
+		Example: "  shell ghcr.io/nirmata/github-signing-demo:latest",
+	}, func(args []string) error {
+		s := newShell(fs, &opts, os.Stdin, os.Stdout)
+		applyGitHubHost(&opts)
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			s.lookUp(context.TODO(), args[0])
+		}
+		return s.run(context.TODO())
+	})
+}
+
+// shell is an interactive session over an image and its attestations
+type shell struct {
+	in  *bufio.Scanner
+	out io.Writer
+	fs  *flag.FlagSet
+	// opts are the options the flags of fs are bound to, which set changes
+	opts *VerificationOptions
+	// explicit are the policy flags set on the command line or with set
+	explicit map[string]string
+
+	image       string
+	desc        *v1.Descriptor
+	bundles     []*Bundle
+	trustedRoot *root.TrustedRoot
+}
+
+// newShell starts a session whose policy is the policy flags of fs set on the command line
+func newShell(fs *flag.FlagSet, opts *VerificationOptions, in io.Reader, out io.Writer) *shell {
+	s := &shell{in: bufio.NewScanner(in), out: out, fs: fs, opts: opts, explicit: map[string]string{}}
+	fs.VisitAll(func(f *flag.Flag) {
+		if value := f.Value.String(); value != f.DefValue {
+			s.explicit[f.Name] = value
+		}
+	})
+	return s
+}
+
+func (s *shell) run(ctx context.Context) error {
+	fmt.Fprintln(s.out, `type "help" for the commands`)
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return s.in.Err()
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(s.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "":
+		case "image":
+			s.lookUp(ctx, arg)
+		case "list":
+			s.list()
+		case "show", "inspect":
+			b, err := s.bundle(arg)
+			if err != nil {
+				fmt.Fprintln(s.out, err)
+				break
+			}
+			if command == "show" {
+				err = printPayload(s.out, b)
+			} else {
+				err = s.inspect(arg, b)
+			}
+			if err != nil {
+				fmt.Fprintln(s.out, err)
+			}
+		case "set", "unset":
+			if err := s.set(command, arg); err != nil {
+				fmt.Fprintln(s.out, err)
+			}
+		case "policy":
+			s.policy()
+		case "verify":
+			s.verify(ctx)
+		case "help", "?":
+			fmt.Fprintln(s.out, shellHelp)
+		case "quit", "exit", "q":
+			return nil
+		default:
+			fmt.Fprintf(s.out, "unknown command %q, type \"help\" for the commands\n", command)
+		}
+	}
+}
+
+// lookUp resolves the image and fetches its attestations from the bundle sources
+func (s *shell) lookUp(ctx context.Context, image string) {
+	if image == "" {
+		fmt.Fprintln(s.out, "usage: image <ref>")
+		return
+	}
+	bundles, desc, err := resolveBundles(ctx, image, *s.opts)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	s.image, s.desc, s.bundles = image, desc, bundles
+	fmt.Fprintf(s.out, "%s resolved to %s\n", image, desc.Digest)
+	s.list()
+}
+
+// list prints the attestations of the image, numbered for show, inspect and verify
+func (s *shell) list() {
+	if s.image == "" {
+		fmt.Fprintln(s.out, "no image yet, look one up with: image <ref>")
+		return
+	}
+	if len(s.bundles) == 0 {
+		fmt.Fprintf(s.out, "no attestations found for %s\n", s.image)
+		return
+	}
+	tw := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPREDICATE TYPE\tISSUER\tSUBJECT")
+	for i, b := range s.bundles {
+		predicate, issuer, subject := describeAttestation(b)
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, predicate, issuer, subject)
+	}
+	tw.Flush()
+}
+
+// describeAttestation returns the predicate type of an attestation, or its payload type or parse
+// error, and the issuer and subject of its signer
+func describeAttestation(b *Bundle) (predicate, issuer, subject string) {
+	predicate, issuer, subject = "-", "-", "-"
+	if b.ParseErr != nil {
+		predicate = b.ParseErr.Error()
+	} else if b.DSSE_Envelope != nil {
+		predicate = b.DSSE_Envelope.PredicateType
+	} else if b.PayloadType != "" {
+		predicate = b.PayloadType
+	}
+	if signer, ok := signerSummary(b); ok {
+		issuer, subject = signer.Extensions.Issuer, signer.SubjectAlternativeName
+	}
+	return predicate, issuer, subject
+}
+
+// bundle returns the attestation numbered n by list
+func (s *shell) bundle(n string) (*Bundle, error) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(s.bundles) {
+		return nil, fmt.Errorf("expected an attestation number between 1 and %d", len(s.bundles))
+	}
+	return s.bundles[i-1], nil
+}
+
+func (s *shell) inspect(n string, b *Bundle) error {
+	if b.ParseErr != nil {
+		return b.ParseErr
+	}
+	data, err := b.ProtoBundle.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return inspectBundle(s.out, "attestation "+n, data)
+}
+
+// set sets or resets a policy flag. Flags that can be repeated, like predicate-type, are reset
+// before being set, so that set replaces the value rather than adding to it.
+func (s *shell) set(command, arg string) error {
+	name, value, _ := strings.Cut(arg, " ")
+	name = strings.TrimPrefix(name, "--")
+	value = strings.TrimSpace(value)
+	f := s.fs.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	if command == "set" && value == "" {
+		return errors.New("usage: set <flag> <value>")
+	}
+	if err := resetFlag(f); err != nil {
+		return err
+	}
+	delete(s.explicit, name)
+	if command == "unset" {
+		return nil
+	}
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	s.explicit[name] = f.Value.String()
+	return nil
+}
+
+// resetFlag sets a flag back to its default, emptying the flags that collect repeated values
+func resetFlag(f *flag.Flag) error {
+	switch v := f.Value.(type) {
+	case *stringsFlag:
+		*v = nil
+		return nil
+	case *requirementFlags:
+		*v = nil
+		return nil
+	case *annotationFlags:
+		*v = nil
+		return nil
+	case *assertionFlags:
+		*v = nil
+		return nil
+	case *predicatePluginFlags:
+		*v = nil
+		return nil
+	case *signatureAlgorithmsFlag:
+		*v = nil
+		return nil
+	case *ageFlag:
+		*v = 0
+		return nil
+	case *timeFlag:
+		*v = timeFlag{}
+		return nil
+	}
+	return f.Value.Set(f.DefValue)
+}
+
+func (s *shell) policy() {
+	flags := s.policyFlags()
+	if len(flags) == 0 {
+		fmt.Fprintln(s.out, "no policy flags set, the defaults apply")
+		return
+	}
+	for _, f := range flags {
+		fmt.Fprintf(s.out, "  %s\n", f)
+	}
+}
+
+// policyFlags returns the policy flags that were set, as --<flag> <value>
+func (s *shell) policyFlags() []string {
+	var flags []string
+	s.fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := s.explicit[f.Name]; ok {
+			flags = append(flags, fmt.Sprintf("--%s %s", f.Name, value))
+		}
+	})
+	return flags
+}
+
+// policyOptions returns the options of the current policy. --github-workflow is expanded into the
+// subject, so it is applied to a copy of the policy.
+func (s *shell) policyOptions() (VerificationOptions, error) {
+	opts := *s.opts
+	if err := applyGitHubWorkflows(&opts); err != nil {
+		return VerificationOptions{}, err
+	}
+	return opts, nil
+}
+
+// verify verifies the attestations already fetched against the current policy
+func (s *shell) verify(ctx context.Context) {
+	if s.image == "" {
+		fmt.Fprintln(s.out, "no image yet, look one up with: image <ref>")
+		return
+	}
+	opts, err := s.policyOptions()
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	if s.trustedRoot == nil {
+		trustedRoot, err := getTrustedRoot(ctx, opts)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		s.trustedRoot = trustedRoot
+	}
+	results, err := verifyAttestations(ctx, s.image, s.bundles, s.desc, s.trustedRoot, opts)
+	if err != nil {
+		fmt.Fprintf(s.out, "✗ %v\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "✓ %d attestations of %s verified\n", len(results), s.image)
+	for _, result := range results {
+		predicateType := "-"
+		if result.Bundle.DSSE_Envelope != nil {
+			predicateType = result.Bundle.DSSE_Envelope.PredicateType
+		}
+		signer := "key"
+		if summary, ok := signerSummary(result.Bundle); ok {
+			signer = summary.SubjectAlternativeName
+		}
+		fmt.Fprintf(s.out, "  %s signed by %s\n", predicateType, signer)
+	}
+}
@@ -0,0 +1,86 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// signatureAlgorithms are the names --allowed-signature-algorithms accepts
+var signatureAlgorithms = []string{"ecdsa-p256", "ecdsa-p384", "ecdsa-p521", "ed25519", "rsa-2048", "rsa-3072", "rsa-4096"}
+
+// signatureAlgorithmsFlag collects the allowed signature algorithms, comma-separated or repeated
+type signatureAlgorithmsFlag []string
+
+func (s *signatureAlgorithmsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s signatureAlgorithmsFlag) contains(algorithm string) bool {
+	return slices.Contains(s, algorithm)
+}
+
+func (s *signatureAlgorithmsFlag) Set(value string) error {
+	for _, algorithm := range strings.Split(value, ",") {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if !slices.Contains(signatureAlgorithms, algorithm) {
+			return fmt.Errorf("unknown signature algorithm %q, expected one of %s", algorithm, strings.Join(signatureAlgorithms, ", "))
+		}
+		*s = append(*s, algorithm)
+	}
+	return nil
+}
+
+// signatureAlgorithm names the algorithm of a public key, e.g. ecdsa-p256
+func signatureAlgorithm(publicKey crypto.PublicKey) string {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return "ecdsa-p256"
+		case elliptic.P384():
+			return "ecdsa-p384"
+		case elliptic.P521():
+			return "ecdsa-p521"
+		}
+		return "ecdsa-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "ed25519"
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa-%d", key.N.BitLen())
+	}
+	return fmt.Sprintf("%T", publicKey)
+}
+
+// checkSignatureAlgorithm applies --allowed-signature-algorithms to the key that signed a bundle or,
+// when verifying with --key, to that key
+func checkSignatureAlgorithm(publicKey crypto.PublicKey, allowed signatureAlgorithmsFlag) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	if algorithm := signatureAlgorithm(publicKey); !allowed.contains(algorithm) {
+		return fmt.Errorf("signature algorithm not allowed: signed with %s, expected one of %s", algorithm, allowed.String())
+	}
+	return nil
+}
+
+// checkBundleSignatureAlgorithm checks the leaf certificate of a keyless bundle. Bundles signed with
+// a key only name it with a hint, so their key is the --key checked when it is loaded.
+func checkBundleSignatureAlgorithm(bundle *Bundle, allowed signatureAlgorithmsFlag) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	content, err := bundle.ProtoBundle.VerificationContent()
+	if err != nil {
+		return err
+	}
+	if cert := content.Certificate(); cert != nil {
+		return checkSignatureAlgorithm(cert.PublicKey, allowed)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// BundleSource discovers the sigstore bundles attached to an image digest
+type BundleSource interface {
+	Name() string
+	Bundles(ctx context.Context, ref name.Reference, desc *v1.Descriptor) ([]*Bundle, error)
+}
+
+// StreamingBundleSource is implemented by sources that discover bundles lazily, so that callers
+// can stop fetching once they have seen enough bundles
+type StreamingBundleSource interface {
+	BundleSource
+	// StreamBundles calls yield for every bundle until yield returns false or an error
+	StreamBundles(ctx context.Context, ref name.Reference, desc *v1.Descriptor, yield func(*Bundle) (bool, error)) error
+}
+
+// bundleSourceFactory creates a bundle source from the command line options
+type bundleSourceFactory func(opts VerificationOptions) (BundleSource, error)
+
+var bundleSources = map[string]bundleSourceFactory{}
+
+// registerBundleSource makes a bundle source selectable with --source
+func registerBundleSource(name string, factory bundleSourceFactory) {
+	bundleSources[name] = factory
+}
+
+func bundleSourceNames() []string {
+	names := make([]string, 0, len(bundleSources))
+	for name := range bundleSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	registerBundleSource("oci", func(opts VerificationOptions) (BundleSource, error) {
+		return &OCIReferrersSource{Limit: opts.Limit, ArtifactTypes: opts.ArtifactTypes, MaxBundleSize: opts.MaxBundleSize, Annotations: opts.ReferrerAnnotations, Timing: opts.Timing}, nil
+	})
+	registerBundleSource("file", func(opts VerificationOptions) (BundleSource, error) {
+		if opts.BundlePath == "" {
+			return nil, errors.New("--bundle-path is required for the file bundle source")
+		}
+		return &FileSource{Path: opts.BundlePath}, nil
+	})
+	registerBundleSource("github", func(opts VerificationOptions) (BundleSource, error) {
+		if opts.GitHubRepo == "" {
+			return nil, errors.New("--github-repo is required for the github bundle source")
+		}
+		return &GitHubAPISource{APIURL: opts.GitHubAPIURL, Repo: opts.GitHubRepo, Token: os.Getenv("GITHUB_TOKEN"), Tokens: opts.GitHubTokens}, nil
+	})
+	registerBundleSource("rekor", func(opts VerificationOptions) (BundleSource, error) {
+		return &RekorSearchSource{URL: opts.RekorURL, Limit: opts.Limit}, nil
+	})
+}
+
+// newBundleSources creates the sources selected with --source
+func newBundleSources(opts VerificationOptions) ([]BundleSource, error) {
+	names := []string(opts.Sources)
+	if len(names) == 0 {
+		names = []string{"oci"}
+		if opts.BundlePath != "" {
+			names = []string{"file"}
+		}
+	}
+
+	sources := make([]BundleSource, 0, len(names))
+	for _, name := range names {
+		factory, ok := bundleSources[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown bundle source %q, expected one of %s", name, strings.Join(bundleSourceNames(), ", "))
+		}
+		source, err := factory(opts)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// resolveBundles returns the image descriptor and the bundles found in all selected sources
+func resolveBundles(ctx context.Context, image string, opts VerificationOptions) ([]*Bundle, *v1.Descriptor, error) {
+	ref, desc, err := resolveDescriptor(ctx, image, opts.digestAlgorithm())
+	if err != nil {
+		return nil, nil, err
+	}
+	bundles := make([]*Bundle, 0)
+	err = streamImageBundles(ctx, ref, desc, opts, func(b *Bundle) (bool, error) {
+		bundles = append(bundles, b)
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return bundles, desc, nil
+}
+
+// streamImageBundles yields the bundles of all selected sources, falling back to a Rekor search
+// when enabled and no source returned a bundle
+func streamImageBundles(ctx context.Context, ref name.Reference, desc *v1.Descriptor, opts VerificationOptions, yield func(*Bundle) (bool, error)) error {
+	sources, err := newBundleSources(opts)
+	if err != nil {
+		return err
+	}
+	found := false
+	err = streamBundles(ctx, sources, ref, desc, func(b *Bundle) (bool, error) {
+		found = true
+		return yield(b)
+	})
+	if err != nil {
+		return err
+	}
+	// older pipelines only uploaded attestations to Rekor and never attached referrers
+	if !found && opts.EnableRekorSearch {
+		return streamBundles(ctx, []BundleSource{&RekorSearchSource{URL: opts.RekorURL, Limit: opts.Limit}}, ref, desc, yield)
+	}
+	return nil
+}
+
+// resolveDescriptor computes the descriptor of local images and of digest references, and fetches it
+// from the registry for tags. The returned reference is nil for local images. Descriptors built from a
+// digest reference only have the digest, since only the registry knows the media type and size.
+// The image may be any OCI artifact, e.g. a Helm chart or a WASM module.
+func resolveDescriptor(ctx context.Context, image, algorithm string) (name.Reference, *v1.Descriptor, error) {
+	if isLocalImage(image) {
+		desc, err := resolveLocalDescriptor(image, algorithm)
+		return nil, desc, err
+	}
+
+	ref, err := parseImageReference(image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse image reference %s: %w", image, err)
+	}
+	if ref, err = pullReference(ref); err != nil {
+		return nil, nil, err
+	}
+	if digestRef, ok := ref.(name.Digest); ok {
+		digest, err := parseDigest(digestRef.DigestStr())
+		if err != nil {
+			return nil, nil, err
+		}
+		if digest.Algorithm != algorithm {
+			return nil, nil, fmt.Errorf("%s is referenced by a %s digest, but --digest-algorithm is %s", image, digest.Algorithm, algorithm)
+		}
+		return ref, &v1.Descriptor{Digest: digest}, nil
+	}
+	desc, err := fetchArtifactDescriptor(ctx, ref, algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ref, desc, nil
+}
+
+// streamBundles merges the bundles of all sources, dropping attestations already returned by an
+// earlier source, until yield returns false
+func streamBundles(ctx context.Context, sources []BundleSource, ref name.Reference, desc *v1.Descriptor, yield func(*Bundle) (bool, error)) error {
+	seen := make(map[string]bool)
+	more := true
+	dedupe := func(b *Bundle) (bool, error) {
+		digest, err := bundleDigest(b)
+		if err != nil {
+			return false, err
+		}
+		if seen[digest] {
+			return true, nil
+		}
+		seen[digest] = true
+		more, err = yield(b)
+		return more, err
+	}
+
+	for _, source := range sources {
+		var err error
+		if streaming, ok := source.(StreamingBundleSource); ok {
+			err = streaming.StreamBundles(ctx, ref, desc, dedupe)
+		} else {
+			var found []*Bundle
+			found, err = source.Bundles(ctx, ref, desc)
+			for _, b := range found {
+				if err != nil || !more {
+					break
+				}
+				_, err = dedupe(b)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s bundle source: %w", source.Name(), err)
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// bundleDigest identifies a bundle by what was signed and by its signature, so that the same
+// attestation returned by several sources is verified and counted once, even when the sources
+// serve it with different verification material
+func bundleDigest(b *Bundle) (string, error) {
+	if b.ParseErr != nil {
+		return hex.EncodeToString(b.id), nil
+	}
+	sum := sha256.New()
+	if envelope := b.ProtoBundle.Bundle.GetDsseEnvelope(); envelope != nil {
+		payloadDigest := sha256.Sum256(envelope.Payload)
+		fmt.Fprintf(sum, "dsse\n%s\n%x\n", envelope.PayloadType, payloadDigest)
+		for _, signature := range envelope.Signatures {
+			fmt.Fprintf(sum, "%x\n", signature.Sig)
+		}
+	} else if message := b.ProtoBundle.Bundle.GetMessageSignature(); message != nil {
+		fmt.Fprintf(sum, "message\n%x\n%x\n", message.GetMessageDigest().GetDigest(), message.Signature)
+	} else {
+		bundleBytes, err := b.ProtoBundle.MarshalJSON()
+		if err != nil {
+			return "", err
+		}
+		sum.Write(bundleBytes)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// FileSource reads bundles from a file or a directory of .json files
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Name() string {
+	return "file"
+}
+
+func (s *FileSource) Bundles(_ context.Context, _ name.Reference, _ *v1.Descriptor) ([]*Bundle, error) {
+	return loadBundles(s.Path)
+}
+
+// GitHubAPISource looks up attestations by digest with the GitHub attestations API
+type GitHubAPISource struct {
+	APIURL string
+	// Repo is either owner/repo, or an owner to search all of its repositories
+	Repo  string
+	Token string
+	// Tokens provides the token instead of Token when set
+	Tokens *GitHubTokenSource
+	// Client sends the requests, by default a client of the configured transport
+	Client *http.Client
+}
+
+type gitHubAttestationsResponse struct {
+	Attestations []struct {
+		Bundle json.RawMessage `json:"bundle"`
+	} `json:"attestations"`
+}
+
+func (s *GitHubAPISource) Name() string {
+	return "github"
+}
+
+func (s *GitHubAPISource) Bundles(ctx context.Context, _ name.Reference, desc *v1.Descriptor) ([]*Bundle, error) {
+	endpoint := fmt.Sprintf("%s/orgs/%s/attestations/%s", strings.TrimSuffix(s.APIURL, "/"), s.Repo, desc.Digest)
+	if strings.Contains(s.Repo, "/") {
+		endpoint = fmt.Sprintf("%s/repos/%s/attestations/%s", strings.TrimSuffix(s.APIURL, "/"), s.Repo, desc.Digest)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	token := s.Token
+	if s.Tokens != nil {
+		if token, err = s.Tokens.Token(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = newAPIClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPStatusError(resp, "failed to fetch attestations from %s", endpoint)
+	}
+
+	var attestations gitHubAttestationsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&attestations); err != nil {
+		return nil, fmt.Errorf("failed to decode attestations response: %w", err)
+	}
+
+	bundles := make([]*Bundle, 0, len(attestations.Attestations))
+	for _, attestation := range attestations.Attestations {
+		b, err := parseBundle(attestation.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles, nil
+}
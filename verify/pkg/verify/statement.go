@@ -0,0 +1,117 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/in-toto/in-toto-golang/in_toto"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+)
+
+const inTotoStatementV1 = "https://in-toto.io/Statement/v1"
+
+// SBOM is the document of an SPDX or CycloneDX attestation
+type SBOM struct {
+	// Format is spdx or cyclonedx
+	Format   string
+	Document json.RawMessage
+}
+
+// decodeStatement returns the in-toto statement carried in the bundle's DSSE envelope, or nil if
+// the bundle does not contain one. Statements that don't match the in-toto schema are an error.
+func decodeStatement(b *bundle.ProtobufBundle) (*in_toto.Statement, error) {
+	dsseEnvelope := b.Bundle.GetDsseEnvelope()
+	if dsseEnvelope == nil || dsseEnvelope.PayloadType != inTotoPayloadType {
+		return nil, nil
+	}
+	var statement in_toto.Statement
+	if err := json.Unmarshal(dsseEnvelope.Payload, &statement); err != nil {
+		return nil, fmt.Errorf("invalid in-toto statement: %w", err)
+	}
+	if err := validateStatement(&statement); err != nil {
+		return nil, fmt.Errorf("invalid in-toto statement: %w", err)
+	}
+	return &statement, nil
+}
+
+// validateStatement checks the fields the in-toto v1 schema requires. v0.1 statements, which
+// older tools still produce, have the same shape.
+func validateStatement(statement *in_toto.Statement) error {
+	if statement.Type != inTotoStatementV1 && statement.Type != in_toto.StatementInTotoV01 {
+		return fmt.Errorf("unsupported _type %q", statement.Type)
+	}
+	if statement.PredicateType == "" {
+		return errors.New("missing predicateType")
+	}
+	if len(statement.Subject) == 0 {
+		return errors.New("missing subject")
+	}
+	for i, subject := range statement.Subject {
+		if len(subject.Digest) == 0 {
+			return fmt.Errorf("subject #%d has no digest", i+1)
+		}
+	}
+	return nil
+}
+
+// RawPredicate returns the predicate of the bundle's in-toto statement as is
+func (b *Bundle) RawPredicate() (json.RawMessage, error) {
+	if b.DSSE_Envelope == nil {
+		return nil, errors.New("bundle has no in-toto statement")
+	}
+	var statement struct {
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(b.Payload, &statement); err != nil {
+		return nil, err
+	}
+	return statement.Predicate, nil
+}
+
+// Provenance returns the predicate of a SLSA v1 provenance attestation
+func (b *Bundle) Provenance() (*slsa1.ProvenancePredicate, error) {
+	predicate, err := b.predicate(slsa1.PredicateSLSAProvenance)
+	if err != nil {
+		return nil, err
+	}
+	var provenance slsa1.ProvenancePredicate
+	if err := json.Unmarshal(predicate, &provenance); err != nil {
+		return nil, fmt.Errorf("invalid SLSA provenance: %w", err)
+	}
+	return &provenance, nil
+}
+
+// SBOM returns the document of an SPDX or CycloneDX attestation, of any version
+func (b *Bundle) SBOM() (*SBOM, error) {
+	if b.DSSE_Envelope == nil {
+		return nil, errors.New("bundle has no in-toto statement")
+	}
+	var format string
+	switch predicateType := b.DSSE_Envelope.PredicateType; {
+	case strings.HasPrefix(predicateType, in_toto.PredicateSPDX):
+		format = "spdx"
+	case strings.HasPrefix(predicateType, in_toto.PredicateCycloneDX):
+		format = "cyclonedx"
+	default:
+		return nil, fmt.Errorf("predicate type %s is not an SBOM", predicateType)
+	}
+	document, err := b.RawPredicate()
+	if err != nil {
+		return nil, err
+	}
+	return &SBOM{Format: format, Document: document}, nil
+}
+
+// predicate returns the raw predicate after checking the predicate type
+func (b *Bundle) predicate(predicateType string) (json.RawMessage, error) {
+	if b.DSSE_Envelope == nil {
+		return nil, errors.New("bundle has no in-toto statement")
+	}
+	if b.DSSE_Envelope.PredicateType != predicateType {
+		return nil, fmt.Errorf("predicate type is %s, not %s", b.DSSE_Envelope.PredicateType, predicateType)
+	}
+	return b.RawPredicate()
+}
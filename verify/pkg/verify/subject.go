@@ -0,0 +1,28 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// checkStatementSubject fails unless one of the subjects of the bundle's in-toto statement carries
+// the image digest. sigstore-go checks this too, but reports it as a signature failure.
+func checkStatementSubject(b *Bundle, desc *v1.Descriptor) error {
+	statement := b.DSSE_Envelope
+	if statement == nil {
+		return errors.New("missing in-toto statement")
+	}
+	subjects := make([]string, 0, len(statement.Subject))
+	for _, subject := range statement.Subject {
+		if digest, ok := subject.Digest[desc.Digest.Algorithm]; ok && strings.EqualFold(digest, desc.Digest.Hex) {
+			return nil
+		}
+		for algorithm, digest := range subject.Digest {
+			subjects = append(subjects, fmt.Sprintf("%s@%s:%s", subject.Name, algorithm, digest))
+		}
+	}
+	return fmt.Errorf("attestation subject does not reference this image %s, it references %s", desc.Digest, strings.Join(subjects, ", "))
+}
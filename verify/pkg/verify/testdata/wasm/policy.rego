@@ -0,0 +1,13 @@
+# policy.wasm is built from this file with:
+#   opa build -t wasm -e policy/decision policy.rego && tar xzf bundle.tar.gz /policy.wasm
+package policy
+
+import rego.v1
+
+# decision is undefined for images without attestations
+decision := {"allow": true} if {
+	some attestation in input.attestations
+	attestation.predicateType == "https://slsa.dev/provenance/v1"
+} else := {"allow": false, "reason": "no SLSA provenance"} if {
+	count(input.attestations) > 0
+}
@@ -0,0 +1,44 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Timing accumulates where verification spent its time, reported by --stats. It is shared by images
+// verified concurrently, so phases are added with add.
+type Timing struct {
+	mu       sync.Mutex
+	TUF      time.Duration
+	Lookup   time.Duration
+	Download time.Duration
+	Verify   time.Duration
+}
+
+// add adds elapsed to a phase of t
+func (t *Timing) add(phase *time.Duration, elapsed time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*phase += elapsed
+}
+
+// BundleTiming is the time spent on a single bundle
+type BundleTiming struct {
+	Download time.Duration
+	Verify   time.Duration
+}
+
+// printStats prints the overall timing of a verification, then the timing of each verified bundle
+func printStats(w io.Writer, total time.Duration, timing *Timing, results []VerificationResult) {
+	fmt.Fprintf(w, "total %s: tuf %s, referrers lookup %s, bundle download %s, verify %s\n",
+		round(total), round(timing.TUF), round(timing.Lookup), round(timing.Download), round(timing.Verify))
+	for i, result := range results {
+		fmt.Fprintf(w, "  bundle #%d: download %s, verify %s\n", i+1, round(result.Timing.Download), round(result.Timing.Verify))
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,201 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// ProvenanceNode is an image and the images its verified provenance says it was built from
+type ProvenanceNode struct {
+	Image        string
+	Digest       string
+	Err          error
+	Dependencies []*ProvenanceNode
+}
+
+// verifyProvenanceTree verifies, with the same policy, the images the verified provenance of an
+// image names as dependencies or materials, e.g. its base image, then theirs, up to depth levels
+// below the image. Each image is verified once, even when several images depend on it.
+func verifyProvenanceTree(ctx context.Context, image string, results []VerificationResult, opts VerificationOptions, trustedMaterial *root.TrustedRoot, depth int) *ProvenanceNode {
+	// the digest pins of the image don't apply to its dependencies, which are pinned by their provenance
+	opts.ExpectedDigest = ""
+	opts.Pins = nil
+
+	node := &ProvenanceNode{Image: image}
+	if len(results) > 0 {
+		node.Digest = results[0].Desc.Digest.String()
+	}
+	visited := map[string]*ProvenanceNode{node.Digest: node}
+	var expand func(node *ProvenanceNode, results []VerificationResult, level int)
+	expand = func(node *ProvenanceNode, results []VerificationResult, level int) {
+		if level > depth {
+			return
+		}
+		for _, dependency := range provenanceDependencies(results, opts.digestAlgorithm()) {
+			_, digest, _ := strings.Cut(dependency, "@")
+			if previous, ok := visited[digest]; ok {
+				node.Dependencies = append(node.Dependencies, &ProvenanceNode{Image: dependency, Digest: digest, Err: previous.Err})
+				continue
+			}
+			child := &ProvenanceNode{Image: dependency, Digest: digest}
+			visited[digest] = child
+			node.Dependencies = append(node.Dependencies, child)
+			childResults, err := verifyImage(ctx, dependency, opts, trustedMaterial)
+			if err != nil {
+				child.Err = err
+				continue
+			}
+			expand(child, childResults, level+1)
+		}
+	}
+	expand(node, results, 1)
+	return node
+}
+
+// provenanceDependencies returns the images named in the resolved dependencies of verified SLSA v1
+// provenance, or the materials of SLSA v0.2 provenance, as digest references. Dependencies that
+// aren't container images, or have no digest of the algorithm, are left out.
+func provenanceDependencies(results []VerificationResult, algorithm string) []string {
+	var images []string
+	for _, result := range results {
+		if result.Bundle.DSSE_Envelope == nil || !strings.HasPrefix(result.Bundle.DSSE_Envelope.PredicateType, "https://slsa.dev/provenance/") {
+			continue
+		}
+		predicate, err := result.Bundle.RawPredicate()
+		if err != nil {
+			continue
+		}
+		var provenance struct {
+			BuildDefinition struct {
+				ResolvedDependencies []provenanceResource `json:"resolvedDependencies"`
+			} `json:"buildDefinition"`
+			Materials []provenanceResource `json:"materials"`
+		}
+		if err := json.Unmarshal(predicate, &provenance); err != nil {
+			continue
+		}
+		for _, resource := range append(provenance.BuildDefinition.ResolvedDependencies, provenance.Materials...) {
+			if image, ok := resource.image(algorithm); ok {
+				images = append(images, image)
+			}
+		}
+	}
+	return uniqueImages(images)
+}
+
+// provenanceResource is a resolved dependency of SLSA v1 provenance or a material of SLSA v0.2
+type provenanceResource struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// image returns the digest reference, with a digest of algorithm, of a resource that is a container
+// image, identified by a pkg:docker or pkg:oci package URL, or a docker-image://, oci:// or docker:// URI
+func (r provenanceResource) image(algorithm string) (string, bool) {
+	digest := r.Digest[algorithm]
+	if digest == "" {
+		return "", false
+	}
+	var repository string
+	switch {
+	case strings.HasPrefix(r.URI, "pkg:docker/"), strings.HasPrefix(r.URI, "pkg:oci/"):
+		repository = purlRepository(r.URI)
+	default:
+		for _, scheme := range []string{"docker-image://", "oci://", "docker://"} {
+			if rest, ok := strings.CutPrefix(r.URI, scheme); ok {
+				repository = rest
+				break
+			}
+		}
+		repository, _, _ = strings.Cut(repository, "@")
+		if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+			// drop the tag, but not the port of the registry
+			repository = repository[:i]
+		}
+	}
+	if repository == "" {
+		return "", false
+	}
+	ref, err := parseImageReference(repository + "@" + algorithm + ":" + digest)
+	if err != nil {
+		return "", false
+	}
+	return ref.String(), true
+}
+
+// purlRepository returns the repository of a pkg:docker or pkg:oci package URL. The registry comes
+// from the repository_url qualifier, which for pkg:oci is the whole repository.
+func purlRepository(purl string) string {
+	purl, qualifiers, _ := strings.Cut(purl, "?")
+	purl, _, _ = strings.Cut(purl, "#")
+	kind, path, _ := strings.Cut(strings.TrimPrefix(purl, "pkg:"), "/")
+	path, _, _ = strings.Cut(path, "@")
+	path, err := url.PathUnescape(path)
+	if err != nil {
+		return ""
+	}
+	values, err := url.ParseQuery(qualifiers)
+	if err != nil {
+		return ""
+	}
+	repositoryURL := values.Get("repository_url")
+	if kind == "oci" {
+		if repositoryURL != "" {
+			return repositoryURL
+		}
+		return path
+	}
+	if repositoryURL != "" {
+		return strings.TrimSuffix(repositoryURL, "/") + "/" + path
+	}
+	return path
+}
+
+// failure returns the first image of the tree that failed verification
+func (n *ProvenanceNode) failure() error {
+	if n.Err != nil {
+		return fmt.Errorf("dependency %s: %w", n.Image, n.Err)
+	}
+	for _, dependency := range n.Dependencies {
+		if err := dependency.failure(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printProvenanceTree prints the images of the tree, indented under the image built from them
+func printProvenanceTree(w io.Writer, node *ProvenanceNode) {
+	fmt.Fprintln(w, "provenance tree:")
+	printProvenanceNode(w, node, "", "")
+}
+
+func printProvenanceNode(w io.Writer, node *ProvenanceNode, indent, branch string) {
+	status := "✓"
+	if node.Err != nil {
+		status = "✗ " + strings.SplitN(node.Err.Error(), "\n", 2)[0]
+	}
+	image := node.Image
+	if node.Digest != "" && !strings.Contains(image, "@") {
+		image += "@" + node.Digest
+	}
+	fmt.Fprintf(w, "%s%s%s %s\n", indent, branch, image, status)
+	if branch == "├─ " {
+		indent += "│  "
+	} else if branch == "└─ " {
+		indent += "   "
+	}
+	for i, dependency := range node.Dependencies {
+		childBranch := "├─ "
+		if i == len(node.Dependencies)-1 {
+			childBranch = "└─ "
+		}
+		printProvenanceNode(w, dependency, indent, childBranch)
+	}
+}
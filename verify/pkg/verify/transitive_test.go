@@ -0,0 +1,26 @@
+package verify
+
+import "testing"
+
+func TestPurlRepository(t *testing.T) {
+	tests := []struct {
+		purl       string
+		repository string
+	}{
+		{purl: "pkg:docker/library/alpine@3.20", repository: "library/alpine"},
+		{purl: "pkg:docker/nirmata/app@sha256:abc?platform=linux%2Famd64", repository: "nirmata/app"},
+		{purl: "pkg:docker/nirmata/app@v1?repository_url=ghcr.io", repository: "ghcr.io/nirmata/app"},
+		{purl: "pkg:docker/nirmata/app?repository_url=localhost:5000/", repository: "localhost:5000/nirmata/app"},
+		{purl: "pkg:docker/nirmata/app@v1#subpath", repository: "nirmata/app"},
+		{purl: "pkg:oci/app@sha256%3Aabc?repository_url=ghcr.io/nirmata/app", repository: "ghcr.io/nirmata/app"},
+		{purl: "pkg:oci/app@sha256%3Aabc", repository: "app"},
+		{purl: "pkg:docker/nirmata%2Fapp", repository: "nirmata/app"},
+		{purl: "pkg:docker/nirmata%zzapp", repository: ""},
+		{purl: "pkg:docker/nirmata/app?repository_url=%zz", repository: ""},
+	}
+	for _, test := range tests {
+		if repository := purlRepository(test.purl); repository != test.repository {
+			t.Errorf("%s: expected repository %q, got %q", test.purl, test.repository, repository)
+		}
+	}
+}
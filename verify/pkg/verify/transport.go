@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// apiRequestTimeout bounds each request to the GitHub and Rekor APIs, so that an unresponsive API
+// fails the bundle source instead of hanging the verification
+const apiRequestTimeout = 30 * time.Second
+
+// downloadTimeout bounds the download of a release asset or workflow artifact, which can take much
+// longer than an API request
+const downloadTimeout = 30 * time.Minute
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// transportOptions tune the HTTP transport configureTransport installs for the whole process. Only
+// the commands set them: programs embedding the verifier configure http.DefaultTransport and
+// remote.DefaultTransport themselves, since changing them per call would affect the rest of the program.
+type transportOptions struct {
+	proxyURL        string
+	tlsMinVersion   string
+	maxConnsPerHost int
+	registryMirror  string
+}
+
+// addTransportFlags registers the flags tuning the HTTP client used for registries, TUF and the GitHub and Rekor APIs
+func addTransportFlags(fs *flag.FlagSet, opts *VerificationOptions) {
+	fs.StringVar(&opts.transport.proxyURL, "proxy-url", "", "proxy for all outgoing requests (default $HTTPS_PROXY, honouring $NO_PROXY)")
+	fs.StringVar(&opts.transport.tlsMinVersion, "tls-min-version", "1.2", "minimum TLS version, 1.2 or 1.3")
+	fs.IntVar(&opts.transport.maxConnsPerHost, "max-conns-per-host", 0, "maximum number of connections per host, 0 for no limit")
+	fs.BoolVar(&opts.FIPS, "fips", false, "restrict TLS and verification to FIPS 140-3 approved algorithms; requires a build with -tags fips or GODEBUG=fips140=on")
+	fs.StringVar(&opts.transport.registryMirror, "registry-mirror", "", "pull images and referrers through this registry host, optionally followed by a repository prefix, where {registry} stands for the original registry (default the mirror of the registry's profile in the config file)")
+}
+
+// configureTransport installs the transport built from the options as the default for every HTTP client
+// of the process, since the TUF client offers no other way to set one. Registries additionally get
+// the TLS settings of their profile in the config file.
+func configureTransport(opts VerificationOptions) error {
+	if err := checkFIPS(opts); err != nil {
+		return err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.transport.proxyURL != "" {
+		proxy, err := url.Parse(opts.transport.proxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid --proxy-url: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	minVersion, ok := tlsVersions[opts.transport.tlsMinVersion]
+	if !ok {
+		return fmt.Errorf("invalid --tls-min-version %q, expected 1.2 or 1.3", opts.transport.tlsMinVersion)
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.MinVersion = minVersion
+
+	if opts.transport.maxConnsPerHost > 0 {
+		t.MaxConnsPerHost = opts.transport.maxConnsPerHost
+		t.MaxIdleConnsPerHost = opts.transport.maxConnsPerHost
+	}
+
+	profiles, err := loadRegistryProfiles()
+	if err != nil {
+		return err
+	}
+	registries, err := newRegistryTransport(t, profiles)
+	if err != nil {
+		return err
+	}
+	registryProfiles = profiles
+	registryMirror = opts.transport.registryMirror
+
+	http.DefaultTransport = t
+	remote.DefaultTransport = registries
+	return nil
+}
+
+// newAPIClient returns a client of the transport installed by configureTransport, with
+// apiRequestTimeout
+func newAPIClient() *http.Client {
+	return &http.Client{Transport: http.DefaultTransport, Timeout: apiRequestTimeout}
+}
+
+// newDownloadClient returns a client of the transport installed by configureTransport, with
+// downloadTimeout
+func newDownloadClient() *http.Client {
+	return &http.Client{Transport: http.DefaultTransport, Timeout: downloadTimeout}
+}
@@ -0,0 +1,136 @@
+package verify
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	tufmetadata "github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+// githubTUFRoot bootstraps TUF for githubTUFMirror when neither --tuf-root nor a root written by
+// update-root is available
+//
+//go:embed github_tuf_root.json
+var githubTUFRoot []byte
+
+// rootExpiryWarning is how long before the TUF root expires the verifier starts refreshing it and warning about it
+const rootExpiryWarning = 30 * 24 * time.Hour
+
+// tufMetadataExpiry reads the expiry of a signed TUF metadata file such as root.json
+func tufMetadataExpiry(metadata []byte) (time.Time, error) {
+	var signed struct {
+		Signed struct {
+			Expires time.Time `json:"expires"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(metadata, &signed); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse TUF metadata: %w", err)
+	}
+	return signed.Signed.Expires, nil
+}
+
+// tufRoot returns the root.json bootstrapping the mirror: the --tuf-root file, else the root saved by
+// update-root, else the embedded root for githubTUFMirror or the public good instance
+func tufRoot(mirror, path string) ([]byte, string, error) {
+	if path == "" {
+		saved, err := savedRootPath(mirror)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := os.Stat(saved); err == nil {
+			path = saved
+		} else if mirror == githubTUFMirror {
+			return githubTUFRoot, "embedded root", nil
+		} else if mirror == tuf.DefaultMirror {
+			return tuf.DefaultRoot(), "embedded root", nil
+		} else {
+			return nil, "", fmt.Errorf("--tuf-root is required to initialize TUF mirror %s", mirror)
+		}
+	}
+	rootBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read tuf root: %w", err)
+	}
+	return rootBytes, path, nil
+}
+
+// savedRootPath is where update-root stores the latest root.json of a mirror
+func savedRootPath(mirror string) (string, error) {
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return "", fmt.Errorf("invalid tuf mirror %s: %w", mirror, err)
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "github-signing-demo", "tuf", u.Host, "root.json"), nil
+}
+
+// checkInitialRoot warns when the root.json passed with --tuf-root has expired; TUF only uses it to
+// bootstrap, and rotates to the current root published by the mirror
+func checkInitialRoot(path string, rootBytes []byte) error {
+	expires, err := tufMetadataExpiry(rootBytes)
+	if err != nil {
+		return fmt.Errorf("invalid tuf root %s: %w", path, err)
+	}
+	if time.Now().After(expires) {
+		fmt.Fprintf(os.Stderr, "warning: tuf root %s expired on %s, the current root will be fetched from the mirror\n", path, expires.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// cachedRootPath is the root.json the TUF client of a mirror caches, the latest root it verified
+func cachedRootPath(mirror string) string {
+	return filepath.Join(tufCachePath(mirror), tuf.URLToPath(mirror), "root.json")
+}
+
+// checkCachedRootExpiry fails with remediation steps once the cached root of the mirror has expired,
+// and warns when it expires within rootExpiryWarning since no newer root is published yet
+func checkCachedRootExpiry(mirror string) error {
+	expires, err := cachedRootExpiry(mirror)
+	if err != nil {
+		return err
+	}
+	switch {
+	case time.Now().After(expires):
+		return fmt.Errorf("tuf root from %s expired on %s: %s", mirror, expires.Format(time.DateOnly), rootRemediation(mirror))
+	case time.Until(expires) <= rootExpiryWarning:
+		fmt.Fprintf(os.Stderr, "warning: tuf root from %s expires on %s and no newer root is published yet\n", mirror, expires.Format(time.DateOnly))
+	}
+	return nil
+}
+
+func cachedRootExpiry(mirror string) (time.Time, error) {
+	rootBytes, err := os.ReadFile(cachedRootPath(mirror))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("no root.json in the tuf cache of %s: %w", mirror, err)
+	}
+	return tufMetadataExpiry(rootBytes)
+}
+
+// tufError adds remediation steps to TUF failures caused by expired metadata
+func tufError(action string, err error) error {
+	var expiredMetadata *tufmetadata.ErrExpiredMetadata
+	if errors.As(err, &expiredMetadata) {
+		return fmt.Errorf("%s: tuf metadata expired: %s: %w", action, rootRemediation(""), err)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// rootRemediation tells how to recover from expired metadata in the cache of the mirror, or in the
+// cache of every mirror when it isn't known
+func rootRemediation(mirror string) string {
+	cache := filepath.Dir(tufCachePath(mirror))
+	if mirror != "" {
+		cache = tufCachePath(mirror)
+	}
+	return fmt.Sprintf("check that the tuf mirror is reachable, then remove the cache in %s (or point $%s elsewhere) and pass the current root.json with --tuf-root", cache, tufRootEnv)
+}
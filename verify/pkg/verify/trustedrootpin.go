@@ -0,0 +1,230 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// trustedRootDigest is the hex sha256 of a trusted_root.json, as --pin-trusted-root takes it
+func trustedRootDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPinnedTrustedRoot fails when --pin-trusted-root is set and the trusted root is another one,
+// so that trust updates published through TUF only apply once an operator reviewed them. It applies
+// to the raw trusted_root.json wherever it comes from: TUF, --trusted-root-path or an export.
+func checkPinnedTrustedRoot(data []byte, opts VerificationOptions) error {
+	if opts.PinTrustedRoot == "" {
+		return nil
+	}
+	pinned := strings.ToLower(strings.TrimPrefix(opts.PinTrustedRoot, "sha256:"))
+	if digest := trustedRootDigest(data); digest != pinned {
+		return fmt.Errorf("trusted root sha256:%s doesn't match --pin-trusted-root sha256:%s; review the changes with `trusted-root diff` before pinning the new root", digest, pinned)
+	}
+	return nil
+}
+
+// acceptedTrustedRootPath is where `trusted-root diff --accept` saves the trusted root of a TUF
+// mirror, the root the next diff compares with
+func acceptedTrustedRootPath(mirror string) (string, error) {
+	host := "default"
+	if mirror != "" {
+		u, err := url.Parse(mirror)
+		if err != nil {
+			return "", fmt.Errorf("invalid tuf mirror %s: %w", mirror, err)
+		}
+		host = u.Host
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "github-signing-demo", "trusted-root", host, "trusted_root.json"), nil
+}
+
+func newTrustedRootCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trusted-root",
+		Short: "Review the changes of the trusted root before trusting them",
+	}
+	cmd.AddCommand(newTrustedRootDiffCommand())
+	return cmd
+}
+
+func newTrustedRootDiffCommand() *cobra.Command {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	previous := fs.String("previous", "", "trusted_root.json to compare with (default the root last accepted with --accept)")
+	accept := fs.Bool("accept", false, "save the fetched root as the accepted one, which the next diff compares with")
+	addTrustFlags(fs, &opts)
+	addTransportFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "diff",
+		Short: "Show the keys and certificate authorities changed between the accepted and the current trusted root",
+		Long: `Fetch the current trusted root through TUF, or read --trusted-root-path, and show the certificate
+authorities, timestamp authorities, transparency logs and CT logs added or removed since the root last
+accepted with --accept, with the sha256 to pass to --pin-trusted-root.`,
+		Example: "  trusted-root diff\n  trusted-root diff --accept",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		current, err := getTrustedRootJSON(context.TODO(), opts)
+		if err != nil {
+			return err
+		}
+
+		acceptedPath, err := acceptedTrustedRootPath(opts.TUFMirror)
+		if err != nil {
+			return err
+		}
+		previousPath := *previous
+		if previousPath == "" {
+			previousPath = acceptedPath
+		}
+		var old []byte
+		if data, err := os.ReadFile(previousPath); err == nil {
+			old = data
+		} else if *previous != "" || !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read trusted root: %w", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "no accepted trusted root in %s yet, showing every entry as added\n", acceptedPath)
+		}
+
+		if err := writeTrustedRootDiff(os.Stdout, old, current); err != nil {
+			return err
+		}
+		fmt.Printf("pin with: --pin-trusted-root sha256:%s\n", trustedRootDigest(current))
+		if *accept {
+			if err := os.MkdirAll(filepath.Dir(acceptedPath), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(acceptedPath, current, 0o644); err != nil {
+				return fmt.Errorf("failed to save trusted root: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "accepted the trusted root into %s\n", acceptedPath)
+		}
+		return nil
+	})
+}
+
+// trustedRootEntries describes the keys and certificate authorities of a trusted_root.json, one
+// line each
+func trustedRootEntries(data []byte) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	type validity struct {
+		Start *time.Time `json:"start"`
+		End   *time.Time `json:"end"`
+	}
+	type transparencyLog struct {
+		BaseURL   string `json:"baseUrl"`
+		PublicKey struct {
+			RawBytes   []byte   `json:"rawBytes"`
+			KeyDetails string   `json:"keyDetails"`
+			ValidFor   validity `json:"validFor"`
+		} `json:"publicKey"`
+	}
+	type authority struct {
+		Subject struct {
+			Organization string `json:"organization"`
+			CommonName   string `json:"commonName"`
+		} `json:"subject"`
+		URI       string `json:"uri"`
+		CertChain struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"certChain"`
+		ValidFor validity `json:"validFor"`
+	}
+	var trustedRoot struct {
+		Tlogs                  []transparencyLog `json:"tlogs"`
+		CTLogs                 []transparencyLog `json:"ctlogs"`
+		CertificateAuthorities []authority       `json:"certificateAuthorities"`
+		TimestampAuthorities   []authority       `json:"timestampAuthorities"`
+	}
+	if err := json.Unmarshal(data, &trustedRoot); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted root: %w", err)
+	}
+
+	period := func(v validity) string {
+		start, end := "-", "-"
+		if v.Start != nil {
+			start = v.Start.UTC().Format(time.DateOnly)
+		}
+		if v.End != nil {
+			end = v.End.UTC().Format(time.DateOnly)
+		}
+		return start + " to " + end
+	}
+	fingerprint := func(raw []byte) string {
+		sum := sha256.Sum256(raw)
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	var entries []string
+	for _, kind := range []struct {
+		name string
+		logs []transparencyLog
+	}{{"tlog", trustedRoot.Tlogs}, {"ctlog", trustedRoot.CTLogs}} {
+		for _, log := range kind.logs {
+			entries = append(entries, fmt.Sprintf("%s %s key %s (%s) valid %s", kind.name, log.BaseURL, fingerprint(log.PublicKey.RawBytes), log.PublicKey.KeyDetails, period(log.PublicKey.ValidFor)))
+		}
+	}
+	for _, kind := range []struct {
+		name        string
+		authorities []authority
+	}{{"certificate authority", trustedRoot.CertificateAuthorities}, {"timestamp authority", trustedRoot.TimestampAuthorities}} {
+		for _, ca := range kind.authorities {
+			var chain []string
+			for _, cert := range ca.CertChain.Certificates {
+				chain = append(chain, fingerprint(cert.RawBytes))
+			}
+			entries = append(entries, fmt.Sprintf("%s %s (%s, %s) certificates %s valid %s", kind.name, ca.URI, ca.Subject.Organization, ca.Subject.CommonName, strings.Join(chain, ","), period(ca.ValidFor)))
+		}
+	}
+	slices.Sort(entries)
+	return entries, nil
+}
+
+// writeTrustedRootDiff prints the entries removed (-) and added (+) from the old to the new root
+func writeTrustedRootDiff(w io.Writer, old, current []byte) error {
+	oldEntries, err := trustedRootEntries(old)
+	if err != nil {
+		return fmt.Errorf("previous root: %w", err)
+	}
+	newEntries, err := trustedRootEntries(current)
+	if err != nil {
+		return fmt.Errorf("current root: %w", err)
+	}
+	removed := setDifference(oldEntries, newEntries)
+	added := setDifference(newEntries, oldEntries)
+	if len(removed) == 0 && len(added) == 0 {
+		fmt.Fprintln(w, "no key or certificate authority changed")
+		return nil
+	}
+	for _, entry := range removed {
+		fmt.Fprintf(w, "- %s\n", entry)
+	}
+	for _, entry := range added {
+		fmt.Fprintf(w, "+ %s\n", entry)
+	}
+	return nil
+}
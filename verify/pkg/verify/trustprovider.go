@@ -0,0 +1,72 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sigstore/sigstore-go/pkg/root"
+)
+
+// TrustProvider caches the trusted root for long-running modes and refreshes it from TUF in the
+// background, so that verifications don't go through TUF on every request
+type TrustProvider struct {
+	opts VerificationOptions
+
+	mu          sync.RWMutex
+	trustedRoot *root.TrustedRoot
+	refreshed   time.Time
+}
+
+// NewTrustProvider fetches the trusted root, then refreshes it every interval until ctx is done. A
+// zero interval disables the refresh. A failed refresh keeps the previous root.
+func NewTrustProvider(ctx context.Context, opts VerificationOptions, interval time.Duration) (*TrustProvider, error) {
+	p := &TrustProvider{opts: opts}
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go p.refreshEvery(ctx, interval)
+	}
+	return p, nil
+}
+
+// TrustedRoot returns the current trusted root
+func (p *TrustProvider) TrustedRoot() *root.TrustedRoot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.trustedRoot
+}
+
+// Refresh fetches the trusted root again and replaces the cached one
+func (p *TrustProvider) Refresh(ctx context.Context) error {
+	trustedRoot, err := getTrustedRoot(ctx, p.opts)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trustedRoot = trustedRoot
+	p.refreshed = time.Now()
+	return nil
+}
+
+func (p *TrustProvider) refreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.Refresh(ctx); err != nil {
+			p.mu.RLock()
+			refreshed := p.refreshed
+			p.mu.RUnlock()
+			fmt.Fprintf(os.Stderr, "failed to refresh trusted root, keeping the one fetched at %s: %v\n", refreshed.Format(time.RFC3339), err)
+		}
+	}
+}
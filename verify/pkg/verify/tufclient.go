@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	"golang.org/x/sync/singleflight"
+)
+
+// tufRootEnv overrides the directory the TUF metadata of every mirror is cached in
+const tufRootEnv = "TUF_ROOT"
+
+// trustedRoots fetches the trusted root through TUF for every verification of the process
+var trustedRoots = &tufFetcher{locks: map[string]*sync.Mutex{}}
+
+// tufFetcher coalesces concurrent fetches of the trusted root, e.g. of the admission reviews
+// arriving while the root is refreshed, into one TUF update per mirror. Each mirror has its own
+// client and cache directory, so policies trusting different mirrors never share metadata; updates
+// writing to the same cache directory are serialized.
+type tufFetcher struct {
+	group singleflight.Group
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// fetch returns the trusted_root.json target of the mirror of the options. A caller whose ctx is
+// done stops waiting, without cancelling the update the other callers wait for.
+func (f *tufFetcher) fetch(ctx context.Context, opts VerificationOptions) ([]byte, error) {
+	mirror := tufMirror(opts)
+	ch := f.group.DoChan(mirror+"\x00"+opts.TUFRoot, func() (any, error) {
+		lock := f.lock(mirror)
+		lock.Lock()
+		defer lock.Unlock()
+		return fetchTrustedRootTarget(mirror, opts.TUFRoot, false)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]byte), nil
+	}
+}
+
+// cached returns the trusted_root.json target cached for the mirror of the options, only updating
+// the metadata when the cache is missing or expired, so that offline verification works
+func (f *tufFetcher) cached(opts VerificationOptions) ([]byte, error) {
+	mirror := tufMirror(opts)
+	lock := f.lock(mirror)
+	lock.Lock()
+	defer lock.Unlock()
+	return fetchTrustedRootTarget(mirror, opts.TUFRoot, true)
+}
+
+func (f *tufFetcher) lock(mirror string) *sync.Mutex {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lock, ok := f.locks[mirror]
+	if !ok {
+		lock = &sync.Mutex{}
+		f.locks[mirror] = lock
+	}
+	return lock
+}
+
+// tufMirror is the --tuf-mirror, or the public good instance when none is set
+func tufMirror(opts VerificationOptions) string {
+	if opts.TUFMirror != "" {
+		return opts.TUFMirror
+	}
+	return tuf.DefaultMirror
+}
+
+// tufCachePath is the directory the metadata of a mirror is cached in: a subdirectory, named after
+// the hash of the mirror, of $TUF_ROOT or ~/.sigstore/root
+func tufCachePath(mirror string) string {
+	base := os.Getenv(tufRootEnv)
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = os.TempDir()
+		}
+		base = filepath.Join(home, ".sigstore", "root")
+	}
+	sum := sha256.Sum256([]byte(mirror))
+	return filepath.Join(base, hex.EncodeToString(sum[:8]))
+}
+
+// fetchTrustedRootTarget updates the TUF metadata of the mirror, or with forceCache only reads the
+// cached metadata while it is valid, and returns its trusted_root.json target
+func fetchTrustedRootTarget(mirror, rootPath string, forceCache bool) ([]byte, error) {
+	rootBytes, source, err := tufRoot(mirror, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInitialRoot(source, rootBytes); err != nil {
+		return nil, err
+	}
+	options := tuf.DefaultOptions().WithRepositoryBaseURL(mirror).WithRoot(rootBytes).WithCachePath(tufCachePath(mirror))
+	if forceCache {
+		options = options.WithForceCache()
+	}
+	client, err := tuf.New(options)
+	if err != nil {
+		return nil, tufError(fmt.Sprintf("updating tuf mirror %s", mirror), err)
+	}
+	if err := checkCachedRootExpiry(mirror); err != nil {
+		return nil, err
+	}
+	targetBytes, err := client.GetTarget("trusted_root.json")
+	if err != nil {
+		return nil, tufError("error getting targets", err)
+	}
+	return targetBytes, nil
+}
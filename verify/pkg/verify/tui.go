@@ -0,0 +1,464 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/spf13/cobra"
+)
+
+const tuiHelp = "i image · ↑/↓ select · enter expand · c statement/certificate · pgup/pgdn scroll · p policy · v verify · q quit"
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	tuiDimStyle      = lipgloss.NewStyle().Faint(true)
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiPassStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	tuiFailStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	tuiRuleStyle     = lipgloss.NewStyle().Faint(true)
+)
+
+func newTUICommand() *cobra.Command {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:   "tui [image]",
+		Short: "Browse the attestations of images in a terminal UI and try policies on them",
+		Long: `Open a full-screen terminal UI to enter an image, browse the attestations among its referrers, expand
+their decoded statements and certificates, and verify them against a policy edited as you go, with each
+attestation marked as verified or failed. The policy flags given on the command line are the starting
+policy. For a scriptable session, use shell instead.`,
+		Args:    cobra.MaximumNArgs(1),
+		Example: "  tui ghcr.io/nirmata/github-signing-demo:latest --subject-regexp '^https://github.com/nirmata/'",
+	}, func(args []string) error {
+		s := newShell(fs, &opts, os.Stdin, os.Stdout)
+		applyGitHubHost(&opts)
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		m := newTUIModel(context.TODO(), s)
+		if len(args) == 1 {
+			m.initialImage = args[0]
+		}
+		_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+		return err
+	})
+}
+
+// tuiMode is what the keys of the TUI act on
+type tuiMode int
+
+const (
+	tuiBrowse tuiMode = iota
+	tuiImageInput
+	tuiPolicyInput
+)
+
+// tuiModel is the state of the TUI. The session state lives in the shell, shared with the shell
+// command, and is only changed by Update: lookups and verifications run in commands that work on
+// copies and return their outcome as a message.
+type tuiModel struct {
+	ctx          context.Context
+	shell        *shell
+	initialImage string
+
+	mode   tuiMode
+	input  textinput.Model
+	detail viewport.Model
+	width  int
+	height int
+
+	cursor int
+	// expanded is the index of the attestation whose details are shown, or -1
+	expanded int
+	// certificate shows the decoded certificate and log entries of the expanded attestation
+	// instead of its statement
+	certificate bool
+	// outcomes are the verification errors of the attestations checked by the last verify, nil for
+	// those that verified. Attestations filtered out by the policy have no outcome.
+	outcomes map[*Bundle]error
+	// busy describes the lookup or verification running, during which the session can't change
+	busy   string
+	status string
+	failed bool
+}
+
+// tuiLookupMsg is the outcome of looking up the attestations of an image
+type tuiLookupMsg struct {
+	image   string
+	desc    *v1.Descriptor
+	bundles []*Bundle
+	err     error
+}
+
+// tuiVerifyMsg is the outcome of verifying the attestations against the policy
+type tuiVerifyMsg struct {
+	trustedRoot *root.TrustedRoot
+	outcomes    map[*Bundle]error
+	results     []VerificationResult
+	err         error
+}
+
+// outcomeObserver records the outcome of every attestation checked by a verification
+type outcomeObserver struct {
+	NopObserver
+	outcomes map[*Bundle]error
+}
+
+func (o *outcomeObserver) OnBundleVerified(_ string, b *Bundle, err error) {
+	o.outcomes[b] = err
+}
+
+func newTUIModel(ctx context.Context, s *shell) *tuiModel {
+	input := textinput.New()
+	return &tuiModel{ctx: ctx, shell: s, input: input, detail: viewport.New(0, 0), expanded: -1}
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	if m.initialImage != "" {
+		return m.lookUp(m.initialImage)
+	}
+	return m.prompt(tuiImageInput, "image> ", "")
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.Width = max(msg.Width-10, 10)
+		m.layout()
+		return m, nil
+	case tuiLookupMsg:
+		m.busy = ""
+		if msg.err != nil {
+			m.setStatus(msg.err.Error(), true)
+			return m, nil
+		}
+		m.shell.image, m.shell.desc, m.shell.bundles = msg.image, msg.desc, msg.bundles
+		m.cursor, m.expanded, m.outcomes = 0, -1, nil
+		m.setStatus(fmt.Sprintf("%d attestations found", len(msg.bundles)), false)
+		m.layout()
+		return m, nil
+	case tuiVerifyMsg:
+		m.busy = ""
+		if msg.trustedRoot != nil {
+			m.shell.trustedRoot = msg.trustedRoot
+		}
+		m.outcomes = msg.outcomes
+		if msg.err != nil {
+			m.setStatus("✗ "+msg.err.Error(), true)
+		} else {
+			m.setStatus(fmt.Sprintf("✓ %d attestations of %s verified", len(msg.results), m.shell.image), false)
+		}
+		m.refreshDetail()
+		return m, nil
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.mode != tuiBrowse {
+			return m.updateInput(msg)
+		}
+		return m.updateBrowse(msg)
+	}
+	return m, nil
+}
+
+// updateInput handles the keys while the image or a policy change is typed
+func (m *tuiModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = tuiBrowse
+		m.input.Blur()
+		return m, nil
+	case tea.KeyEnter:
+		value := strings.TrimSpace(m.input.Value())
+		mode := m.mode
+		m.mode = tuiBrowse
+		m.input.Blur()
+		if value == "" {
+			return m, nil
+		}
+		if mode == tuiImageInput {
+			return m, m.lookUp(value)
+		}
+		m.editPolicy(value)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// updateBrowse handles the keys while browsing the attestations
+func (m *tuiModel) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		if msg.String() == "esc" && m.expanded >= 0 {
+			m.expanded = -1
+			m.layout()
+			return m, nil
+		}
+		return m, tea.Quit
+	case "i", "/":
+		if m.busy == "" {
+			return m, m.prompt(tuiImageInput, "image> ", m.shell.image)
+		}
+	case "p":
+		if m.busy == "" {
+			return m, m.prompt(tuiPolicyInput, "set> ", "")
+		}
+	case "v":
+		if m.busy == "" {
+			return m, m.verify()
+		}
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "enter", " ":
+		if len(m.shell.bundles) > 0 {
+			if m.expanded == m.cursor {
+				m.expanded = -1
+			} else {
+				m.expanded = m.cursor
+			}
+			m.layout()
+		}
+	case "c":
+		m.certificate = !m.certificate
+		m.refreshDetail()
+	default:
+		var cmd tea.Cmd
+		m.detail, cmd = m.detail.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// prompt focuses the input line for the image or a policy change
+func (m *tuiModel) prompt(mode tuiMode, prompt, value string) tea.Cmd {
+	m.mode = mode
+	m.input.Prompt = prompt
+	m.input.Placeholder = ""
+	if mode == tuiPolicyInput {
+		m.input.Placeholder = "<flag> <value>, or unset <flag>"
+	}
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+// move moves the cursor, and the expanded details along with it
+func (m *tuiModel) move(delta int) {
+	if len(m.shell.bundles) == 0 {
+		return
+	}
+	m.cursor = min(max(m.cursor+delta, 0), len(m.shell.bundles)-1)
+	if m.expanded >= 0 {
+		m.expanded = m.cursor
+		m.refreshDetail()
+	}
+}
+
+// editPolicy applies "<flag> <value>" or "unset <flag>". The outcomes of the last verification no
+// longer apply to the new policy.
+func (m *tuiModel) editPolicy(value string) {
+	command, arg := "set", value
+	if name, ok := strings.CutPrefix(value, "unset "); ok {
+		command, arg = "unset", strings.TrimSpace(name)
+	}
+	if err := m.shell.set(command, arg); err != nil {
+		m.setStatus(err.Error(), true)
+		return
+	}
+	m.outcomes = nil
+	m.setStatus("policy changed, press v to verify", false)
+	m.refreshDetail()
+}
+
+// lookUp resolves the image and fetches its attestations in the background
+func (m *tuiModel) lookUp(image string) tea.Cmd {
+	ctx, opts := m.ctx, *m.shell.opts
+	m.busy = "looking up " + image
+	return func() tea.Msg {
+		bundles, desc, err := resolveBundles(ctx, image, opts)
+		return tuiLookupMsg{image: image, desc: desc, bundles: bundles, err: err}
+	}
+}
+
+// verify verifies the fetched attestations against the current policy in the background
+func (m *tuiModel) verify() tea.Cmd {
+	if m.shell.image == "" {
+		m.setStatus("no image yet, press i to enter one", true)
+		return nil
+	}
+	opts, err := m.shell.policyOptions()
+	if err != nil {
+		m.setStatus(err.Error(), true)
+		return nil
+	}
+	observer := &outcomeObserver{outcomes: map[*Bundle]error{}}
+	opts.Observer = observer
+	ctx, image, desc, bundles, trustedRoot := m.ctx, m.shell.image, m.shell.desc, m.shell.bundles, m.shell.trustedRoot
+	m.busy = "verifying " + image
+	return func() tea.Msg {
+		if trustedRoot == nil {
+			var err error
+			if trustedRoot, err = getTrustedRoot(ctx, opts); err != nil {
+				return tuiVerifyMsg{err: err}
+			}
+		}
+		results, err := verifyAttestations(ctx, image, bundles, desc, trustedRoot, opts)
+		return tuiVerifyMsg{trustedRoot: trustedRoot, outcomes: observer.outcomes, results: results, err: err}
+	}
+}
+
+func (m *tuiModel) setStatus(status string, failed bool) {
+	m.status, m.failed = status, failed
+	m.layout()
+}
+
+// layout gives the details pane the lines left below the header and the attestations
+func (m *tuiModel) layout() {
+	// header, policy, blank line, table header, two rules, status and help
+	used := 8 + m.listHeight()
+	m.detail.Width = m.width
+	m.detail.Height = max(m.height-used, 3)
+	m.refreshDetail()
+}
+
+// refreshDetail renders the expanded attestation: the reason it failed verification, then its
+// decoded statement or certificate
+func (m *tuiModel) refreshDetail() {
+	if m.expanded < 0 || m.expanded >= len(m.shell.bundles) {
+		m.detail.SetContent(tuiDimStyle.Render("press enter to expand an attestation"))
+		return
+	}
+	b := m.shell.bundles[m.expanded]
+	var out bytes.Buffer
+	if err, ok := m.outcomes[b]; ok && err != nil {
+		fmt.Fprintf(&out, "%s\n\n", tuiFailStyle.Render("✗ "+err.Error()))
+	}
+	var err error
+	switch {
+	case b.ParseErr != nil:
+		err = b.ParseErr
+	case m.certificate:
+		var data []byte
+		if data, err = b.ProtoBundle.MarshalJSON(); err == nil {
+			err = inspectBundle(&out, fmt.Sprintf("attestation %d", m.expanded+1), data)
+		}
+	default:
+		err = printPayload(&out, b)
+	}
+	if err != nil {
+		fmt.Fprintln(&out, err)
+	}
+	m.detail.SetContent(lipgloss.NewStyle().Width(m.width).Render(out.String()))
+	m.detail.GotoTop()
+}
+
+// statusLine is the outcome of the last action, or the action running
+func (m *tuiModel) statusLine() string {
+	if m.busy != "" {
+		return tuiDimStyle.Render(m.busy + "…")
+	}
+	status, _, _ := strings.Cut(m.status, "\n")
+	if m.failed {
+		return tuiFailStyle.Render(status)
+	}
+	return tuiPassStyle.Render(status)
+}
+
+func (m *tuiModel) View() string {
+	var view strings.Builder
+	line := func(s string) {
+		view.WriteString(lipgloss.NewStyle().MaxWidth(m.width).Render(s))
+		view.WriteByte('\n')
+	}
+
+	header := "no image"
+	if m.shell.image != "" {
+		header = fmt.Sprintf("%s @ %s", m.shell.image, m.shell.desc.Digest)
+	}
+	line(tuiTitleStyle.Render(header))
+	policy := "policy: defaults"
+	if flags := m.shell.policyFlags(); len(flags) > 0 {
+		policy = "policy: " + strings.Join(flags, " ")
+	}
+	line(tuiDimStyle.Render(policy))
+	line("")
+	rows, selected := m.rows()
+	for i, row := range rows {
+		switch {
+		case i == 0:
+			line(tuiDimStyle.Render(row))
+		case i == selected && len(m.shell.bundles) > 0 && m.mode == tuiBrowse:
+			line(tuiSelectedStyle.Render(row))
+		default:
+			line(row)
+		}
+	}
+	line(tuiRuleStyle.Render(strings.Repeat("─", max(m.width, 1))))
+	view.WriteString(m.detail.View())
+	view.WriteByte('\n')
+	line(tuiRuleStyle.Render(strings.Repeat("─", max(m.width, 1))))
+	if m.mode != tuiBrowse {
+		line(m.input.View())
+	} else {
+		line(m.statusLine())
+	}
+	view.WriteString(tuiDimStyle.Render(tuiHelp))
+	return view.String()
+}
+
+// listHeight is the number of attestations shown at once, at most half of the screen
+func (m *tuiModel) listHeight() int {
+	return max(min(len(m.shell.bundles), (m.height-8)/2), 1)
+}
+
+// rows renders the table header and the attestations in view, with their outcome in the last
+// verification, scrolled so that the cursor is visible. It also returns the row of the cursor.
+func (m *tuiModel) rows() ([]string, int) {
+	var out bytes.Buffer
+	tw := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\t \tPREDICATE TYPE\tISSUER\tSUBJECT")
+	switch {
+	case m.shell.image == "":
+		fmt.Fprintln(tw, "\t\tno image yet, press i to enter one\t\t")
+	case len(m.shell.bundles) == 0:
+		fmt.Fprintln(tw, "\t\tno attestations\t\t")
+	}
+	for i, b := range m.shell.bundles {
+		outcome := " "
+		if err, ok := m.outcomes[b]; ok {
+			outcome = "✓"
+			if err != nil {
+				outcome = "✗"
+			}
+		}
+		predicate, issuer, subject := describeAttestation(b)
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i+1, outcome, predicate, issuer, subject)
+	}
+	tw.Flush()
+	rows := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	// the columns are aligned over every attestation, so that they don't shift while scrolling
+	first := min(max(m.cursor-m.listHeight()+1, 0), max(len(rows)-1-m.listHeight(), 0))
+	return append(rows[:1], rows[1+first:min(1+first+m.listHeight(), len(rows))]...), m.cursor - first + 1
+}
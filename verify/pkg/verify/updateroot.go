@@ -0,0 +1,81 @@
+package verify
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/theupdateframework/go-tuf/v2/metadata/config"
+	"github.com/theupdateframework/go-tuf/v2/metadata/updater"
+)
+
+// newUpdateRootCommand fetches the latest root.json of a TUF mirror, verified through the chain of
+// root versions signed by the previous ones, and saves it for later verifications
+func newUpdateRootCommand() *cobra.Command {
+	fs := flag.NewFlagSet("update-root", flag.ContinueOnError)
+	mirror := fs.String("tuf-mirror", githubTUFMirror, "TUF repository to fetch the latest root from")
+	rootPath := fs.String("tuf-root", "", "trusted root.json to start from (default the root saved by a previous update, or the embedded root for "+githubTUFMirror+")")
+	output := fs.String("output", "", "path to write the root to (default the config directory read by verify)")
+	opts := VerificationOptions{}
+	addTransportFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:     "update-root",
+		Short:   "Fetch and save the latest trusted root of a TUF repository",
+		Example: "  update-root --tuf-mirror https://tuf-repo.github.com",
+	}, func(args []string) error {
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+
+		rootBytes, _, err := tufRoot(*mirror, *rootPath)
+		if err != nil {
+			return err
+		}
+		if *output == "" {
+			if *output, err = savedRootPath(*mirror); err != nil {
+				return err
+			}
+		}
+
+		// the updater persists every root version it verifies, so the latest one is read back from
+		// its metadata directory
+		dir, err := os.MkdirTemp("", "update-root")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		cfg, err := config.New(*mirror, rootBytes)
+		if err != nil {
+			return fmt.Errorf("invalid tuf mirror %s: %w", *mirror, err)
+		}
+		cfg.LocalMetadataDir = dir
+		cfg.LocalTargetsDir = filepath.Join(dir, "targets")
+		client, err := updater.New(cfg)
+		if err != nil {
+			return fmt.Errorf("loading tuf root: %w", err)
+		}
+		if err := client.Refresh(); err != nil {
+			return tufError(fmt.Sprintf("updating root from %s", *mirror), err)
+		}
+		latest, err := os.ReadFile(filepath.Join(dir, "root.json"))
+		if err != nil {
+			return err
+		}
+		expires, err := tufMetadataExpiry(latest)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(*output), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(*output, latest, 0o644); err != nil {
+			return fmt.Errorf("failed to write tuf root: %w", err)
+		}
+		fmt.Printf("saved root of %s to %s, expires %s\n", *mirror, *output, expires.Format(time.DateOnly))
+		return nil
+	})
+}
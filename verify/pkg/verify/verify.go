@@ -0,0 +1,929 @@
+package verify
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+	"github.com/spf13/cobra"
+)
+
+// version is set at build time with
+// -ldflags "-X github-signing-demo-verify/pkg/verify.version=<version>"
+var version = "dev"
+
+type VerificationOptions struct {
+	PredicateTypes         stringsFlag
+	PayloadType            string
+	Limit                  int    // hardcoded for fetching artifact
+	OIDCIssuer             string // hardcoded
+	Subject                string
+	BundlePath             string
+	Requirements           requirementFlags
+	Sources                stringsFlag
+	ArtifactTypes          stringsFlag
+	MaxBundleSize          int64
+	GitHubRepo             string
+	RekorURL               string
+	EnableRekorSearch      bool
+	GitHubHost             string
+	GitHubAPIURL           string
+	TUFMirror              string
+	TUFRoot                string
+	TrustedRootPath        string
+	PinTrustedRoot         string
+	SubjectRegexp          string
+	Verbose                bool
+	ExpectedDigest         string
+	Lockfile               string
+	Pins                   map[string]string // loaded from Lockfile
+	RequireDigestReference bool
+	Timing                 *Timing
+	Output                 string
+	IdentityAllowlist      string
+	IdentityDenylist       string
+	MinIdentities          int
+	Concurrency            int
+	GitHubWorkflow         string
+	GitHubReusableWorkflow string
+	DigestAlgorithm        string
+	Key                    string
+	NotationTrustPolicy    string
+	NotationTrustStore     string
+	PredicatePlugins       predicatePluginFlags
+	WASMPolicies           stringsFlag
+	WASMMemoryLimit        int
+	ReferrerAnnotations    annotationFlags
+	OnError                string
+	Assertions             assertionFlags
+	MaxAttestationAge      ageFlag
+	MinSigningTime         timeFlag
+	MaxSigningTime         timeFlag
+	SignatureAlgorithms    signatureAlgorithmsFlag
+	FIPS                   bool
+	RequireSCT             bool
+	Explain                bool
+	ResultsDB              string
+	Observer               Observer
+	Scan                   bool
+	SeverityThreshold      string
+	IgnoreUnknownSeverity  bool
+	OSVURL                 string
+	GitHubAppID            string
+	GitHubInstallationID   string
+	GitHubAppPrivateKey    string
+	GitHubTokenExchangeURL string
+	GitHubOIDCTokenFile    string
+	GitHubOIDCAudience     string
+	GitHubTokens           *GitHubTokenSource // built from the flags above
+	MissingAttestationsTTL time.Duration      // only set by serve
+	transport              transportOptions   // only set by the flags of the commands
+}
+
+// Requirement is the minimum number of verified attestations of a predicate type
+type Requirement struct {
+	PredicateType string
+	Count         int
+}
+
+// requirementFlags collects repeated --require flags of the form <predicate-type>:<count>
+type requirementFlags []Requirement
+
+func (r *requirementFlags) String() string {
+	rules := make([]string, 0, len(*r))
+	for _, req := range *r {
+		rules = append(rules, fmt.Sprintf("%s:%d", req.PredicateType, req.Count))
+	}
+	return strings.Join(rules, ",")
+}
+
+func (r *requirementFlags) Set(value string) error {
+	idx := strings.LastIndex(value, ":")
+	if idx <= 0 || idx == len(value)-1 {
+		return fmt.Errorf("invalid requirement %q, expected <predicate-type>:<count>", value)
+	}
+	count, err := strconv.Atoi(value[idx+1:])
+	if err != nil || count < 1 {
+		return fmt.Errorf("invalid requirement %q, count must be a positive integer", value)
+	}
+	*r = append(*r, Requirement{PredicateType: value[:idx], Count: count})
+	return nil
+}
+
+// annotationFlags collects repeated --referrer-annotation flags of the form <key>=<value>
+type annotationFlags map[string]string
+
+func (a *annotationFlags) String() string {
+	pairs := make([]string, 0, len(*a))
+	for key, value := range *a {
+		pairs = append(pairs, key+"="+value)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (a *annotationFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid annotation %q, expected <key>=<value>", value)
+	}
+	if *a == nil {
+		*a = annotationFlags{}
+	}
+	(*a)[key] = val
+	return nil
+}
+
+// stringsFlag collects a flag that can be repeated or given as a comma separated list
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
+type VerificationResult struct {
+	Timing BundleTiming
+	Bundle *Bundle
+	Result *verify.VerificationResult
+	Desc   *v1.Descriptor
+	// Annotations are added by the --predicate-plugin of the attestation
+	Annotations map[string]string
+}
+
+type Bundle struct {
+	ProtoBundle   *bundle.ProtobufBundle
+	DSSE_Envelope *in_toto.Statement
+	// StatementErr is why the payload of an in-toto envelope is not a valid statement
+	StatementErr error
+	// PayloadType and Payload of the DSSE envelope, empty for message signatures
+	PayloadType string
+	Payload     []byte
+	// ArtifactType of the referrer the bundle was read from, empty for other sources
+	ArtifactType string
+	// Download is the time spent downloading the bundle layer from the registry
+	Download time.Duration
+	// Version is the bundle version, e.g. v0.3
+	Version string
+	// ParseErr is why the bundle could not be parsed, e.g. an unsupported version, or a
+	// *BundleFetchError when it could not be downloaded; ProtoBundle is then empty
+	ParseErr error
+	// id identifies a bundle that could not be parsed among the bundles of the image
+	id []byte
+}
+
+// Execute runs the command line with the arguments, without the program name
+func Execute(args []string) error {
+	// verify stays the default command, so that `verify --image ...` keeps working
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		args = append([]string{"verify"}, args...)
+	}
+	root := newRootCommand()
+	root.SetArgs(args)
+	return root.Execute()
+}
+
+func newVerifyCommand(use string) *cobra.Command {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	image := fs.String("image", "", "image used for verification, either a registry reference or oci-layout:<path> / docker-archive:<path>")
+	fromExport := fs.String("from-export", "", "verify offline using an archive created by the export command, which must be of --image, or of the digest pinned by --expected-digest or --lockfile")
+	fs.StringVar(&opts.BundlePath, "bundle-path", "", "read bundles from a file or directory instead of fetching referrers from the registry")
+	showCertChain := fs.Bool("show-cert-chain", false, "print the certificate chain of each verified attestation and check that it terminates in a trusted Fulcio root")
+	dryRun := fs.Bool("dry-run", false, "list the discovered attestations and their signers without enforcing the policy")
+	savePayloadsDir := fs.String("save-payloads", "", "directory to write each verified payload and its metadata (signer, tlog index) to, as <predicate-type>-<attestation-id>.json and .meta.json")
+	stats := fs.Bool("stats", false, "print the time spent on TUF, referrers lookup, bundle download and verification to stderr")
+	fs.StringVar(&opts.ExpectedDigest, "expected-digest", "", "fail unless the image resolves to this digest, e.g. sha256:...")
+	githubRelease := fs.String("github-release", "", "verify a release asset instead of an image, as owner/repo@tag")
+	asset := fs.String("asset", "", "name of the release asset to verify with --github-release")
+	assetPath := fs.String("asset-path", "", "local copy of the release asset, instead of downloading it")
+	githubArtifact := fs.String("github-artifact", "", "verify an artifact uploaded by a workflow run instead of an image, as owner/repo@run-id")
+	artifactName := fs.String("artifact", "", "name of the workflow artifact to verify with --github-artifact")
+	artifactPath := fs.String("artifact-file", "", "file of the artifact to verify, instead of the artifact zip archive")
+	artifactArchive := fs.String("artifact-archive", "", "local copy of the artifact zip archive, instead of downloading it")
+	transitive := fs.Bool("transitive", false, "also verify the images the verified provenance was built from, e.g. base images, and print the provenance tree")
+	transitiveDepth := fs.Int("transitive-depth", 3, "how many levels of dependencies --transitive verifies")
+	receiptOpts := ReceiptOptions{}
+	addReceiptFlags(fs, &receiptOpts)
+	addVerificationFlags(fs, &opts)
+
+	return newCommand(fs, commandDoc{
+		Use:   use + " [--image] <image|-> --subject <identity>",
+		Short: "Verify the attestations of an image, release asset or workflow artifact",
+		Long: `Verify the sigstore attestations of an image, of an export archive, of a GitHub release asset, or
+of an artifact uploaded by a GitHub Actions workflow run.
+
+An image passes when at least one attestation verifies against the policy. The policy is the
+signer's identity: --issuer, the OIDC issuer (by default GitHub Actions), and --subject, the
+identity in the signing certificate. For GitHub Actions, the subject is the URI of the workflow
+that signed, https://github.com/<owner>/<repo>/.github/workflows/<file>@<ref>, which
+--github-workflow owner/repo/.github/workflows/<file>@<ref> builds for you; --subject-regexp
+matches several workflows at once. --predicate-type selects the attestations to verify, such as
+https://slsa.dev/provenance/v1 for provenance or https://spdx.dev/Document for SPDX SBOMs.`,
+		Example: `  # verify the provenance of an image built by a workflow
+  verify --image ghcr.io/nirmata/github-signing-demo:latest \
+    --github-workflow nirmata/github-signing-demo/.github/workflows/build-attested-image.yaml@refs/heads/main \
+    --predicate-type https://slsa.dev/provenance/v1
+
+  # accept any workflow of an organization
+  verify --image ghcr.io/nirmata/github-signing-demo:latest --subject-regexp '^https://github.com/nirmata/.*@refs/heads/main$'
+
+  # verify an image signed with a key
+  verify --image registry.example.com/app:1.0 --key cosign.pub
+
+  # verify every tag of a repository, reading the references from stdin
+  crane ls ghcr.io/nirmata/app --full-ref | verify - --subject-regexp '^https://github.com/nirmata/.*$'`,
+		Args: cobra.MaximumNArgs(1),
+	}, func(args []string) error {
+		if len(args) == 1 {
+			if *image != "" {
+				return errors.New("pass the image either as an argument or with --image, not both")
+			}
+			*image = args[0]
+		}
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := validateOutput(opts.Output); err != nil {
+			return err
+		}
+		if err := validateOnError(opts.OnError); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if opts.Lockfile != "" && *image == "" && *fromExport == "" {
+			return verifyImages(context.TODO(), pinnedImages(opts.Pins), opts)
+		}
+		if *image == stdinImage {
+			if *dryRun || *fromExport != "" || *githubRelease != "" || *githubArtifact != "" || *transitive {
+				return errors.New("reading the images from stdin can't be combined with --dry-run, --from-export, --github-release, --github-artifact or --transitive")
+			}
+			images, err := expandStdinImages([]string{*image}, os.Stdin)
+			if err != nil {
+				return err
+			}
+			return verifyImages(context.TODO(), images, opts)
+		}
+
+		if *dryRun {
+			var bundles []*Bundle
+			if *fromExport != "" {
+				export, err := readExport(*fromExport)
+				if err != nil {
+					return err
+				}
+				bundles = export.Bundles
+			} else {
+				var err error
+				bundles, _, err = resolveBundles(context.TODO(), *image, opts)
+				if err != nil {
+					return err
+				}
+			}
+			return listAttestations(os.Stdout, bundles, opts.PredicateTypes)
+		}
+
+		var artifact ActionsArtifact
+		if *githubArtifact != "" {
+			var err error
+			if artifact, err = parseActionsArtifact(*githubArtifact, *artifactName, *artifactPath); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		target, results, trustedMaterial, verifyErr := verifyTarget(*image, *fromExport, *githubRelease, *asset, *assetPath, artifact, *artifactArchive, opts)
+		outcome := tolerateInfrastructureError(ImageResult{Image: target, Results: results, Err: verifyErr}, opts)
+		if err := recordOutcomes(opts, outcome); err != nil {
+			return err
+		}
+		if err := writeOutcomes(os.Stdout, opts.Output, []ImageResult{outcome}); err != nil {
+			return err
+		}
+		if outcome.Err != nil {
+			return outcome.Err
+		}
+		if outcome.Warning != nil {
+			if opts.Output == outputText {
+				fmt.Fprintf(os.Stderr, "warning: %s was not verified: %v\n", target, outcome.Warning)
+			}
+			return nil
+		}
+		if outcome.Skipped != nil {
+			return nil
+		}
+
+		if *transitive {
+			tree := verifyProvenanceTree(context.TODO(), target, results, opts, trustedMaterial, *transitiveDepth)
+			if opts.Output == outputText {
+				printProvenanceTree(os.Stderr, tree)
+			}
+			if err := tree.failure(); err != nil {
+				return err
+			}
+		}
+
+		if opts.MinIdentities > 0 && opts.Output == outputText {
+			identities := verifiedIdentities(results)
+			fmt.Fprintf(os.Stderr, "verified by %d distinct identities:\n", len(identities))
+			for _, identity := range identities {
+				fmt.Fprintf(os.Stderr, "  %s\n", identity)
+			}
+		}
+
+		if opts.Output == outputText {
+			printAnnotations(os.Stderr, results)
+		}
+
+		if *stats {
+			printStats(os.Stderr, time.Since(start), opts.Timing, results)
+		}
+
+		if opts.Output != outputText {
+			// structured outputs already describe the attestations
+		} else if len(opts.PredicateTypes) > 1 {
+			if err := printStatementsByPredicateType(os.Stdout, results); err != nil {
+				return err
+			}
+		} else if err := printPayload(os.Stdout, results[0].Bundle); err != nil {
+			return err
+		}
+
+		if *showCertChain && opts.Output == outputText {
+			for i, result := range results {
+				chain, err := certificateChain(result.Bundle, trustedMaterial)
+				if err != nil {
+					return fmt.Errorf("verified attestation %d: %w", i+1, err)
+				}
+				printCertificateChain(os.Stdout, i+1, chain)
+			}
+		}
+
+		if *savePayloadsDir != "" {
+			if err := savePayloads(*savePayloadsDir, target, results); err != nil {
+				return err
+			}
+		}
+
+		if receiptOpts.enabled() {
+			if err := emitReceipt(context.TODO(), target, results[0].Desc, results, receiptOpts, opts, trustedMaterial); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// verifyTarget verifies the export archive, release asset, workflow artifact or image selected on the
+// command line, and returns the name of what was verified
+func verifyTarget(image, fromExport, githubRelease, asset, assetPath string, artifact ActionsArtifact, artifactArchive string, opts VerificationOptions) (string, []VerificationResult, *root.TrustedRoot, error) {
+	var results []VerificationResult
+	var trustedMaterial *root.TrustedRoot
+	if fromExport != "" {
+		export, err := readExport(fromExport)
+		if err != nil {
+			return image, nil, nil, err
+		}
+		if err := checkExportTrustedRoot(export, opts); err != nil {
+			return image, nil, nil, err
+		}
+		if err := checkTrustedRootFIPS(export.TrustedRoot, opts); err != nil {
+			return image, nil, nil, err
+		}
+		if err := checkExportImage(export, image, opts); err != nil {
+			return image, nil, nil, err
+		}
+		trustedMaterial = export.TrustedRoot
+		if image == "" {
+			image = export.Image
+		}
+		results, err = verifyAttestations(context.TODO(), image, export.Bundles, export.Descriptor, trustedMaterial, opts)
+		if err != nil {
+			return image, nil, nil, err
+		}
+	} else if githubRelease != "" {
+		release, err := parseReleaseAsset(githubRelease, asset)
+		if err != nil {
+			return image, nil, nil, err
+		}
+		trustedMaterial, err = getTrustedRoot(context.TODO(), opts)
+		if err != nil {
+			return image, nil, nil, err
+		}
+		image = release.String()
+		results, err = verifyReleaseAsset(context.TODO(), release, assetPath, opts, trustedMaterial)
+		if err != nil {
+			return image, nil, nil, err
+		}
+	} else if artifact.Repo != "" {
+		var err error
+		trustedMaterial, err = getTrustedRoot(context.TODO(), opts)
+		if err != nil {
+			return image, nil, nil, err
+		}
+		image = artifact.String()
+		results, err = verifyActionsArtifact(context.TODO(), artifact, artifactArchive, opts, trustedMaterial)
+		if err != nil {
+			return image, nil, nil, err
+		}
+	} else {
+		var err error
+		trustedMaterial, err = getTrustedRoot(context.TODO(), opts)
+		if err != nil {
+			return image, nil, nil, err
+		}
+		results, err = verifyImage(context.TODO(), image, opts, trustedMaterial)
+		if err != nil {
+			return image, nil, nil, err
+		}
+		if pinned := pinnedReference(image, results[0].Desc); pinned != image {
+			fmt.Fprintf(os.Stderr, "verified %s as %s\n", image, pinned)
+		}
+	}
+	return image, results, trustedMaterial, nil
+}
+
+// addVerificationFlags registers the policy flags shared by all commands that verify images
+func addVerificationFlags(fs *flag.FlagSet, opts *VerificationOptions) {
+	fs.Var(&opts.PredicateTypes, "predicate-type", "only verify bundles of this predicate type; when repeated or comma-separated, each type needs a verified attestation")
+	fs.StringVar(&opts.Output, "output", outputText, "output format: "+outputText+", "+outputKyverno+" for JSON results in the shape of Kyverno's image verification, or "+outputGitHubActions+" for workflow annotations and a job summary")
+	fs.StringVar(&opts.PayloadType, "payload-type", inTotoPayloadType, "DSSE payload type of the bundles to verify, e.g. "+simpleSigningPayloadType+" or application/json")
+	fs.StringVar(&opts.OIDCIssuer, "issuer", "", "custom oidc issuer (default derived from --github-host)")
+	fs.StringVar(&opts.Subject, "subject", "", "identity of the issuer")
+	fs.StringVar(&opts.GitHubWorkflow, "github-workflow", "", "workflow that signed the attestations, as owner/repo/.github/workflows/<file>@<ref>, instead of --subject")
+	fs.StringVar(&opts.GitHubReusableWorkflow, "github-reusable-workflow", "", "reusable workflow that signed the attestations, as owner/repo/.github/workflows/<file>@<ref>; --github-workflow then names the calling workflow")
+	fs.StringVar(&opts.Key, "key", "", "public key file or KMS key URI (awskms://, gcpkms://, azurekms://, hashivault://) the attestations are signed with, instead of a keyless identity")
+	fs.StringVar(&opts.SubjectRegexp, "subject-regexp", "", "regular expression the identity of the issuer must match, instead of --subject")
+	fs.StringVar(&opts.IdentityAllowlist, "identity-allowlist", "", "YAML list of issuer/subject patterns, one of which the signer must match")
+	fs.StringVar(&opts.IdentityDenylist, "identity-denylist", "", "YAML list of issuer/subject patterns the signer must not match")
+	fs.IntVar(&opts.MinIdentities, "min-identities", 0, "require verified attestations from at least this many distinct signing identities (issuer and subject)")
+	fs.IntVar(&opts.Concurrency, "concurrency", 4, "number of images verified in parallel by scan-manifests and --lockfile")
+	fs.StringVar(&opts.OnError, "on-error", onErrorFail, "when the registry, TUF repository or an API is unreachable: fail, warn and admit the image unverified, or skip it")
+	fs.StringVar(&opts.ResultsDB, "results-db", "", "record every verification outcome in this database, for the report command")
+	fs.BoolVar(&opts.Verbose, "verbose", false, "describe bundles that failed verification even when the image passes")
+	fs.BoolVar(&opts.Explain, "explain", false, "write a JSON trace of the checks made on each bundle and of the policy evaluation to stderr")
+	fs.BoolVar(&opts.RequireDigestReference, "require-digest-reference", false, "refuse images referenced by tag instead of digest")
+	fs.BoolVar(&opts.RequireDigestReference, "deny-tag", false, "alias of --require-digest-reference")
+	fs.StringVar(&opts.DigestAlgorithm, "digest-algorithm", "sha256", "algorithm of the image digest the attestations are bound to, sha256 or sha512; tags are resolved to a digest of this algorithm")
+	fs.StringVar(&opts.Lockfile, "lockfile", "", "YAML or JSON map of image references to the digests they must resolve to; images missing from it fail")
+	fs.Var(&opts.Assertions, "assert", `expression every verified payload must satisfy, e.g. 'predicate.buildDefinition.buildType == "..."' (ops ==, != and =~, can be repeated)`)
+	fs.Var(&opts.MaxAttestationAge, "max-attestation-age", "fail attestations signed longer ago than this, e.g. 30d or 12h")
+	fs.Var(&opts.MinSigningTime, "min-signing-time", "fail attestations signed before this time, e.g. 2025-01-02 or 2025-01-02T15:04:05Z")
+	fs.Var(&opts.MaxSigningTime, "max-signing-time", "fail attestations signed after this time")
+	fs.Var(&opts.SignatureAlgorithms, "allowed-signature-algorithms", "fail attestations signed with other algorithms than these, e.g. ecdsa-p256,ed25519 (any of "+strings.Join(signatureAlgorithms, ", ")+")")
+	fs.BoolVar(&opts.RequireSCT, "require-sct", false, "require a signed certificate timestamp in the signing certificates, verified against the CT logs of the trusted root")
+	fs.BoolVar(&opts.Scan, "scan", false, "look up the packages of the verified SBOM attestation in OSV and fail on vulnerabilities at or above --severity-threshold")
+	fs.StringVar(&opts.SeverityThreshold, "severity-threshold", "high", "lowest severity of the vulnerabilities failing --scan: "+strings.Join(severityLevels, ", "))
+	fs.BoolVar(&opts.IgnoreUnknownSeverity, "ignore-unknown-severity", false, "don't fail --scan on vulnerabilities without a severity rating or CVSS v3 vector")
+	fs.StringVar(&opts.OSVURL, "osv-url", defaultOSVURL, "OSV API queried by --scan")
+	fs.Var(&opts.Requirements, "require", "minimum number of verified attestations of a predicate type, as <predicate-type>:<count> (can be repeated)")
+	fs.Var(&opts.PredicatePlugins, "predicate-plugin", "command receiving each verified predicate of a type as JSON on stdin, which can veto it or annotate it, as <predicate-type>=<command> (can be repeated)")
+	fs.Var(&opts.WASMPolicies, "wasm-policy", "WASI module, or OPA policy built with opa build -t wasm, run in a sandbox against the verified attestations, which must allow the image (can be repeated)")
+	fs.IntVar(&opts.WASMMemoryLimit, "wasm-memory-limit", 64, "memory in MiB each --wasm-policy module can use")
+	fs.StringVar(&opts.NotationTrustPolicy, "notation-trust-policy", "", "Notation trustpolicy.json; images of its registry scopes must also carry a Notation signature it verifies")
+	fs.StringVar(&opts.NotationTrustStore, "notation-trust-store", "", "Notation trust store directory of --notation-trust-policy (default the notation CLI's)")
+	addSourceFlags(fs, opts)
+	addTrustFlags(fs, opts)
+	addTransportFlags(fs, opts)
+}
+
+// addSourceFlags registers the flags selecting where bundles are discovered
+func addSourceFlags(fs *flag.FlagSet, opts *VerificationOptions) {
+	opts.Timing = &Timing{}
+	fs.IntVar(&opts.Limit, "limit", 100, "hard cap on the number of bundle referrers, or Rekor entries, downloaded per image")
+	fs.Var(&opts.Sources, "source", fmt.Sprintf("bundle sources to query and merge, one of %s (default oci, or file with --bundle-path)", strings.Join(bundleSourceNames(), ", ")))
+	fs.Int64Var(&opts.MaxBundleSize, "max-bundle-size", defaultMaxBundleSize, "maximum size in bytes of a bundle layer downloaded from the registry")
+	fs.Var(&opts.ReferrerAnnotations, "referrer-annotation", "only download referrers annotated with <key>=<value> (can be repeated, all must match)")
+	fs.Var(&opts.ArtifactTypes, "artifact-type", "only fetch referrers with this artifact type, filtered by the registry when supported (default any sigstore bundle type)")
+	fs.StringVar(&opts.GitHubRepo, "github-repo", "", "owner/repo (or owner) to query for the github bundle source")
+	fs.StringVar(&opts.RekorURL, "rekor-url", defaultRekorURL, "Rekor instance queried by the rekor bundle source")
+	fs.BoolVar(&opts.EnableRekorSearch, "enable-rekor-search", false, "search Rekor for attestations of the image digest when no other source returns bundles")
+}
+
+// addTrustFlags registers the flags selecting the GitHub host and the TUF repository the trusted root is fetched from
+func addTrustFlags(fs *flag.FlagSet, opts *VerificationOptions) {
+	fs.StringVar(&opts.GitHubHost, "github-host", defaultGitHubHost, "GitHub host the attestations were created on, e.g. a GitHub Enterprise Server hostname")
+	fs.StringVar(&opts.GitHubAPIURL, "github-api-url", "", "GitHub API base URL (default derived from --github-host)")
+	fs.StringVar(&opts.TUFMirror, "tuf-mirror", "", "TUF repository serving the trusted root (default derived from --github-host)")
+	fs.StringVar(&opts.TUFRoot, "tuf-root", "", "path to the initial root.json of --tuf-mirror (default the root saved by update-root, or the embedded root for "+githubTUFMirror+")")
+	fs.StringVar(&opts.GitHubAppID, "github-app-id", "", "authenticate GitHub API requests as an installation of this GitHub App, instead of with $GITHUB_TOKEN")
+	fs.StringVar(&opts.GitHubInstallationID, "github-app-installation-id", "", "installation of --github-app-id to request tokens for")
+	fs.StringVar(&opts.GitHubAppPrivateKey, "github-app-private-key", "", "PEM private key file of --github-app-id")
+	fs.StringVar(&opts.GitHubTokenExchangeURL, "github-token-exchange-url", "", "token broker (e.g. octo-sts) exchanging the workload's OIDC token for a GitHub token, instead of $GITHUB_TOKEN")
+	fs.StringVar(&opts.GitHubOIDCTokenFile, "github-oidc-token-file", "", "OIDC token to exchange, e.g. a projected service account token (default the GitHub Actions token)")
+	fs.StringVar(&opts.GitHubOIDCAudience, "github-oidc-audience", "", "audience of the OIDC token to exchange (default the host of --github-token-exchange-url)")
+	fs.StringVar(&opts.TrustedRootPath, "trusted-root-path", "", "path to a trusted_root.json to use instead of fetching it through TUF, e.g. for a private Sigstore instance")
+	fs.StringVar(&opts.PinTrustedRoot, "pin-trusted-root", "", "sha256 the trusted_root.json must have, so that trust updates only apply once reviewed with trusted-root diff")
+}
+
+// verifyImage verifies the bundles of an image as they are fetched, and stops fetching once the
+// --require rules are satisfied
+func verifyImage(ctx context.Context, image string, opts VerificationOptions, trustedMaterial *root.TrustedRoot) ([]VerificationResult, error) {
+	if err := checkDigestReference(image, opts); err != nil {
+		return nil, err
+	}
+	ref, desc, err := resolveDescriptor(ctx, image, opts.digestAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPinnedDigest(image, desc, opts); err != nil {
+		return nil, err
+	}
+	if err := missingAttestations.check(image, ref, desc, opts); err != nil {
+		return nil, err
+	}
+	verifier, err := newBundleVerifier(ctx, image, desc, trustedMaterial, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := streamImageBundles(ctx, ref, desc, opts, verifier.add); err != nil {
+		return nil, err
+	}
+	if verifier.count == 0 {
+		missingAttestations.add(ref, desc, opts)
+	}
+	results, err := verifier.finish()
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyNotationSignatures(ctx, ref, desc, opts); err != nil {
+		return nil, err
+	}
+	if err := runPredicatePlugins(ctx, image, results, opts); err != nil {
+		return nil, err
+	}
+	if err := evaluateWASMPolicies(ctx, image, results, opts); err != nil {
+		return nil, err
+	}
+	if err := scanVulnerabilities(ctx, results, opts); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// verifyAttestations verifies already fetched bundles and fails unless at least one of them,
+// and every --require rule, is satisfied
+func verifyAttestations(ctx context.Context, image string, bundles []*Bundle, desc *v1.Descriptor, trustedMaterial *root.TrustedRoot, opts VerificationOptions) ([]VerificationResult, error) {
+	if err := checkPinnedDigest(image, desc, opts); err != nil {
+		return nil, err
+	}
+	verifier, err := newBundleVerifier(ctx, image, desc, trustedMaterial, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bundles {
+		if more, err := verifier.add(b); err != nil {
+			return nil, err
+		} else if !more {
+			break
+		}
+	}
+	results, err := verifier.finish()
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyImageNotationSignatures(ctx, image, desc, opts); err != nil {
+		return nil, err
+	}
+	if err := runPredicatePlugins(ctx, image, results, opts); err != nil {
+		return nil, err
+	}
+	if err := evaluateWASMPolicies(ctx, image, results, opts); err != nil {
+		return nil, err
+	}
+	if err := scanVulnerabilities(ctx, results, opts); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func parseBundle(bundleBytes []byte) (*Bundle, error) {
+	b := &bundle.ProtobufBundle{}
+	if err := b.UnmarshalJSON(bundleBytes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bundle: %w", err)
+	}
+	return newBundle(b), nil
+}
+
+func matchesPredicateType(b *Bundle, predicateTypes []string) bool {
+	return len(predicateTypes) == 0 || (b.DSSE_Envelope != nil && slices.Contains(predicateTypes, b.DSSE_Envelope.PredicateType))
+}
+
+func buildPolicy(desc *v1.Descriptor, opts VerificationOptions) (verify.PolicyBuilder, error) {
+	digest, err := hex.DecodeString(desc.Digest.Hex)
+	if err != nil {
+		return verify.PolicyBuilder{}, err
+	}
+	artifactDigestVerificationOption := verify.WithArtifactDigest(desc.Digest.Algorithm, digest)
+
+	// TODO: Add full regexp support to sigstore and cosign
+	// Verify images only has subject field, and no subject regexp, subject cannot be passed to subject regexp
+	// because then string containing the subjects will also work. We should just add an issuer regexp
+	// Solve this in a seperate PR,
+	// See: https://github.com/sigstore/cosign/blob/7c20052077a81d667526af879ec40168899dde1f/pkg/cosign/verify.go#L339-L356
+	subject, subjectRegexp := opts.Subject, opts.SubjectRegexp
+	if subjectRegexp != "" {
+		subject = ""
+	} else if strings.Contains(subject, "*") {
+		subjectRegexp = subject
+		subject = ""
+	}
+	if opts.PayloadType != inTotoPayloadType {
+		// the digest is matched against the payload by checkPayloadDigest instead
+		artifactDigestVerificationOption = verify.WithoutArtifactUnsafe()
+	}
+	if opts.Key != "" {
+		// key-signed bundles have no certificate identity, the signature is checked against --key
+		return verify.NewPolicy(artifactDigestVerificationOption, verify.WithoutIdentitiesUnsafe()), nil
+	}
+	if subject == "" && subjectRegexp == "" && opts.IdentityAllowlist != "" {
+		// the signer is matched against the allowlist by checkIdentityLists instead
+		return verify.NewPolicy(artifactDigestVerificationOption, verify.WithoutIdentitiesUnsafe()), nil
+	}
+	sanMatcher, err := verify.NewSANMatcher(subject, subjectRegexp)
+	if err != nil {
+		return verify.PolicyBuilder{}, err
+	}
+	issuerMatcher, err := verify.NewIssuerMatcher(opts.OIDCIssuer, "")
+	if err != nil {
+		return verify.PolicyBuilder{}, err
+	}
+	callerWorkflow, err := gitHubCallerWorkflowURI(opts)
+	if err != nil {
+		return verify.PolicyBuilder{}, err
+	}
+	id, err := verify.NewCertificateIdentity(sanMatcher, issuerMatcher, certificate.Extensions{BuildConfigURI: callerWorkflow})
+	if err != nil {
+		return verify.PolicyBuilder{}, err
+	}
+	return verify.NewPolicy(artifactDigestVerificationOption, verify.WithCertificateIdentity(id)), nil
+}
+
+// buildVerifyOptions requires a transparency log entry when the trusted root has a Rekor log, and
+// a signed timestamp otherwise, since instances without a log (such as GitHub's own instance for
+// private repositories, or a private deployment) rely on a timestamp authority instead. Observer
+// timestamps are either the integrated time of a Rekor v1 entry or a signed timestamp, so entries of
+// the tile-backed Rekor v2 log, which have no integrated time, verify as well.
+func buildVerifyOptions(opts VerificationOptions, trustedRoot *root.TrustedRoot) []verify.VerifierOption {
+	var verifierOptions []verify.VerifierOption
+	if len(trustedRoot.RekorLogs()) == 0 && len(trustedRoot.TimestampingAuthorities()) > 0 {
+		verifierOptions = append(verifierOptions, verify.WithSignedTimestamps(1))
+	} else {
+		verifierOptions = append(verifierOptions, verify.WithTransparencyLog(1), verify.WithObserverTimestamps(1))
+	}
+	if opts.requireSCT() {
+		verifierOptions = append(verifierOptions, verify.WithSignedCertificateTimestamps(1))
+	}
+	return verifierOptions
+}
+
+func getTrustedRoot(ctx context.Context, opts VerificationOptions) (*root.TrustedRoot, error) {
+	start := time.Now()
+	targetBytes, err := getTrustedRootJSON(ctx, opts)
+	opts.Timing.add(&opts.Timing.TUF, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPinnedTrustedRoot(targetBytes, opts); err != nil {
+		return nil, err
+	}
+	trustedRoot, err := root.NewTrustedRootFromJSON(targetBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trusted root: %w", err)
+	}
+	if err := checkTrustedRootFIPS(trustedRoot, opts); err != nil {
+		return nil, err
+	}
+
+	return trustedRoot, nil
+}
+
+func getTrustedRootJSON(ctx context.Context, opts VerificationOptions) ([]byte, error) {
+	if opts.TrustedRootPath != "" {
+		targetBytes, err := os.ReadFile(opts.TrustedRootPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted root: %w", err)
+		}
+		return targetBytes, nil
+	}
+	return trustedRoots.fetch(ctx, opts)
+}
+
+// bundleVerifier verifies the bundles of one image one at a time
+type bundleVerifier struct {
+	image       string
+	desc        *v1.Descriptor
+	opts        VerificationOptions
+	trustedRoot *root.TrustedRoot
+	policy      verify.PolicyBuilder
+	verifier    *verify.Verifier
+	allowlist   IdentityList
+	denylist    IdentityList
+	results     []VerificationResult
+	failures    []BundleFailure
+	count       int
+	trace       *PolicyTrace // nil without --explain
+}
+
+func newBundleVerifier(ctx context.Context, image string, desc *v1.Descriptor, trustedRoot *root.TrustedRoot, opts VerificationOptions) (*bundleVerifier, error) {
+	policy, err := buildPolicy(desc, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCTLogs(trustedRoot, opts); err != nil {
+		return nil, err
+	}
+	verifier, err := verifiers.get(ctx, trustedRoot, opts)
+	if err != nil {
+		return nil, err
+	}
+	v := &bundleVerifier{image: image, desc: desc, opts: opts, trustedRoot: trustedRoot, policy: policy, verifier: verifier, results: make([]VerificationResult, 0), trace: newPolicyTrace(image, opts)}
+	if opts.IdentityAllowlist != "" {
+		if v.allowlist, err = verifiers.identityList(opts.IdentityAllowlist); err != nil {
+			return nil, err
+		}
+	}
+	if opts.IdentityDenylist != "" {
+		if v.denylist, err = verifiers.identityList(opts.IdentityDenylist); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// add verifies a bundle matching the predicate type filter, and reports whether more bundles are
+// needed to satisfy the --require rules. Without rules every bundle is verified.
+func (v *bundleVerifier) add(bundle *Bundle) (bool, error) {
+	v.count++
+	v.opts.observer().OnBundleFetched(v.image, bundle)
+	trace := v.trace.addBundle(v.count, bundle)
+	if bundle.ParseErr != nil {
+		// the predicate and payload types of a bundle that can't be parsed are unknown, so it is reported rather than filtered out
+		trace.record("parse bundle", true, bundle.ParseErr)
+		v.failures = append(v.failures, newBundleFailure(v.count, bundle, bundle.ParseErr))
+		v.opts.observer().OnBundleVerified(v.image, bundle, bundle.ParseErr)
+		return true, nil
+	}
+	if bundle.StatementErr != nil && matchesPayloadType(bundle, v.opts.PayloadType) {
+		// the predicate type of an invalid statement is unknown, so it is reported rather than filtered out
+		trace.record("parse statement", true, bundle.StatementErr)
+		v.failures = append(v.failures, newBundleFailure(v.count, bundle, bundle.StatementErr))
+		v.opts.observer().OnBundleVerified(v.image, bundle, bundle.StatementErr)
+		return true, nil
+	}
+	if !matchesPredicateType(bundle, v.opts.PredicateTypes) || !matchesPayloadType(bundle, v.opts.PayloadType) {
+		trace.skip("predicate or payload type not selected")
+		return true, nil
+	}
+	var result *verify.VerificationResult
+	var err error
+	if bundle.PayloadType == inTotoPayloadType {
+		err = trace.record("statement subject", true, checkStatementSubject(bundle, v.desc))
+	}
+	if err == nil {
+		err = trace.record("signed with the key", v.opts.Key != "", checkKeySigned(bundle, v.opts))
+	}
+	if err == nil {
+		err = trace.record("signature algorithm", len(v.opts.allowedSignatureAlgorithms()) > 0, checkBundleSignatureAlgorithm(bundle, v.opts.allowedSignatureAlgorithms()))
+	}
+	start := time.Now()
+	if err == nil {
+		result, err = v.verifier.Verify(bundle.ProtoBundle, v.policy)
+		err = trace.recordVerification(bundle, result, err, v.opts)
+	}
+	if err == nil && (trace != nil || v.opts.Verbose) {
+		// sigstore-go enforces the SCT with --require-sct; without it a missing or invalid SCT
+		// doesn't fail the bundle, but is reported
+		if applies, sctErr := checkSCT(bundle, result, v.trustedRoot); applies {
+			trace.record("signed certificate timestamp", true, sctErr)
+			if sctErr != nil && v.opts.Verbose {
+				fmt.Fprintf(os.Stderr, "bundle #%d of %s: %v\n", v.count, v.image, sctErr)
+			}
+		}
+	}
+	verifyDuration := time.Since(start)
+	v.opts.Timing.add(&v.opts.Timing.Verify, verifyDuration)
+	if err == nil {
+		err = trace.record("signing time", v.opts.MaxAttestationAge != 0 || !time.Time(v.opts.MinSigningTime).IsZero() || !time.Time(v.opts.MaxSigningTime).IsZero(), checkFreshness(result, v.opts, time.Now()))
+	}
+	if err == nil && bundle.PayloadType != "" && bundle.PayloadType != inTotoPayloadType {
+		err = trace.record("payload digest", true, checkPayloadDigest(bundle, v.desc))
+	}
+	if err == nil {
+		err = trace.record("identity lists", v.opts.IdentityAllowlist != "" || v.opts.IdentityDenylist != "", checkIdentityLists(bundle, v.opts, v.allowlist, v.denylist))
+	}
+	if err == nil {
+		err = trace.record("assertions", len(v.opts.Assertions) > 0, checkAssertions(bundle, v.opts.Assertions))
+	}
+	v.opts.observer().OnBundleVerified(v.image, bundle, err)
+	if err != nil {
+		v.failures = append(v.failures, newBundleFailure(v.count, bundle, err))
+		return true, nil
+	}
+	v.results = append(v.results, VerificationResult{Bundle: bundle, Result: result, Desc: v.desc, Timing: BundleTiming{Download: bundle.Download, Verify: verifyDuration}})
+	return !v.satisfied(), nil
+}
+
+// satisfied reports whether the --require rules, including one attestation of each selected
+// predicate type, and --min-identities are met, so no more bundles need to be verified
+func (v *bundleVerifier) satisfied() bool {
+	requirements := v.opts.requirements()
+	if len(requirements) == 0 && v.opts.MinIdentities == 0 {
+		return false
+	}
+	return checkRequirements(v.results, requirements) == nil && checkMinIdentities(v.results, v.opts.MinIdentities) == nil
+}
+
+// finish fails unless at least one bundle, and every --require rule, is satisfied, and notifies the
+// observer of the outcome
+func (v *bundleVerifier) finish() ([]VerificationResult, error) {
+	results, err := v.evaluate()
+	v.trace.finish(os.Stderr, v.desc.Digest.String(), v.opts, v.results, err)
+	v.opts.observer().OnPolicyEvaluated(v.image, results, err)
+	return results, err
+}
+
+// evaluate checks the verified bundles against the policy. Bundles that failed verification are
+// described in the error, or on stderr with --verbose.
+func (v *bundleVerifier) evaluate() ([]VerificationResult, error) {
+	err := checkRequirements(v.results, v.opts.requirements())
+	if err == nil {
+		err = checkMinIdentities(v.results, v.opts.MinIdentities)
+	}
+	if err == nil && len(v.results) == 0 {
+		err = fmt.Errorf("no verified attestations found for %s", v.image)
+	}
+	if err != nil {
+		if len(v.failures) > 0 {
+			err = fmt.Errorf("%w\n%d of %d bundles failed verification:\n%s", err, len(v.failures), v.count, describeFailures(v.failures, v.opts))
+			return nil, withFetchErrors(err, v.failures)
+		}
+		return nil, err
+	}
+	if v.opts.Verbose && len(v.failures) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d bundles of %s failed verification:\n%s\n", len(v.failures), v.count, v.image, describeFailures(v.failures, v.opts))
+	}
+	return v.results, nil
+}
+
+// requirements are the --require rules, plus one verified attestation of each predicate type when
+// several were selected
+func (opts VerificationOptions) requirements() []Requirement {
+	requirements := append([]Requirement{}, opts.Requirements...)
+	if len(opts.PredicateTypes) < 2 {
+		return requirements
+	}
+	for _, predicateType := range opts.PredicateTypes {
+		if !slices.ContainsFunc(requirements, func(r Requirement) bool { return r.PredicateType == predicateType }) {
+			requirements = append(requirements, Requirement{PredicateType: predicateType, Count: 1})
+		}
+	}
+	return requirements
+}
+
+func checkRequirements(results []VerificationResult, requirements []Requirement) error {
+	counts := make(map[string]int)
+	for _, result := range results {
+		if result.Bundle.DSSE_Envelope != nil {
+			counts[result.Bundle.DSSE_Envelope.PredicateType]++
+		}
+	}
+
+	var unmet []string
+	for _, req := range requirements {
+		if counts[req.PredicateType] < req.Count {
+			unmet = append(unmet, fmt.Sprintf("%s (found %d, required %d)", req.PredicateType, counts[req.PredicateType], req.Count))
+		}
+	}
+	if len(unmet) > 0 {
+		return fmt.Errorf("attestation requirements not met: %s", strings.Join(unmet, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequirementFlagsSet(t *testing.T) {
+	tests := []struct {
+		value    string
+		req      Requirement
+		expected string
+	}{
+		{value: "https://slsa.dev/provenance/v1:1", req: Requirement{PredicateType: "https://slsa.dev/provenance/v1", Count: 1}},
+		{value: "https://spdx.dev/Document:3", req: Requirement{PredicateType: "https://spdx.dev/Document", Count: 3}},
+		{value: "https://slsa.dev/provenance/v1", expected: "count must be a positive integer"},
+		{value: "https://slsa.dev/provenance/v1:0", expected: "count must be a positive integer"},
+		{value: "https://slsa.dev/provenance/v1:-1", expected: "count must be a positive integer"},
+		{value: "https://slsa.dev/provenance/v1:", expected: "expected <predicate-type>:<count>"},
+		{value: ":1", expected: "expected <predicate-type>:<count>"},
+		{value: "provenance", expected: "expected <predicate-type>:<count>"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			var r requirementFlags
+			err := r.Set(test.value)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			case test.expected == "" && (len(r) != 1 || r[0] != test.req):
+				t.Fatalf("expected %v, got %v", test.req, r)
+			}
+		})
+	}
+}
+
+func TestRequirementFlagsString(t *testing.T) {
+	var r requirementFlags
+	for _, value := range []string{"https://slsa.dev/provenance/v1:1", "https://spdx.dev/Document:2"} {
+		if err := r.Set(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if s := r.String(); s != "https://slsa.dev/provenance/v1:1,https://spdx.dev/Document:2" {
+		t.Fatalf("unexpected requirements %q", s)
+	}
+}
@@ -0,0 +1,179 @@
+package verify
+
+import (
+	"crypto/fips140"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// buildRepository and buildRun identify the repository and workflow run that built the binary, set
+// in CI with -ldflags "-X github-signing-demo-verify/pkg/verify.buildRepository=$GITHUB_REPOSITORY
+// -X github-signing-demo-verify/pkg/verify.buildRun=<run URL>"
+var (
+	buildRepository = ""
+	buildRun        = ""
+)
+
+// versionDependencies are the modules whose versions decide what verification does
+var versionDependencies = []string{
+	"github.com/sigstore/sigstore-go",
+	"github.com/sigstore/sigstore",
+	"github.com/theupdateframework/go-tuf/v2",
+	"github.com/google/go-containerregistry",
+	"github.com/in-toto/in-toto-golang",
+}
+
+// VersionInfo identifies the build of the verifier, for bug reports and audits
+type VersionInfo struct {
+	Version      string            `json:"version"`
+	Module       string            `json:"module,omitempty"`
+	GoVersion    string            `json:"goVersion"`
+	Platform     string            `json:"platform"`
+	Commit       string            `json:"commit,omitempty"`
+	CommitTime   string            `json:"commitTime,omitempty"`
+	Modified     bool              `json:"modified,omitempty"`
+	FIPS         bool              `json:"fips"`
+	Dependencies map[string]string `json:"dependencies"`
+	EmbeddedRoot EmbeddedRootInfo  `json:"embeddedRoot"`
+	// BinaryDigest is the sha256 of the running binary, the subject of its attestation
+	BinaryDigest string `json:"binaryDigest,omitempty"`
+	BuildRun     string `json:"buildRun,omitempty"`
+	// Attestations is where the GitHub attestations API serves the attestations of the binary
+	Attestations string `json:"attestations,omitempty"`
+}
+
+// EmbeddedRootInfo describes the TUF root embedded for githubTUFMirror
+type EmbeddedRootInfo struct {
+	Mirror  string    `json:"mirror"`
+	Version int       `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+func newVersionCommand() *cobra.Command {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	format := fs.String("format", outputText, "output format: text or json")
+	return newCommand(fs, commandDoc{
+		Use:   "version",
+		Short: "Print the version of the verifier, its dependencies, embedded TUF root and build provenance",
+		Long: `Print the version and commit of the verifier, the versions of sigstore-go, go-tuf and the other
+libraries verification relies on, the version and expiry of the embedded TUF root, and the digest of
+the binary. Binaries built in CI also name the workflow run that built them and where their
+attestations can be looked up, so that the binary itself can be verified.`,
+		Example: "  version\n  version --format json",
+	}, func(args []string) error {
+		if *format != outputText && *format != "json" {
+			return fmt.Errorf("invalid --format %q, expected text or json", *format)
+		}
+		info, err := versionInfo()
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(info)
+		}
+		writeVersionInfo(os.Stdout, info)
+		return nil
+	})
+}
+
+// versionInfo reads the build information the Go toolchain embeds in the binary
+func versionInfo() (VersionInfo, error) {
+	info := VersionInfo{
+		Version:      version,
+		GoVersion:    runtime.Version(),
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		FIPS:         fips140.Enabled(),
+		Dependencies: map[string]string{},
+		BuildRun:     buildRun,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Module = build.Main.Path
+		if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.CommitTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+		for _, dep := range build.Deps {
+			for _, path := range versionDependencies {
+				if dep.Path == path {
+					info.Dependencies[path] = dep.Version
+				}
+			}
+		}
+	}
+
+	var root struct {
+		Signed struct {
+			Version int       `json:"version"`
+			Expires time.Time `json:"expires"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(githubTUFRoot, &root); err != nil {
+		return info, fmt.Errorf("failed to parse the embedded TUF root: %w", err)
+	}
+	info.EmbeddedRoot = EmbeddedRootInfo{Mirror: githubTUFMirror, Version: root.Signed.Version, Expires: root.Signed.Expires}
+
+	if executable, err := os.Executable(); err == nil {
+		if data, err := os.ReadFile(executable); err == nil {
+			sum := sha256.Sum256(data)
+			info.BinaryDigest = "sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+	if buildRepository != "" && info.BinaryDigest != "" {
+		info.Attestations = fmt.Sprintf("%s/repos/%s/attestations/%s", gitHubEndpoints(defaultGitHubHost).APIURL, buildRepository, info.BinaryDigest)
+	}
+	return info, nil
+}
+
+func writeVersionInfo(w io.Writer, info VersionInfo) {
+	fmt.Fprintf(w, "version:        %s\n", info.Version)
+	fmt.Fprintf(w, "module:         %s\n", valueOr(info.Module, "-"))
+	commit := valueOr(info.Commit, "-")
+	if info.Modified {
+		commit += " (modified)"
+	}
+	fmt.Fprintf(w, "commit:         %s\n", commit)
+	fmt.Fprintf(w, "commit time:    %s\n", valueOr(info.CommitTime, "-"))
+	fmt.Fprintf(w, "go:             %s %s\n", info.GoVersion, info.Platform)
+	fmt.Fprintf(w, "fips:           %t\n", info.FIPS)
+	fmt.Fprintln(w, "dependencies:")
+	for _, path := range versionDependencies {
+		fmt.Fprintf(w, "  %-40s %s\n", path, valueOr(info.Dependencies[path], "-"))
+	}
+	fmt.Fprintf(w, "embedded root:  version %d of %s, expires %s\n", info.EmbeddedRoot.Version, info.EmbeddedRoot.Mirror, info.EmbeddedRoot.Expires.UTC().Format(time.DateOnly))
+	fmt.Fprintf(w, "binary digest:  %s\n", valueOr(info.BinaryDigest, "-"))
+	if info.BuildRun != "" {
+		fmt.Fprintf(w, "build run:      %s\n", info.BuildRun)
+	}
+	if info.Attestations != "" {
+		fmt.Fprintf(w, "attestations:   %s\n", info.Attestations)
+		fmt.Fprintf(w, "verify with:    gh attestation verify %s --repo %s\n", executableName(), buildRepository)
+	}
+}
+
+func executableName() string {
+	if executable, err := os.Executable(); err == nil {
+		return executable
+	}
+	return os.Args[0]
+}
@@ -0,0 +1,339 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const defaultOSVURL = "https://api.osv.dev"
+
+// severityLevels in increasing order
+var severityLevels = []string{"low", "medium", "high", "critical"}
+
+// unknownSeverity is the severity of vulnerabilities without a rating or CVSS v3 vector
+const unknownSeverity = "unknown"
+
+// osvBatchSize is the maximum number of queries of an OSV querybatch request
+const osvBatchSize = 1000
+
+// Vulnerability is a known vulnerability of a package listed in an SBOM
+type Vulnerability struct {
+	ID      string
+	Package string
+	// Severity is one of severityLevels, none for a CVSS score of 0, or unknownSeverity when OSV records
+	// no rating or CVSS v3 vector
+	Severity string
+}
+
+// scanVulnerabilities looks up the packages of the verified SBOM attestations in OSV, and fails
+// when one of them has a vulnerability at or above --severity-threshold, or of unknown severity
+// unless --ignore-unknown-severity
+func scanVulnerabilities(ctx context.Context, results []VerificationResult, opts VerificationOptions) error {
+	if !opts.Scan {
+		return nil
+	}
+	threshold := slices.Index(severityLevels, opts.SeverityThreshold)
+	if threshold < 0 {
+		return fmt.Errorf("invalid --severity-threshold %q, expected one of %s", opts.SeverityThreshold, strings.Join(severityLevels, ", "))
+	}
+
+	var purls []string
+	scanned := false
+	for _, result := range results {
+		sbom, err := result.Bundle.SBOM()
+		if err != nil {
+			continue
+		}
+		packages, err := sbomPackages(sbom)
+		if err != nil {
+			return err
+		}
+		scanned = true
+		for _, purl := range packages {
+			if !slices.Contains(purls, purl) {
+				purls = append(purls, purl)
+			}
+		}
+	}
+	if !scanned {
+		return errors.New("--scan requires a verified SPDX or CycloneDX attestation")
+	}
+
+	vulns, err := (&osvClient{URL: opts.OSVURL}).scan(ctx, purls)
+	if err != nil {
+		return err
+	}
+	var found []string
+	for _, vuln := range vulns {
+		if vuln.fails(threshold, opts) {
+			found = append(found, fmt.Sprintf("  %s (%s) in %s", vuln.ID, vuln.Severity, vuln.Package))
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%d vulnerabilities failing --severity-threshold %s:\n%s", len(found), opts.SeverityThreshold, strings.Join(found, "\n"))
+	}
+	return nil
+}
+
+// fails reports whether the vulnerability is at or above the index of --severity-threshold in
+// severityLevels. A vulnerability of unknown severity may well be critical, so it fails unless
+// --ignore-unknown-severity.
+func (v Vulnerability) fails(threshold int, opts VerificationOptions) bool {
+	if v.Severity == unknownSeverity {
+		return !opts.IgnoreUnknownSeverity
+	}
+	return slices.Index(severityLevels, v.Severity) >= threshold
+}
+
+// sbomPackages returns the package URLs of an SPDX 2 or CycloneDX JSON document. Packages without
+// a version can't be matched against vulnerabilities and are left out.
+func sbomPackages(sbom *SBOM) ([]string, error) {
+	var purls []string
+	switch sbom.Format {
+	case "spdx":
+		var doc struct {
+			Packages []struct {
+				ExternalRefs []struct {
+					ReferenceType    string `json:"referenceType"`
+					ReferenceLocator string `json:"referenceLocator"`
+				} `json:"externalRefs"`
+			} `json:"packages"`
+		}
+		if err := json.Unmarshal(sbom.Document, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse SPDX document: %w", err)
+		}
+		for _, pkg := range doc.Packages {
+			for _, ref := range pkg.ExternalRefs {
+				if ref.ReferenceType == "purl" {
+					purls = append(purls, ref.ReferenceLocator)
+				}
+			}
+		}
+	case "cyclonedx":
+		var doc cycloneDXComponents
+		if err := json.Unmarshal(sbom.Document, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse CycloneDX document: %w", err)
+		}
+		purls = doc.purls()
+	}
+	return slices.DeleteFunc(purls, func(purl string) bool { return !strings.Contains(purl, "@") }), nil
+}
+
+type cycloneDXComponents struct {
+	Components []struct {
+		PURL string `json:"purl"`
+		cycloneDXComponents
+	} `json:"components"`
+}
+
+func (c cycloneDXComponents) purls() []string {
+	var purls []string
+	for _, component := range c.Components {
+		if component.PURL != "" {
+			purls = append(purls, component.PURL)
+		}
+		purls = append(purls, component.cycloneDXComponents.purls()...)
+	}
+	return purls
+}
+
+// osvClient queries the OSV API for the vulnerabilities of packages
+type osvClient struct {
+	URL string
+	// severities caches the severity of each vulnerability
+	severities map[string]string
+}
+
+func (c *osvClient) scan(ctx context.Context, purls []string) ([]Vulnerability, error) {
+	c.severities = map[string]string{}
+	var vulns []Vulnerability
+	for batch := range slices.Chunk(purls, osvBatchSize) {
+		var request struct {
+			Queries []map[string]map[string]string `json:"queries"`
+		}
+		for _, purl := range batch {
+			request.Queries = append(request.Queries, map[string]map[string]string{"package": {"purl": purl}})
+		}
+		var response struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+			} `json:"results"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/v1/querybatch", request, &response); err != nil {
+			return nil, fmt.Errorf("failed to query OSV: %w", err)
+		}
+		for i, result := range response.Results {
+			if i >= len(batch) {
+				break
+			}
+			for _, vuln := range result.Vulns {
+				severity, err := c.severity(ctx, vuln.ID)
+				if err != nil {
+					return nil, err
+				}
+				vulns = append(vulns, Vulnerability{ID: vuln.ID, Package: batch[i], Severity: severity})
+			}
+		}
+	}
+	return vulns, nil
+}
+
+// severity returns the rating of the vulnerability from its database, else from its CVSS v3 vector
+func (c *osvClient) severity(ctx context.Context, id string) (string, error) {
+	if severity, ok := c.severities[id]; ok {
+		return severity, nil
+	}
+	var vuln struct {
+		Severity []struct {
+			Type  string `json:"type"`
+			Score string `json:"score"`
+		} `json:"severity"`
+		DatabaseSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"database_specific"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/vulns/"+url.PathEscape(id), nil, &vuln); err != nil {
+		return "", fmt.Errorf("failed to fetch OSV vulnerability %s: %w", id, err)
+	}
+
+	severity := unknownSeverity
+	switch rating := strings.ToLower(vuln.DatabaseSpecific.Severity); rating {
+	case "moderate":
+		severity = "medium"
+	case "low", "medium", "high", "critical":
+		severity = rating
+	default:
+		for _, s := range vuln.Severity {
+			if s.Type != "CVSS_V3" {
+				continue
+			}
+			if score, err := cvss3BaseScore(s.Score); err == nil {
+				severity = cvssRating(score)
+				break
+			}
+		}
+	}
+	c.severities[id] = severity
+	return severity, nil
+}
+
+func (c *osvClient) do(ctx context.Context, method, path string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := newAPIClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newHTTPStatusError(resp, "%s returned", path)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3BaseScore computes the base score of a CVSS v3.0 or v3.1 vector, such as
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H
+func cvss3BaseScore(vector string) (float64, error) {
+	metrics := map[string]string{}
+	for _, part := range strings.Split(vector, "/")[1:] {
+		key, value, _ := strings.Cut(part, ":")
+		metrics[key] = value
+	}
+	if !strings.HasPrefix(vector, "CVSS:3.") {
+		return 0, fmt.Errorf("unsupported CVSS vector %q", vector)
+	}
+	changed := metrics["S"] == "C"
+	prWeights := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if changed {
+		prWeights = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}
+	}
+	weight := func(metric string) (float64, error) {
+		weights := cvss3Weights[metric]
+		if metric == "PR" {
+			weights = prWeights
+		}
+		w, ok := weights[metrics[metric]]
+		if !ok {
+			return 0, fmt.Errorf("invalid CVSS vector %q: missing or invalid %s", vector, metric)
+		}
+		return w, nil
+	}
+	w := map[string]float64{}
+	for _, metric := range []string{"AV", "AC", "PR", "UI", "C", "I", "A"} {
+		value, err := weight(metric)
+		if err != nil {
+			return 0, err
+		}
+		w[metric] = value
+	}
+
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * w["PR"] * w["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// roundUp rounds up to one decimal as specified by CVSS v3.1, avoiding floating point artifacts
+func roundUp(x float64) float64 {
+	i := int(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+func cvssRating(score float64) string {
+	switch {
+	case score >= 9:
+		return "critical"
+	case score >= 7:
+		return "high"
+	case score >= 4:
+		return "medium"
+	case score > 0:
+		return "low"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,62 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCVSS3BaseScore(t *testing.T) {
+	tests := []struct {
+		vector   string
+		score    float64
+		expected string
+	}{
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", score: 9.8},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", score: 10},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:C/C:H/I:H/A:H", score: 9.9},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", score: 6.1},
+		{vector: "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:H/I:N/A:N", score: 5.9},
+		{vector: "CVSS:3.0/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N", score: 5.5},
+		{vector: "CVSS:3.1/AV:P/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", score: 1.6},
+		{vector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", score: 0},
+		{vector: "CVSS:2.0/AV:N/AC:L/Au:N/C:P/I:P/A:P", expected: "unsupported CVSS vector"},
+		{vector: "AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", expected: "unsupported CVSS vector"},
+		{vector: "CVSS:3.1/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", expected: "missing or invalid AV"},
+		{vector: "CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", expected: "missing or invalid AV"},
+	}
+	for _, test := range tests {
+		t.Run(test.vector, func(t *testing.T) {
+			score, err := cvss3BaseScore(test.vector)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			case score != test.score:
+				t.Fatalf("expected a score of %v, got %v", test.score, score)
+			}
+		})
+	}
+}
+
+func TestVulnerabilityFails(t *testing.T) {
+	high := 2
+	tests := []struct {
+		severity string
+		ignore   bool
+		fails    bool
+	}{
+		{severity: "critical", fails: true},
+		{severity: "high", fails: true},
+		{severity: "medium"},
+		{severity: "none"},
+		{severity: unknownSeverity, fails: true},
+		{severity: unknownSeverity, ignore: true},
+	}
+	for _, test := range tests {
+		opts := VerificationOptions{IgnoreUnknownSeverity: test.ignore}
+		if fails := (Vulnerability{Severity: test.severity}).fails(high, opts); fails != test.fails {
+			t.Errorf("severity %s with --ignore-unknown-severity=%v: expected fails=%v, got %v", test.severity, test.ignore, test.fails, fails)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// opaHostModule is the host module implementing the functions OPA policies import from env
+const opaHostModule = "opa_host"
+
+// evaluateOPAModule evaluates the first entrypoint of a policy built with opa build -t wasm, with
+// the verification context as input and no data. The entrypoint must evaluate to a boolean or to
+// a decision like {"allow": true}, and an undefined entrypoint denies the image. Policies calling
+// builtins the OPA ABI leaves to the host, e.g. http.send or time.now_ns, are refused.
+func evaluateOPAModule(ctx context.Context, runtime wazero.Runtime, compiled wazero.CompiledModule, input []byte) (WASMPolicyDecision, error) {
+	if err := instantiateOPAEnv(ctx, runtime, compiled); err != nil {
+		return WASMPolicyDecision{}, err
+	}
+	module, err := runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("policy"))
+	if err != nil {
+		return WASMPolicyDecision{}, err
+	}
+	policy := opaPolicy{module: module}
+
+	builtins, err := policy.builtins(ctx)
+	if err != nil {
+		return WASMPolicyDecision{}, err
+	}
+	if len(builtins) > 0 {
+		return WASMPolicyDecision{}, fmt.Errorf("unsupported builtins %s", strings.Join(builtins, ", "))
+	}
+	result, err := policy.eval(ctx, input)
+	if err != nil {
+		return WASMPolicyDecision{}, err
+	}
+
+	var results []struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(result, &results); err != nil {
+		return WASMPolicyDecision{}, fmt.Errorf("invalid result: %w", err)
+	}
+	if len(results) == 0 {
+		return WASMPolicyDecision{Reason: "the policy is undefined"}, nil
+	}
+	var allow bool
+	if err := json.Unmarshal(results[0].Result, &allow); err == nil {
+		return WASMPolicyDecision{Allow: allow}, nil
+	}
+	var decision WASMPolicyDecision
+	if err := json.Unmarshal(results[0].Result, &decision); err != nil {
+		return WASMPolicyDecision{}, fmt.Errorf("invalid result, expected a boolean or a decision: %s", results[0].Result)
+	}
+	return decision, nil
+}
+
+// opaPolicy calls the exports of an instantiated OPA policy
+type opaPolicy struct {
+	module api.Module
+}
+
+func (p opaPolicy) call(ctx context.Context, name string, params ...uint64) (uint32, error) {
+	fn := p.module.ExportedFunction(name)
+	if fn == nil {
+		return 0, fmt.Errorf("not an OPA policy: missing export %s", name)
+	}
+	results, err := fn.Call(ctx, params...)
+	if err != nil {
+		// drop the wasm stack trace wazero appends to the error
+		message, _, _ := strings.Cut(err.Error(), "\n")
+		return 0, fmt.Errorf("%s: %s", name, message)
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return api.DecodeU32(results[0]), nil
+}
+
+// builtins returns the names of the builtins the policy expects the host to implement
+func (p opaPolicy) builtins(ctx context.Context) ([]string, error) {
+	value, err := p.call(ctx, "builtins")
+	if err != nil {
+		return nil, err
+	}
+	dump, err := p.call(ctx, "opa_json_dump", uint64(value))
+	if err != nil {
+		return nil, err
+	}
+	data, err := readCString(p.module.Memory(), dump)
+	if err != nil {
+		return nil, err
+	}
+	var builtins map[string]int
+	if err := json.Unmarshal(data, &builtins); err != nil {
+		return nil, fmt.Errorf("invalid builtins: %w", err)
+	}
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// eval evaluates the first entrypoint against the input, returning the JSON result set
+func (p opaPolicy) eval(ctx context.Context, input []byte) ([]byte, error) {
+	data := []byte("{}")
+	dataAddr, err := p.write(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	dataValue, err := p.call(ctx, "opa_json_parse", uint64(dataAddr), uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if dataValue == 0 {
+		return nil, errors.New("opa_json_parse failed")
+	}
+	inputAddr, err := p.write(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	heap, err := p.call(ctx, "opa_heap_ptr_get")
+	if err != nil {
+		return nil, err
+	}
+	// reserved, entrypoint, data, input, input length, heap, JSON output
+	result, err := p.call(ctx, "opa_eval", 0, 0, uint64(dataValue), uint64(inputAddr), uint64(len(input)), uint64(heap), 0)
+	if err != nil {
+		return nil, err
+	}
+	return readCString(p.module.Memory(), result)
+}
+
+// write copies data to memory allocated on the heap of the policy
+func (p opaPolicy) write(ctx context.Context, data []byte) (uint32, error) {
+	addr, err := p.call(ctx, "opa_malloc", uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	if !p.module.Memory().Write(addr, data) {
+		return 0, errors.New("out of memory")
+	}
+	return addr, nil
+}
+
+// readCString copies the NUL-terminated string at addr
+func readCString(memory api.Memory, addr uint32) ([]byte, error) {
+	if memory == nil {
+		return nil, errors.New("no memory")
+	}
+	rest, ok := memory.Read(addr, memory.Size()-min(addr, memory.Size()))
+	if !ok {
+		return nil, fmt.Errorf("invalid address %d", addr)
+	}
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated string at %d", addr)
+	}
+	return bytes.Clone(rest[:end]), nil
+}
+
+// instantiateOPAEnv provides the env module OPA policies import their memory and host functions
+// from. wazero host modules can't define a memory, so env is a WASM module defining the memory
+// and re-exporting the functions of a host module.
+func instantiateOPAEnv(ctx context.Context, runtime wazero.Runtime, compiled wazero.CompiledModule) error {
+	var memoryPages uint32
+	for _, memory := range compiled.ImportedMemories() {
+		if module, name, _ := memory.Import(); module != "env" || name != "memory" {
+			return fmt.Errorf("unsupported import %s.%s", module, name)
+		}
+		memoryPages = memory.Min()
+	}
+	host := runtime.NewHostModuleBuilder(opaHostModule)
+	var functions []api.FunctionDefinition
+	for _, function := range compiled.ImportedFunctions() {
+		module, name, _ := function.Import()
+		fn, err := opaHostFunction(module, name)
+		if err != nil {
+			return err
+		}
+		host.NewFunctionBuilder().WithGoModuleFunction(fn, function.ParamTypes(), function.ResultTypes()).Export(name)
+		functions = append(functions, function)
+	}
+	if _, err := host.Instantiate(ctx); err != nil {
+		return err
+	}
+	env, err := runtime.CompileModule(ctx, opaEnvModule(functions, memoryPages))
+	if err != nil {
+		return err
+	}
+	_, err = runtime.InstantiateModule(ctx, env, wazero.NewModuleConfig().WithName("env"))
+	return err
+}
+
+// opaHostFunction implements a function of the OPA ABI. The builtins are never called, since
+// policies requiring them are refused before their evaluation.
+func opaHostFunction(module, name string) (api.GoModuleFunc, error) {
+	if module != "env" {
+		return nil, fmt.Errorf("unsupported import %s.%s", module, name)
+	}
+	switch name {
+	case "opa_abort":
+		return func(ctx context.Context, m api.Module, stack []uint64) {
+			message, _ := readCString(m.Memory(), api.DecodeU32(stack[0]))
+			panic(fmt.Errorf("opa_abort: %s", message))
+		}, nil
+	case "opa_println":
+		return func(context.Context, api.Module, []uint64) {}, nil
+	case "opa_builtin0", "opa_builtin1", "opa_builtin2", "opa_builtin3", "opa_builtin4":
+		return func(context.Context, api.Module, []uint64) {
+			panic(errors.New("builtins are not supported"))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported import %s.%s", module, name)
+	}
+}
+
+// opaEnvModule encodes a WASM module importing the functions from the host module and exporting
+// them, along with a memory of at least memoryPages pages, under their names
+func opaEnvModule(functions []api.FunctionDefinition, memoryPages uint32) []byte {
+	var types, imports, exports []byte
+	types = binary.AppendUvarint(types, uint64(len(functions)))
+	imports = binary.AppendUvarint(imports, uint64(len(functions)))
+	exports = binary.AppendUvarint(exports, uint64(len(functions)+1))
+	for i, function := range functions {
+		_, name, _ := function.Import()
+		types = append(types, 0x60)
+		types = appendWASMValueTypes(types, function.ParamTypes())
+		types = appendWASMValueTypes(types, function.ResultTypes())
+		imports = appendWASMName(imports, opaHostModule)
+		imports = appendWASMName(imports, name)
+		imports = append(imports, 0x00) // function of type i
+		imports = binary.AppendUvarint(imports, uint64(i))
+		exports = appendWASMName(exports, name)
+		exports = append(exports, 0x00) // function i
+		exports = binary.AppendUvarint(exports, uint64(i))
+	}
+	exports = appendWASMName(exports, "memory")
+	exports = append(exports, 0x02, 0x00) // memory 0
+
+	memories := []byte{0x01, 0x00} // one memory without a maximum, capped by the runtime
+	memories = binary.AppendUvarint(memories, uint64(memoryPages))
+
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	module = appendWASMSection(module, 1, types)
+	module = appendWASMSection(module, 2, imports)
+	module = appendWASMSection(module, 5, memories)
+	return appendWASMSection(module, 7, exports)
+}
+
+func appendWASMSection(module []byte, id byte, section []byte) []byte {
+	module = append(module, id)
+	module = binary.AppendUvarint(module, uint64(len(section)))
+	return append(module, section...)
+}
+
+func appendWASMName(b []byte, name string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(name)))
+	return append(b, name...)
+}
+
+func appendWASMValueTypes(b []byte, types []api.ValueType) []byte {
+	b = binary.AppendUvarint(b, uint64(len(types)))
+	return append(b, types...)
+}
@@ -0,0 +1,180 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmPolicyTimeout bounds the run of a WASM policy, which may loop forever
+var wasmPolicyTimeout = 10 * time.Second
+
+// errWASMPolicyTimeout is the cause of the context of a policy stopped after wasmPolicyTimeout, which
+// tells the timeout apart from the cancellation of the verification
+var errWASMPolicyTimeout = errors.New("WASM policy timed out")
+
+const (
+	// wasmPagesPerMiB is the number of 64KiB pages of WASM memory in a MiB
+	wasmPagesPerMiB = 16
+	// maxWASMOutput caps what a WASI policy can write to stdout, and maxWASMError what it can write
+	// to stderr, which is included in the error
+	maxWASMOutput = 1 << 20
+	maxWASMError  = 1 << 10
+)
+
+// wasmCompilationCache keeps the machine code of the modules compiled by the runtimes of earlier
+// evaluations, so that serve only compiles each policy once
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+// WASMPolicyInput is the verification context a WASM policy reads on stdin, or as the input
+// document of an OPA policy
+type WASMPolicyInput struct {
+	Image        string            `json:"image"`
+	Digest       string            `json:"digest"`
+	Attestations []WASMAttestation `json:"attestations"`
+}
+
+// WASMAttestation is a verified attestation of the image
+type WASMAttestation struct {
+	PredicateType string            `json:"predicateType,omitempty"`
+	Predicate     json.RawMessage   `json:"predicate,omitempty"`
+	Issuer        string            `json:"issuer,omitempty"`
+	Subject       string            `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// WASMPolicyDecision is what a WASM policy writes on stdout, or the value of the entrypoint of an
+// OPA policy. Images are denied unless the policy explicitly allows them.
+type WASMPolicyDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// evaluateWASMPolicies runs every --wasm-policy against the verified attestations of an image, and
+// fails unless all of them allow it. The modules run in an embedded runtime, which gives them no
+// access to the filesystem, the network or the environment, caps their memory at
+// --wasm-memory-limit and stops them after wasmPolicyTimeout, so that policies written by tenants
+// can't affect the verifier.
+func evaluateWASMPolicies(ctx context.Context, image string, results []VerificationResult, opts VerificationOptions) error {
+	if len(opts.WASMPolicies) == 0 {
+		return nil
+	}
+	input := WASMPolicyInput{Image: image, Digest: results[0].Desc.Digest.String()}
+	for _, result := range results {
+		var attestation WASMAttestation
+		if statement := result.Bundle.DSSE_Envelope; statement != nil {
+			attestation.PredicateType = statement.PredicateType
+			if predicate, err := result.Bundle.RawPredicate(); err == nil {
+				attestation.Predicate = predicate
+			}
+		}
+		if signer, ok := signerSummary(result.Bundle); ok {
+			attestation.Issuer, attestation.Subject = signer.Extensions.Issuer, signer.SubjectAlternativeName
+		}
+		attestation.Annotations = result.Annotations
+		input.Attestations = append(input.Attestations, attestation)
+	}
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	for _, module := range opts.WASMPolicies {
+		decision, err := runWASMPolicy(ctx, module, inputJSON, opts.WASMMemoryLimit)
+		if err != nil {
+			return fmt.Errorf("WASM policy %s: %w", filepath.Base(module), err)
+		}
+		if !decision.Allow {
+			reason := decision.Reason
+			if reason == "" {
+				reason = "not allowed"
+			}
+			return fmt.Errorf("WASM policy %s denied the image: %s", filepath.Base(module), reason)
+		}
+	}
+	return nil
+}
+
+// runWASMPolicy evaluates a module in a runtime of its own, limited to memoryLimit MiB: modules
+// built with opa build -t wasm through the OPA ABI, and other modules as WASI commands
+func runWASMPolicy(ctx context.Context, module string, input []byte, memoryLimit int) (WASMPolicyDecision, error) {
+	wasm, err := os.ReadFile(module)
+	if err != nil {
+		return WASMPolicyDecision{}, err
+	}
+	if memoryLimit < 1 || memoryLimit > 4096 {
+		return WASMPolicyDecision{}, fmt.Errorf("invalid memory limit %dMiB, expected 1 to 4096", memoryLimit)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, wasmPolicyTimeout, errWASMPolicyTimeout)
+	defer cancel()
+	config := wazero.NewRuntimeConfig().
+		WithCompilationCache(wasmCompilationCache).
+		WithMemoryLimitPages(uint32(memoryLimit) * wasmPagesPerMiB).
+		WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	defer runtime.Close(context.Background())
+
+	compiled, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return WASMPolicyDecision{}, fmt.Errorf("invalid module: %w", err)
+	}
+	var decision WASMPolicyDecision
+	if _, ok := compiled.ExportedFunctions()["opa_eval"]; ok {
+		decision, err = evaluateOPAModule(ctx, runtime, compiled, input)
+	} else {
+		decision, err = runWASICommand(ctx, runtime, compiled, input)
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, errWASMPolicyTimeout) {
+		return WASMPolicyDecision{}, fmt.Errorf("stopped after %s", wasmPolicyTimeout)
+	} else if cause != nil {
+		return WASMPolicyDecision{}, cause
+	}
+	return decision, err
+}
+
+// runWASICommand runs the module with the input on stdin and reads its decision from stdout
+func runWASICommand(ctx context.Context, runtime wazero.Runtime, compiled wazero.CompiledModule, input []byte) (WASMPolicyDecision, error) {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return WASMPolicyDecision{}, err
+	}
+	stdout := &limitedBuffer{limit: maxWASMOutput}
+	stderr := &limitedBuffer{limit: maxWASMError}
+	config := wazero.NewModuleConfig().WithStdin(bytes.NewReader(input)).WithStdout(stdout).WithStderr(stderr)
+	if _, err := runtime.InstantiateModule(ctx, compiled, config); err != nil {
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return WASMPolicyDecision{}, fmt.Errorf("exited with code %d: %s", exitErr.ExitCode(), strings.TrimSpace(stderr.String()))
+		}
+		return WASMPolicyDecision{}, err
+	}
+	var decision WASMPolicyDecision
+	if err := json.Unmarshal(stdout.Bytes(), &decision); err != nil {
+		return WASMPolicyDecision{}, fmt.Errorf("invalid response: %w", err)
+	}
+	return decision, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest, so that a module
+// can't exhaust the memory of the verifier by writing to stdout
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
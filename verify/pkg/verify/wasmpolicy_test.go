@@ -0,0 +1,139 @@
+package verify
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wasiModule encodes a WASI command with a memory of memoryPages pages, whose _start runs code
+// after its data segment put an iovec of output at address 0
+func wasiModule(memoryPages int, output string, code []byte) []byte {
+	types := []byte{0x02,
+		0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f, // fd_write(fd, iovs, iovs_len, nwritten) errno
+		0x60, 0x00, 0x00, // _start()
+	}
+	imports := appendWASMName([]byte{0x01}, "wasi_snapshot_preview1")
+	imports = appendWASMName(imports, "fd_write")
+	imports = append(imports, 0x00, 0x00) // function of type 0
+	memories := binary.AppendUvarint([]byte{0x01, 0x00}, uint64(memoryPages))
+	exports := appendWASMName([]byte{0x02}, "_start")
+	exports = append(exports, 0x00, 0x01) // function 1, after the import
+	exports = appendWASMName(exports, "memory")
+	exports = append(exports, 0x02, 0x00)
+
+	body := append([]byte{0x00}, code...) // no locals
+	codes := binary.AppendUvarint([]byte{0x01}, uint64(len(body)))
+	codes = append(codes, body...)
+
+	// the iovec at 0 points to the output at 16, and fd_write stores the bytes written at 8
+	segment := binary.LittleEndian.AppendUint32(nil, 16)
+	segment = binary.LittleEndian.AppendUint32(segment, uint32(len(output)))
+	segment = append(segment, make([]byte, 8)...)
+	segment = append(segment, output...)
+	data := []byte{0x01, 0x00, 0x41, 0x00, 0x0b} // one active segment at i32.const 0
+	data = binary.AppendUvarint(data, uint64(len(segment)))
+	data = append(data, segment...)
+
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	module = appendWASMSection(module, 1, types)
+	module = appendWASMSection(module, 2, imports)
+	module = appendWASMSection(module, 3, []byte{0x01, 0x01}) // _start of type 1
+	module = appendWASMSection(module, 5, memories)
+	module = appendWASMSection(module, 7, exports)
+	module = appendWASMSection(module, 10, codes)
+	return appendWASMSection(module, 11, data)
+}
+
+var (
+	// wasiWriteOutput writes the output to stdout: fd_write(1, 0, 1, 8)
+	wasiWriteOutput = []byte{0x41, 0x01, 0x41, 0x00, 0x41, 0x01, 0x41, 0x08, 0x10, 0x00, 0x1a, 0x0b}
+	// wasiLoop never returns
+	wasiLoop = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b}
+)
+
+func writeWASMModule(t *testing.T, module []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.wasm")
+	if err := os.WriteFile(path, module, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunWASMPolicy(t *testing.T) {
+	defer func(timeout time.Duration) { wasmPolicyTimeout = timeout }(wasmPolicyTimeout)
+	wasmPolicyTimeout = time.Second
+
+	provenance, err := json.Marshal(WASMPolicyInput{Attestations: []WASMAttestation{{PredicateType: "https://slsa.dev/provenance/v1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom, err := json.Marshal(WASMPolicyInput{Attestations: []WASMAttestation{{PredicateType: "https://spdx.dev/Document/v2.3"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opa := filepath.Join("testdata", "wasm", "policy.wasm")
+
+	tests := []struct {
+		name        string
+		module      string
+		input       []byte
+		memoryLimit int
+		decision    WASMPolicyDecision
+		expected    string
+	}{
+		{name: "WASI allow", module: writeWASMModule(t, wasiModule(1, `{"allow": true}`, wasiWriteOutput)), input: provenance, decision: WASMPolicyDecision{Allow: true}},
+		{
+			name:     "WASI deny",
+			module:   writeWASMModule(t, wasiModule(1, `{"allow": false, "reason": "unsigned"}`, wasiWriteOutput)),
+			input:    provenance,
+			decision: WASMPolicyDecision{Reason: "unsigned"},
+		},
+		{name: "WASI invalid response", module: writeWASMModule(t, wasiModule(1, "allow", wasiWriteOutput)), input: provenance, expected: "invalid response"},
+		{name: "WASI timeout", module: writeWASMModule(t, wasiModule(1, "", wasiLoop)), input: provenance, expected: "stopped after 1s"},
+		{name: "WASI memory limit", module: writeWASMModule(t, wasiModule(2*wasmPagesPerMiB, `{"allow": true}`, wasiWriteOutput)), input: provenance, memoryLimit: 1, expected: "invalid module"},
+		{name: "OPA allow", module: opa, input: provenance, decision: WASMPolicyDecision{Allow: true}},
+		{name: "OPA deny", module: opa, input: sbom, decision: WASMPolicyDecision{Reason: "no SLSA provenance"}},
+		{name: "OPA undefined", module: opa, input: []byte(`{"attestations": []}`), decision: WASMPolicyDecision{Reason: "the policy is undefined"}},
+		{
+			// the input is copied to the heap of the policy, which can't grow past the limit
+			name:        "OPA memory limit",
+			module:      opa,
+			input:       []byte(`{"image": "` + strings.Repeat("a", 2<<20) + `"}`),
+			memoryLimit: 1,
+			expected:    "opa_malloc",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memoryLimit := test.memoryLimit
+			if memoryLimit == 0 {
+				memoryLimit = 64
+			}
+			decision, err := runWASMPolicy(context.Background(), test.module, test.input, memoryLimit)
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+			case decision != test.decision:
+				t.Fatalf("expected %+v, got %+v", test.decision, decision)
+			}
+		})
+	}
+}
+
+func TestRunWASMPolicyCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := runWASMPolicy(ctx, writeWASMModule(t, wasiModule(1, "", wasiLoop)), []byte("{}"), 64)
+	if err == nil || strings.Contains(err.Error(), "stopped after") {
+		t.Fatalf("expected the cancellation of the verification rather than the policy timeout, got %v", err)
+	}
+}
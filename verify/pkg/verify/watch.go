@@ -0,0 +1,208 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// WatchEvent is emitted when the digest or the verification status of a watched image changes
+type WatchEvent struct {
+	Time           time.Time `json:"time"`
+	Image          string    `json:"image"`
+	Digest         string    `json:"digest,omitempty"`
+	PreviousDigest string    `json:"previousDigest,omitempty"`
+	Verified       bool      `json:"verified"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// watchState is what the last poll saw for an image
+type watchState struct {
+	digest      string
+	fingerprint string
+	verified    bool
+	err         string
+}
+
+func newWatchCommand() *cobra.Command {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	opts := VerificationOptions{}
+	var images stringsFlag
+	fs.Var(&images, "image", "image to watch (can be repeated), - to read the images from stdin")
+	interval := fs.Duration("interval", 5*time.Minute, "how often to poll the images")
+	webhook := fs.String("webhook", "", "URL to POST each event to as JSON")
+	eventsFile := fs.String("events-file", "", "file to append each event to as a JSON line")
+	trustRefresh := fs.Duration("trust-refresh-interval", time.Hour, "how often to refresh the trusted root from TUF")
+	addVerificationFlags(fs, &opts)
+	return newCommand(fs, commandDoc{
+		Use:     "watch --image <image>...",
+		Short:   "Poll images and report when their digest or verification status changes",
+		Example: "  watch --image ghcr.io/nirmata/github-signing-demo:latest --subject \"...\" --interval 10m --webhook https://hooks.example.com/attestations",
+	}, func(args []string) error {
+		applyGitHubHost(&opts)
+		if err := applyGitHubWorkflows(&opts); err != nil {
+			return err
+		}
+		if err := configureTransport(opts); err != nil {
+			return err
+		}
+		if err := loadPins(&opts); err != nil {
+			return err
+		}
+		if err := validateOutput(opts.Output); err != nil {
+			return err
+		}
+		if err := validateOnError(opts.OnError); err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			return errors.New("watch expects at least one --image")
+		}
+		images, err := expandStdinImages(images, os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		trust, err := NewTrustProvider(ctx, opts, *trustRefresh)
+		if err != nil {
+			return err
+		}
+
+		states := map[string]watchState{}
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			for _, image := range images {
+				event, changed := pollImage(ctx, image, opts, trust, states)
+				if !changed {
+					continue
+				}
+				if err := emitWatchEvent(ctx, event, *webhook, *eventsFile); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to emit event for %s: %v\n", image, err)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// pollImage re-verifies an image when its digest or its set of bundles changed since the last poll,
+// and returns an event when the digest or the verification status changed
+func pollImage(ctx context.Context, image string, opts VerificationOptions, trust *TrustProvider, states map[string]watchState) (WatchEvent, bool) {
+	previous, seen := states[image]
+	current := watchState{}
+
+	bundles, desc, err := resolveBundles(ctx, image, opts)
+	if err == nil {
+		current.digest = desc.Digest.String()
+		current.fingerprint, err = bundlesFingerprint(bundles)
+	}
+	if err == nil && seen && current.digest == previous.digest && current.fingerprint == previous.fingerprint {
+		return WatchEvent{}, false
+	}
+	var results []VerificationResult
+	if err == nil {
+		results, err = verifyAttestations(ctx, image, bundles, desc, trust.TrustedRoot(), opts)
+	}
+	if recordErr := recordOutcomes(opts, ImageResult{Image: image, Results: results, Err: err}); recordErr != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", recordErr)
+	}
+	current.verified = err == nil
+	if err != nil {
+		current.err = err.Error()
+	}
+	states[image] = current
+
+	if seen && current.digest == previous.digest && current.verified == previous.verified && current.err == previous.err {
+		return WatchEvent{}, false
+	}
+	return WatchEvent{
+		Time:           time.Now().UTC(),
+		Image:          image,
+		Digest:         current.digest,
+		PreviousDigest: previous.digest,
+		Verified:       current.verified,
+		Error:          current.err,
+	}, true
+}
+
+// bundlesFingerprint identifies a set of bundles regardless of the order they were listed in
+func bundlesFingerprint(bundles []*Bundle) (string, error) {
+	digests := make([]string, 0, len(bundles))
+	for _, b := range bundles {
+		digest, err := bundleDigest(b)
+		if err != nil {
+			return "", err
+		}
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	sum := sha256.New()
+	for _, digest := range digests {
+		sum.Write([]byte(digest))
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// emitWatchEvent prints the event, and sends it to the webhook and the events file when configured
+func emitWatchEvent(ctx context.Context, event WatchEvent, webhook, eventsFile string) error {
+	status := "✓"
+	if !event.Verified {
+		status = "✗"
+	}
+	fmt.Printf("%s %s %s %s\n", event.Time.Format(time.RFC3339), status, event.Image, event.Digest)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if eventsFile != "" {
+		f, err := os.OpenFile(eventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(payload, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if webhook != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := newAPIClient().Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook %s returned %s", webhook, resp.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package verify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// selfSignedValidity is how long self-signed certificates are valid, and selfSignedRenewBefore how
+	// long before they expire they are replaced
+	selfSignedValidity    = 365 * 24 * time.Hour
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// certLoader loads the current serving certificate of the webhook
+type certLoader func(ctx context.Context) (*tls.Certificate, error)
+
+// certReloader serves the certificate of its loader, reloading it every interval so that rotated
+// certificates are picked up without a restart. A failed reload keeps the previous certificate.
+type certReloader struct {
+	load certLoader
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(ctx context.Context, load certLoader, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{load: load}
+	cert, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.cert = cert
+	if interval > 0 {
+		go r.reloadEvery(ctx, interval)
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) reloadEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cert, err := r.load(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to reload the TLS certificate, keeping the current one: %v\n", err)
+			continue
+		}
+		r.mu.Lock()
+		r.cert = cert
+		r.mu.Unlock()
+	}
+}
+
+// fileCertLoader reads the certificate and key from files, e.g. a mounted secret that cert-manager
+// or kubelet updates in place
+func fileCertLoader(certPath, keyPath string) certLoader {
+	return func(context.Context) (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		return &cert, nil
+	}
+}
+
+// kubeSecret is the subset of a core/v1 Secret the webhook reads and writes
+type kubeSecret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeObjectMeta    `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data"`
+}
+
+type kubeObjectMeta struct {
+	Name            string `json:"name,omitempty"`
+	GenerateName    string `json:"generateName,omitempty"`
+	Namespace       string `json:"namespace,omitempty"`
+	UID             string `json:"uid,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+func secretPath(namespace, name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", namespace, name)
+}
+
+// secretCertLoader reads the certificate and key from the tls.crt and tls.key of a kubernetes.io/tls secret
+func secretCertLoader(client *kubeClient, namespace, name string) certLoader {
+	return func(ctx context.Context) (*tls.Certificate, error) {
+		var secret kubeSecret
+		if err := client.get(ctx, secretPath(namespace, name), &secret); err != nil {
+			return nil, fmt.Errorf("failed to read TLS secret %s/%s: %w", namespace, name, err)
+		}
+		cert, err := tls.X509KeyPair(secret.Data["tls.crt"], secret.Data["tls.key"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS secret %s/%s: %w", namespace, name, err)
+		}
+		return &cert, nil
+	}
+}
+
+// selfSignedCertLoader keeps a self-signed CA and serving certificate for the webhook service in a
+// secret, replacing them before they expire, and patches the CA into the caBundle of the webhook
+// configuration. Replicas sharing the secret serve the same certificate.
+func selfSignedCertLoader(client *kubeClient, namespace, name string, dnsNames []string, webhookConfig string) certLoader {
+	load := secretCertLoader(client, namespace, name)
+	return func(ctx context.Context) (*tls.Certificate, error) {
+		caPEM, err := ensureSelfSignedSecret(ctx, client, namespace, name, dnsNames)
+		if err != nil {
+			return nil, err
+		}
+		if webhookConfig != "" {
+			if err := patchCABundle(ctx, client, webhookConfig, caPEM); err != nil {
+				return nil, err
+			}
+		}
+		return load(ctx)
+	}
+}
+
+// ensureSelfSignedSecret returns the CA of the secret, generating a new CA and certificate when the
+// secret is missing or its certificate expires soon
+func ensureSelfSignedSecret(ctx context.Context, client *kubeClient, namespace, name string, dnsNames []string) ([]byte, error) {
+	var secret kubeSecret
+	err := client.get(ctx, secretPath(namespace, name), &secret)
+	exists := err == nil
+	if err != nil && !isKubeNotFound(err) {
+		return nil, fmt.Errorf("failed to read TLS secret %s/%s: %w", namespace, name, err)
+	}
+	if exists && !certificateExpiresSoon(secret.Data["tls.crt"], time.Now()) && len(secret.Data["ca.crt"]) > 0 {
+		return secret.Data["ca.crt"], nil
+	}
+
+	caPEM, certPEM, keyPEM, err := generateSelfSignedCertificate(dnsNames, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	secret.APIVersion, secret.Kind, secret.Type = "v1", "Secret", "kubernetes.io/tls"
+	secret.Metadata.Name, secret.Metadata.Namespace = name, namespace
+	secret.Data = map[string][]byte{"ca.crt": caPEM, "tls.crt": certPEM, "tls.key": keyPEM}
+	if exists {
+		err = client.update(ctx, secretPath(namespace, name), secret, nil)
+	} else {
+		err = client.create(ctx, fmt.Sprintf("/api/v1/namespaces/%s/secrets", namespace), secret, nil)
+	}
+	if isKubeConflict(err) {
+		// another replica generated the certificate first, use theirs
+		if err := client.get(ctx, secretPath(namespace, name), &secret); err != nil {
+			return nil, fmt.Errorf("failed to read TLS secret %s/%s: %w", namespace, name, err)
+		}
+		return secret.Data["ca.crt"], nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write TLS secret %s/%s: %w", namespace, name, err)
+	}
+	fmt.Fprintf(os.Stderr, "generated a self-signed TLS certificate for %s in secret %s/%s\n", dnsNames[len(dnsNames)-1], namespace, name)
+	return caPEM, nil
+}
+
+// patchCABundle sets the caBundle of every webhook of a ValidatingWebhookConfiguration
+func patchCABundle(ctx context.Context, client *kubeClient, webhookConfig string, caPEM []byte) error {
+	path := "/apis/admissionregistration.k8s.io/v1/validatingwebhookconfigurations/" + webhookConfig
+	var config struct {
+		Webhooks []map[string]any `json:"webhooks"`
+	}
+	if err := client.get(ctx, path, &config); err != nil {
+		return fmt.Errorf("failed to read webhook configuration %s: %w", webhookConfig, err)
+	}
+	caBundle := base64.StdEncoding.EncodeToString(caPEM)
+	changed := false
+	for _, webhook := range config.Webhooks {
+		clientConfig, _ := webhook["clientConfig"].(map[string]any)
+		if clientConfig == nil {
+			clientConfig = map[string]any{}
+			webhook["clientConfig"] = clientConfig
+		}
+		if clientConfig["caBundle"] != caBundle {
+			clientConfig["caBundle"] = caBundle
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	// webhooks is a list keyed by name, so a merge patch replaces it as a whole
+	if err := client.patch(ctx, path, map[string]any{"webhooks": config.Webhooks}, nil); err != nil {
+		return fmt.Errorf("failed to patch the caBundle of webhook configuration %s: %w", webhookConfig, err)
+	}
+	return nil
+}
+
+// webhookDNSNames are the names the API server may use to reach the service
+func webhookDNSNames(service, namespace string) []string {
+	return []string{
+		service,
+		fmt.Sprintf("%s.%s", service, namespace),
+		fmt.Sprintf("%s.%s.svc", service, namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", service, namespace),
+	}
+}
+
+func certificateExpiresSoon(certPEM []byte, now time.Time) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	return now.Add(selfSignedRenewBefore).After(cert.NotAfter)
+}
+
+// generateSelfSignedCertificate creates a CA and a serving certificate signed by it, PEM encoded
+func generateSelfSignedCertificate(dnsNames []string, now time.Time) (caPEM, certPEM, keyPEM []byte, err error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "github-signing-demo-verify webhook CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return caPEM, certPEM, keyPEM, nil
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	return serial
+}
+
+// webhookCertLoader picks the certificate source from the serve flags, returning nil to serve plain HTTP
+func webhookCertLoader(certPath, keyPath, secret string, selfSigned bool, service, webhookConfig string) (certLoader, error) {
+	switch {
+	case certPath != "" || keyPath != "":
+		if certPath == "" || keyPath == "" {
+			return nil, errors.New("--tls-cert and --tls-key must be set together")
+		}
+		if secret != "" || selfSigned {
+			return nil, errors.New("--tls-cert can't be combined with --tls-secret or --self-signed-tls")
+		}
+		return fileCertLoader(certPath, keyPath), nil
+	case secret == "":
+		if selfSigned {
+			return nil, errors.New("--self-signed-tls requires --tls-secret to store the certificate in")
+		}
+		return nil, nil
+	}
+
+	client, err := newInClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace, name, err := parseNamespacedName(secret)
+	if err != nil {
+		return nil, err
+	}
+	if !selfSigned {
+		return secretCertLoader(client, namespace, name), nil
+	}
+	if service == "" {
+		return nil, errors.New("--self-signed-tls requires --webhook-service, the service the certificate is issued for")
+	}
+	serviceNamespace, serviceName, err := parseNamespacedName(service)
+	if err != nil {
+		return nil, err
+	}
+	return selfSignedCertLoader(client, namespace, name, webhookDNSNames(serviceName, serviceNamespace), webhookConfig), nil
+}